@@ -2,6 +2,8 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -32,23 +34,58 @@ type Model struct {
 
 	// Data
 	workspaces       []*domain.Workspace
+	views            []*domain.SavedView // Shown after the workspaces
 	todos            []*domain.Todo
 	selectedWsIndex  int
 	selectedTodoIndex int
 
+	// Items to select once the lists reload, e.g. one just created
+	selectWorkspaceID string
+	selectTodoID      string
+	selectTag         string
+
 	// Input state
 	inputBuffer  string
 	inputPrompt  string
 	inputAction  string // "add", "add_child", "edit"
 	editingIndex int    // Index of item being edited (-1 if adding new)
+	viewQuery    string // Query waiting for a name to be saved as a view
 
 	// Search state
-	searchResults []*domain.Todo
-	isSearching   bool
+	searchResults  []*domain.Todo
+	searchSnippets map[string]string // Matched part of each result's description
+	searchArchived bool              // Search archived todos too
+	searchError    string            // Why the query could not be read
+	isSearching    bool
+
+	// Tag browser, shown in place of the workspaces
+	showTags         bool
+	tags             []*domain.Tag
+	selectedTagIndex int
 
 	// Help screen
 	showHelp bool
 
+	// Read-only view of the selected workspace in the past
+	timeTravel timeTravelView
+
+	// History panel
+	showHistory          bool
+	history              []*repository.HistoryEntry
+	selectedHistoryIndex int
+
+	// Trash panel
+	showTrash          bool
+	trash              []*repository.TrashEntry
+	selectedTrashIndex int
+	pendingPurge       bool
+	trashRetention     time.Duration
+
+	// Moving todos to another workspace
+	showPicker bool
+	picker     workspacePicker
+	cut        *domain.Todo // Todo waiting to be pasted
+
 	// Notification
 	notification    string
 	notificationErr bool
@@ -57,25 +94,51 @@ type Model struct {
 	db            *repository.DB
 	workspaceRepo *repository.WorkspaceRepository
 	todoRepo      *repository.TodoRepository
+	historyRepo   *repository.HistoryRepository
+	trashRepo     *repository.TrashRepository
+	viewRepo      *repository.SavedViewRepository
+	tagRepo       *repository.TagRepository
+	applier       *repository.Applier
 	wal           *wal.WAL
 
+	// Result of replaying the WAL on startup
+	recovery *wal.RecoveryResult
+
+	// Integrity problems the startup check could not repair
+	integrityIssues []*domain.IntegrityError
+
 	// Pending delete (for dd confirmation)
 	pendingDelete bool
 
+	// Workspace delete waiting for the dialog to be confirmed
+	confirmDelete *workspaceDeletion
+
 	// Error state
 	err error
 }
 
+// DefaultShutdownTimeout bounds how long Close waits for pending writes
+const DefaultShutdownTimeout = 5 * time.Second
+
+// compactionTimeout bounds how long shutdown spends compacting the log
+const compactionTimeout = 2 * time.Second
+
 // Config holds the application configuration
 type Config struct {
-	DBPath string
+	DBPath         string
+	Retention      wal.RetentionPolicy // Undo history kept when compacting on shutdown
+	TrashRetention time.Duration       // Age at which a purge removes deleted items; zero means the default
 }
 
 // New creates a new application model
 func New(cfg Config) Model {
 	m := Model{
-		mode:       input.ModeNormal,
-		activePane: PaneWorkspace,
+		mode:           input.ModeNormal,
+		activePane:     PaneWorkspace,
+		trashRetention: cfg.TrashRetention,
+	}
+	if m.trashRetention <= 0 {
+		m.trashRetention = repository.DefaultTrashRetention
 	}
 
 	// Initialize database
@@ -97,20 +160,39 @@ func New(cfg Config) Model {
 	}
 
 	m.db = db
-	m.workspaceRepo = repository.NewWorkspaceRepository(db)
-	m.todoRepo = repository.NewTodoRepository(db)
-	m.wal = wal.New(db.DB, wal.Config{})
+	m.applier = repository.NewApplier(db)
+	m.wal = wal.New(db.DB, wal.Config{
+		ApplyFunc: m.applier.Apply,
+		Retention: cfg.Retention,
+	})
+	m.workspaceRepo = repository.NewWorkspaceRepository(db, m.wal)
+	m.todoRepo = repository.NewTodoRepository(db, m.wal)
+	m.historyRepo = repository.NewHistoryRepository(db, m.wal)
+	m.trashRepo = repository.NewTrashRepository(db, m.wal)
+	m.viewRepo = repository.NewSavedViewRepository(db, m.wal)
+	m.tagRepo = repository.NewTagRepository(db, m.wal)
+
+	// Replay operations the last session logged but did not apply
+	recovery, err := m.wal.RunRecovery()
+	if err != nil {
+		m.err = err
+		return m
+	}
+	m.recovery = recovery
 
 	// Run integrity checks
 	ctx := context.Background()
-	if err := m.workspaceRepo.CheckAndRepairIntegrity(ctx); err != nil {
+	wsIssues, err := m.workspaceRepo.CheckAndRepairIntegrity(ctx)
+	if err != nil {
 		m.err = err
 		return m
 	}
-	if err := m.todoRepo.CheckAndRepairIntegrity(ctx); err != nil {
+	todoIssues, err := m.todoRepo.CheckAndRepairIntegrity(ctx)
+	if err != nil {
 		m.err = err
 		return m
 	}
+	m.integrityIssues = append(wsIssues, todoIssues...)
 
 	// Auto-archive completed todos older than 7 days
 	_, _ = m.todoRepo.AutoArchive(ctx, 7*24*time.Hour)
@@ -123,22 +205,51 @@ func (m Model) Init() tea.Cmd {
 	if m.err != nil {
 		return nil
 	}
-	return m.loadWorkspaces()
+
+	cmds := []tea.Cmd{m.loadWorkspaces(), m.waitForWALEvent()}
+	if m.recovery != nil && !m.recovery.Empty() {
+		recovery := m.recovery
+		cmds = append(cmds, func() tea.Msg {
+			return recoveryMsg{recovery}
+		})
+	}
+	if n := len(m.integrityIssues); n > 0 {
+		cmds = append(cmds, func() tea.Msg {
+			return notificationMsg{
+				message: fmt.Sprintf("%s found; run 'lazytodo fsck'", countNoun(n, "integrity problem")),
+				isError: true,
+			}
+		})
+	}
+	return tea.Batch(cmds...)
 }
 
-// loadWorkspaces returns a command to load workspaces
+// loadWorkspaces returns a command to load workspaces and smart views
 func (m Model) loadWorkspaces() tea.Cmd {
 	return func() tea.Msg {
 		workspaces, err := m.workspaceRepo.GetAll(context.Background())
 		if err != nil {
 			return errMsg{err}
 		}
-		return workspacesLoadedMsg{workspaces}
+		views, err := m.viewRepo.GetAll(context.Background())
+		if err != nil {
+			return errMsg{err}
+		}
+		return workspacesLoadedMsg{workspaces, views}
 	}
 }
 
-// loadTodos returns a command to load todos for the selected workspace
+// loadTodos returns a command to load todos for the selected workspace,
+// or the matches of the selected smart view. With the tag browser open it
+// reloads the tags, whose counts change with the todos, and the todos
+// follow.
 func (m Model) loadTodos() tea.Cmd {
+	if m.showTags {
+		return m.loadTags()
+	}
+	if view := m.SelectedView(); view != nil {
+		return m.loadViewTodos(view)
+	}
 	if len(m.workspaces) == 0 || m.selectedWsIndex >= len(m.workspaces) {
 		return nil
 	}
@@ -149,23 +260,61 @@ func (m Model) loadTodos() tea.Cmd {
 		if err != nil {
 			return errMsg{err}
 		}
-		return todosLoadedMsg{todos}
+		return todosLoadedMsg{todos: todos}
+	}
+}
+
+// waitForWALEvent returns a command that delivers the next background
+// WAL flush failure, or the retry that saved the pending changes, as a
+// message
+func (m Model) waitForWALEvent() tea.Cmd {
+	events := m.wal.Events()
+	return func() tea.Msg {
+		ev, ok := <-events
+		if !ok {
+			return nil
+		}
+		return walEventMsg{ev}
+	}
+}
+
+// loadHistory returns a command to load the undo history
+func (m Model) loadHistory() tea.Cmd {
+	return func() tea.Msg {
+		entries, err := m.historyRepo.GetHistory(context.Background(), historyLimit)
+		if err != nil {
+			return errMsg{err}
+		}
+		return historyLoadedMsg{entries}
 	}
 }
 
+// historyLimit is the number of operations shown in the history panel
+const historyLimit = 200
+
 // Message types
 type errMsg struct{ err error }
-type workspacesLoadedMsg struct{ workspaces []*domain.Workspace }
-type todosLoadedMsg struct{ todos []*domain.Todo }
+type walEventMsg struct{ event wal.FlushEvent }
+type workspacesLoadedMsg struct {
+	workspaces []*domain.Workspace
+	views      []*domain.SavedView
+}
+type todosLoadedMsg struct {
+	todos    []*domain.Todo
+	snippets map[string]string // Search snippets of a smart view's matches
+}
+type historyLoadedMsg struct{ entries []*repository.HistoryEntry }
+type recoveryMsg struct{ result *wal.RecoveryResult }
 type notificationMsg struct {
 	message string
 	isError bool
 }
 type clearNotificationMsg struct{}
 
-// SelectedWorkspace returns the currently selected workspace
+// SelectedWorkspace returns the currently selected workspace, or nil
+// while the tag browser is open
 func (m Model) SelectedWorkspace() *domain.Workspace {
-	if len(m.workspaces) == 0 || m.selectedWsIndex >= len(m.workspaces) {
+	if m.showTags || len(m.workspaces) == 0 || m.selectedWsIndex >= len(m.workspaces) {
 		return nil
 	}
 	return m.workspaces[m.selectedWsIndex]
@@ -189,10 +338,65 @@ func (m Model) HasTodos() bool {
 	return len(m.todos) > 0
 }
 
-// Close closes the database connection
+// Close shuts the model down with the default timeout
 func (m *Model) Close() error {
-	if m.db != nil {
-		return m.db.Close()
+	return m.Shutdown(DefaultShutdownTimeout)
+}
+
+// Shutdown flushes pending WAL operations, stops the WAL timers, compacts
+// undo history past the retention policy and closes the database. It
+// gives up on the flush after timeout rather than hang on a stuck write,
+// and skips compaction then. The database is closed either way.
+func (m *Model) Shutdown(timeout time.Duration) error {
+	if m.db == nil {
+		return nil
+	}
+
+	var errs []error
+	if m.wal != nil {
+		err := within(timeout, m.wal.Close)
+		switch {
+		case errors.Is(err, errTimedOut):
+			errs = append(errs, fmt.Errorf("shutdown timed out after %s", timeout))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to flush WAL: %w", err))
+		}
+
+		// Compacting can wait for the next shutdown, so it has a bound of
+		// its own and a timeout is not an error
+		if err == nil {
+			err := within(compactionTimeout, func() error {
+				_, err := m.wal.Compact()
+				return err
+			})
+			if err != nil && !errors.Is(err, errTimedOut) {
+				errs = append(errs, fmt.Errorf("failed to compact WAL: %w", err))
+			}
+		}
+	}
+
+	if err := m.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// errTimedOut is returned by within when fn did not return in time
+var errTimedOut = errors.New("timed out")
+
+// within runs fn and returns its error, or errTimedOut if it has not
+// returned after d. fn keeps running in the background then.
+func within(d time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return errTimedOut
 	}
-	return nil
 }
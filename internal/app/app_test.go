@@ -0,0 +1,50 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// newTestModel opens the app on a database in a temporary directory
+func newTestModel(t *testing.T) Model {
+	t.Helper()
+	m := New(Config{DBPath: filepath.Join(t.TempDir(), "lazytodo.db")})
+	if m.err != nil {
+		t.Fatal(m.err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestShutdownClosesTheDatabaseWhenTheFlushHangs(t *testing.T) {
+	m := newTestModel(t)
+
+	// A write that does not return until the test ends
+	if err := m.wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+	m.wal = wal.New(m.db.DB, wal.Config{
+		DebounceInterval: time.Hour,
+		ApplyFunc: func([]*wal.Operation) error {
+			<-stuck
+			return nil
+		},
+	})
+	if err := m.wal.Append(&wal.Operation{OperationType: wal.OpUpdate, EntityType: wal.EntityTodo, EntityID: "milk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Shutdown(50 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("shutdown returned %v, want a timeout", err)
+	}
+	if err := m.db.Ping(); err == nil {
+		t.Error("the database is still open")
+	}
+}
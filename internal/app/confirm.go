@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// Deleting a workspace takes its sub-workspaces and all their todos to
+// the trash, so dd on a workspace first asks, with the counts.
+
+// workspaceDeletion is a workspace delete waiting for confirmation
+type workspaceDeletion struct {
+	workspace  *domain.Workspace
+	workspaces int // Sub-workspaces deleted with it
+	todos      int
+}
+
+// deleteImpactMsg delivers what deleting a workspace would remove
+type deleteImpactMsg struct{ deletion workspaceDeletion }
+
+// confirmDeleteWorkspace returns a command that counts what deleting the
+// selected workspace would remove, to ask before deleting it
+func (m Model) confirmDeleteWorkspace() tea.Cmd {
+	ws := m.SelectedWorkspace()
+	if ws == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		workspaces, todos, err := m.workspaceRepo.DeleteImpact(context.Background(), ws.ID)
+		if err != nil {
+			return errMsg{err}
+		}
+		return deleteImpactMsg{workspaceDeletion{workspace: ws, workspaces: workspaces, todos: todos}}
+	}
+}
+
+// handleConfirmKeys handles keys while a delete waits for confirmation
+func (m Model) handleConfirmKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	d := m.confirmDelete
+	switch msg.String() {
+	case "y", "enter":
+		m.confirmDelete = nil
+		return m, m.deleteWorkspace(d.workspace)
+	case "n", "esc", "q":
+		m.confirmDelete = nil
+		m.notification = "Delete cancelled"
+		m.notificationErr = false
+		return m, nil
+	}
+	return m, nil
+}
+
+// describe states what the delete removes, for the dialog
+func (d workspaceDeletion) describe() string {
+	const restore = "restoring it from the trash (t) brings them back."
+	switch {
+	case d.workspaces == 0 && d.todos == 0:
+		return "It is empty. It can be restored from the trash (t)."
+	case d.workspaces == 0:
+		return fmt.Sprintf("Its %s will go to the trash with it; %s", countNoun(d.todos, "todo"), restore)
+	}
+	return fmt.Sprintf("Its %s and %s will go to the trash with it; %s",
+		countNoun(d.workspaces, "sub-workspace"), countNoun(d.todos, "todo"), restore)
+}
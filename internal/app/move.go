@@ -0,0 +1,222 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// workspacePicker is the state of the "move to workspace" picker
+type workspacePicker struct {
+	todo       *domain.Todo
+	query      string
+	candidates []pickerCandidate
+	matches    []pickerCandidate
+	selected   int
+}
+
+// pickerCandidate is a workspace the picker offers, with its path
+type pickerCandidate struct {
+	workspace *domain.Workspace
+	path      []string
+}
+
+// todoMovedMsg reports a todo moved under parentName in workspace, or to
+// the top level when parentName is empty
+type todoMovedMsg struct {
+	todo       *domain.Todo
+	workspace  *domain.Workspace
+	parentName string
+}
+
+// openWorkspacePicker opens the picker for moving the selected todo to
+// another workspace
+func (m Model) openWorkspacePicker() Model {
+	todo := m.SelectedTodo()
+	if todo == nil {
+		return m
+	}
+
+	byID := make(map[string]*domain.Workspace, len(m.workspaces))
+	for _, ws := range m.workspaces {
+		byID[ws.ID] = ws
+	}
+
+	var candidates []pickerCandidate
+	for _, ws := range m.workspaces {
+		if ws.ID == todo.WorkspaceID {
+			continue
+		}
+		var path []string
+		for w := ws; w != nil; w = byID[w.ParentID] {
+			path = append([]string{w.Name}, path...)
+		}
+		candidates = append(candidates, pickerCandidate{workspace: ws, path: path})
+	}
+
+	m.picker = workspacePicker{todo: todo, candidates: candidates}
+	m.picker.filter()
+	m.showPicker = true
+	return m
+}
+
+// filter keeps the candidates matching the query, best match first
+func (p *workspacePicker) filter() {
+	type scored struct {
+		candidate pickerCandidate
+		score     int
+	}
+
+	var found []scored
+	for _, c := range p.candidates {
+		if score, ok := fuzzyScore(p.query, strings.Join(c.path, " › ")); ok {
+			found = append(found, scored{c, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score > found[j].score
+	})
+
+	p.matches = make([]pickerCandidate, len(found))
+	for i, f := range found {
+		p.matches[i] = f.candidate
+	}
+	p.selected = 0
+}
+
+// fuzzyScore reports whether the runes of query appear in text in order,
+// ignoring case, and scores the match. Runes right after the previous
+// match or at the start of a word score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	score, next, last := 0, 0, -2
+	for i, r := range t {
+		if next == len(q) {
+			break
+		}
+		if r != q[next] {
+			continue
+		}
+
+		switch {
+		case i == last+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]):
+			score += 2
+		default:
+			score++
+		}
+		last = i
+		next++
+	}
+
+	return score, next == len(q)
+}
+
+// handlePickerKeys handles keys while the workspace picker is open. Keys
+// that type text go to the query, so selection uses arrows and ctrl keys.
+func (m Model) handlePickerKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.showPicker = false
+		return m, nil
+	case "down", "ctrl+j", "ctrl+n":
+		if m.picker.selected < len(m.picker.matches)-1 {
+			m.picker.selected++
+		}
+		return m, nil
+	case "up", "ctrl+k", "ctrl+p":
+		if m.picker.selected > 0 {
+			m.picker.selected--
+		}
+		return m, nil
+	case "enter":
+		if m.picker.selected >= len(m.picker.matches) {
+			return m, nil
+		}
+		m.showPicker = false
+		ws := m.picker.matches[m.picker.selected].workspace
+		return m, m.moveTodo(m.picker.todo, ws, nil)
+	case "backspace":
+		if r := []rune(m.picker.query); len(r) > 0 {
+			m.picker.query = string(r[:len(r)-1])
+			m.picker.filter()
+		}
+		return m, nil
+	}
+
+	if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+		m.picker.query += string(msg.Runes)
+		m.picker.filter()
+	}
+	return m, nil
+}
+
+// cutTodo marks the selected todo to be pasted elsewhere, or clears the
+// mark when it is already cut
+func (m Model) cutTodo() Model {
+	todo := m.SelectedTodo()
+	if todo == nil {
+		return m
+	}
+
+	if m.cut != nil && m.cut.ID == todo.ID {
+		m.cut = nil
+		m.notification = "Cut cancelled"
+		m.notificationErr = false
+		return m
+	}
+
+	m.cut = todo
+	m.notification = fmt.Sprintf("Cut '%s': p pastes under the selected todo, P at top level", todo.Description)
+	m.notificationErr = false
+	return m
+}
+
+// pasteTodo moves the cut todo into the selected workspace, under the
+// selected todo unless topLevel is set
+func (m Model) pasteTodo(topLevel bool) tea.Cmd {
+	ws := m.SelectedWorkspace()
+	if m.cut == nil || ws == nil {
+		return nil
+	}
+
+	var parent *domain.Todo
+	if !topLevel && m.activePane == PaneTodo {
+		parent = m.SelectedTodo()
+	}
+	return m.moveTodo(m.cut, ws, parent)
+}
+
+// moveTodo moves todo and its subtasks under parent in ws, or to the top
+// level of ws when parent is nil
+func (m Model) moveTodo(todo *domain.Todo, ws *domain.Workspace, parent *domain.Todo) tea.Cmd {
+	return func() tea.Msg {
+		ctx := newActionContext()
+
+		parentID, parentName := "", ""
+		if parent != nil {
+			parentID, parentName = parent.ID, parent.Description
+		}
+		if err := m.todoRepo.Move(ctx, todo.ID, parentID, ws.ID); err != nil {
+			return errMsg{err}
+		}
+
+		return todoMovedMsg{todo: todo, workspace: ws, parentName: parentName}
+	}
+}
+
+// describeMove summarizes a move for the status bar
+func describeMove(msg todoMovedMsg) string {
+	if msg.parentName != "" {
+		return fmt.Sprintf("Moved '%s' under '%s'", msg.todo.Description, msg.parentName)
+	}
+	return fmt.Sprintf("Moved '%s' to %s", msg.todo.Description, msg.workspace.Name)
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/input"
+)
+
+// The tag browser lists every tag in place of the workspaces. Selecting a
+// tag shows the todos that have it, or a tag under it, from every
+// workspace, each with the path of its workspace. Like a smart view it
+// holds no todos of its own, so nothing can be added, pasted or
+// rearranged while it is open.
+
+// tagsLoadedMsg delivers the tags for the browser
+type tagsLoadedMsg struct{ tags []*domain.Tag }
+
+// tagRenamedMsg reports a tag renamed in count todos
+type tagRenamedMsg struct {
+	from, to string
+	count    int
+}
+
+// SelectedTag returns the tag selected in the tag browser, or nil when
+// the browser is closed
+func (m Model) SelectedTag() *domain.Tag {
+	if !m.showTags || m.selectedTagIndex >= len(m.tags) {
+		return nil
+	}
+	return m.tags[m.selectedTagIndex]
+}
+
+// toggleTags switches the left pane between the workspaces and the tags
+func (m Model) toggleTags() (Model, tea.Cmd) {
+	m.showTags = !m.showTags
+	m.activePane = PaneWorkspace
+	if !m.showTags {
+		return m, m.loadTodos()
+	}
+	return m, m.loadTags()
+}
+
+// loadTags returns a command that loads the tags for the browser
+func (m Model) loadTags() tea.Cmd {
+	return func() tea.Msg {
+		tags, err := m.tagRepo.GetAll(context.Background())
+		if err != nil {
+			return errMsg{err}
+		}
+		return tagsLoadedMsg{tags}
+	}
+}
+
+// loadTagTodos returns a command that loads the todos with tag or a tag
+// under it, from every workspace
+func (m Model) loadTagTodos(tag *domain.Tag) tea.Cmd {
+	return func() tea.Msg {
+		results, err := m.todoRepo.Search(context.Background(), "tag:"+tag.Name, false)
+		if err != nil {
+			return errMsg{fmt.Errorf("tag '@%s': %w", tag.Name, err)}
+		}
+
+		msg := todosLoadedMsg{todos: make([]*domain.Todo, len(results))}
+		for i, r := range results {
+			msg.todos[i] = r.Todo
+		}
+		return msg
+	}
+}
+
+// startRenameTag asks for a new name for the selected tag
+func (m Model) startRenameTag() Model {
+	tag := m.SelectedTag()
+	if tag == nil {
+		return m
+	}
+	m.mode = input.ModeInsert
+	m.inputPrompt = "Rename tag: "
+	m.inputAction = "rename_tag"
+	m.inputBuffer = tag.Name
+	return m
+}
+
+// renameTag renames the selected tag in every todo. Renaming it to a tag
+// that exists merges the two.
+func (m Model) renameTag(name string) tea.Cmd {
+	tag := m.SelectedTag()
+	if tag == nil {
+		return nil
+	}
+	to := strings.TrimPrefix(strings.TrimSpace(name), "@")
+	return func() tea.Msg {
+		count, err := m.tagRepo.Rename(newActionContext(), tag.Name, to)
+		if err != nil {
+			return errMsg{err}
+		}
+		return tagRenamedMsg{from: tag.Name, to: to, count: count}
+	}
+}
+
+// workspacePaths returns the path of every workspace by ID, outermost
+// name first
+func (m Model) workspacePaths() map[string]string {
+	byID := make(map[string]*domain.Workspace, len(m.workspaces))
+	for _, ws := range m.workspaces {
+		byID[ws.ID] = ws
+	}
+
+	paths := make(map[string]string, len(m.workspaces))
+	for _, ws := range m.workspaces {
+		var path []string
+		for w := ws; w != nil; w = byID[w.ParentID] {
+			path = append([]string{w.Name}, path...)
+		}
+		paths[ws.ID] = strings.Join(path, " › ")
+	}
+	return paths
+}
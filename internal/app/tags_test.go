@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// send feeds msgs to the model one by one, each followed by the messages
+// of the commands it returns, leaving out commands that wait, like timers
+// and WAL events
+func (m Model) send(t *testing.T, msgs ...tea.Msg) Model {
+	t.Helper()
+	for _, msg := range msgs {
+		queue := []tea.Msg{msg}
+		for i := 0; len(queue) > 0; i++ {
+			if i > 100 {
+				t.Fatal("the model keeps sending messages")
+			}
+			next, cmd := m.Update(queue[0])
+			m = next.(Model)
+			queue = append(queue[1:], run(cmd)...)
+		}
+	}
+	return m
+}
+
+// run returns the messages cmd produces without waiting
+func run(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+
+	select {
+	case msg := <-done:
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			var msgs []tea.Msg
+			for _, c := range batch {
+				msgs = append(msgs, run(c)...)
+			}
+			return msgs
+		}
+		if msg == nil {
+			return nil
+		}
+		return []tea.Msg{msg}
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	}
+}
+
+// key returns the message for typing s
+func key(s string) tea.Msg {
+	switch s {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "backspace":
+		return tea.KeyMsg{Type: tea.KeyBackspace}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+// addTodo stores a pending todo in the workspace
+func (m Model) addTodo(t *testing.T, ws *domain.Workspace, description string) *domain.Todo {
+	t.Helper()
+	todo := &domain.Todo{
+		WorkspaceID: ws.ID,
+		Description: description,
+		Status:      domain.StatusPending,
+		Urgency:     domain.UrgencyLow,
+	}
+	if err := m.todoRepo.Create(context.Background(), todo); err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+// addWorkspace stores a workspace under parentID
+func (m Model) addWorkspace(t *testing.T, name, parentID string) *domain.Workspace {
+	t.Helper()
+	ws := &domain.Workspace{Name: name, ParentID: parentID}
+	if err := m.workspaceRepo.Create(context.Background(), ws); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// errandTodos stores todos tagged @errand in several workspaces, some of
+// them completed, archived, trashed or in a deleted workspace
+func (m Model) errandTodos(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	home := m.addWorkspace(t, "Home", "")
+	work := m.addWorkspace(t, "Work", "")
+	office := m.addWorkspace(t, "Office", work.ID)
+	old := m.addWorkspace(t, "Old flat", "")
+
+	m.addTodo(t, home, "Buy milk @errand")
+	m.addTodo(t, office, "Print the slides @errand/office")
+	posted := m.addTodo(t, home, "Post the letter @errand")
+	posted.Status = domain.StatusCompleted
+	if err := m.todoRepo.Update(ctx, posted); err != nil {
+		t.Fatal(err)
+	}
+	archived := m.addTodo(t, home, "Return the books @errand")
+	if err := m.todoRepo.Archive(ctx, archived.ID); err != nil {
+		t.Fatal(err)
+	}
+	trashed := m.addTodo(t, work, "Buy toner @errand/office")
+	if err := m.todoRepo.Delete(ctx, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	m.addTodo(t, old, "Hand in the keys @errand @moving")
+	if err := m.workspaceRepo.Delete(ctx, old.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// descriptions returns the descriptions of the todos on show, sorted
+func (m Model) descriptions() []string {
+	var got []string
+	for _, todo := range m.todos {
+		got = append(got, todo.Description)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestTagBrowserCounts(t *testing.T) {
+	m := newTestModel(t)
+	m.errandTodos(t)
+
+	m = m.send(t, key("#"))
+	want := []*domain.Tag{
+		{Name: "errand", Pending: 2, Completed: 1},
+		{Name: "errand/office", Pending: 1},
+	}
+	if !reflect.DeepEqual(m.tags, want) {
+		t.Errorf("browser lists %+v, want %+v", m.tags, want)
+	}
+	stored, err := m.tagRepo.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.tags, stored) {
+		t.Errorf("browser lists %+v, the repository %+v", m.tags, stored)
+	}
+}
+
+func TestTagBrowserShowsTodosFromEveryWorkspace(t *testing.T) {
+	m := newTestModel(t)
+	m.errandTodos(t)
+
+	m = m.send(t, m.loadWorkspaces()(), key("#"))
+	if tag := m.SelectedTag(); tag == nil || tag.Name != "errand" {
+		t.Fatalf("selected %+v, want @errand", tag)
+	}
+	want := []string{"Buy milk @errand", "Post the letter @errand", "Print the slides @errand/office"}
+	if got := m.descriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("@errand shows %q, want %q", got, want)
+	}
+
+	m = m.send(t, key("j"))
+	want = []string{"Print the slides @errand/office"}
+	if got := m.descriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("@errand/office shows %q, want %q", got, want)
+	}
+	if path := m.workspacePaths()[m.todos[0].WorkspaceID]; path != "Work › Office" {
+		t.Errorf("the todo is shown in %q, want Work › Office", path)
+	}
+}
+
+func TestRenamingATagRefreshesTheBrowser(t *testing.T) {
+	m := newTestModel(t)
+	m.errandTodos(t)
+
+	m = m.send(t, key("#"), key("i"))
+	for range "errand" {
+		m = m.send(t, key("backspace"))
+	}
+	m = m.send(t, key("chores"), key("enter"))
+
+	var names []string
+	for _, tag := range m.tags {
+		names = append(names, tag.Name)
+	}
+	if want := []string{"chores", "chores/office"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("browser lists %q after the rename, want %q", names, want)
+	}
+	if tag := m.SelectedTag(); tag == nil || tag.Name != "chores" {
+		t.Errorf("selected %+v after the rename, want @chores", tag)
+	}
+	want := []string{"Buy milk @chores", "Post the letter @chores", "Print the slides @chores/office"}
+	if got := m.descriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("@chores shows %q, want %q", got, want)
+	}
+}
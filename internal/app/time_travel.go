@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/input"
+)
+
+// timeTravelView is a read-only copy of a workspace as it was in the past
+type timeTravelView struct {
+	at            time.Time
+	workspace     *domain.Workspace
+	todos         []*domain.Todo
+	selectedIndex int
+}
+
+type timeTravelLoadedMsg struct{ view timeTravelView }
+
+// timeTravelHint is shown while the time-travel view is open
+const timeTravelHint = "[/]: previous/next day  Esc: back to present"
+
+// loadTimeTravel returns a command that rebuilds a workspace as of at
+func (m Model) loadTimeTravel(workspaceID string, at time.Time) tea.Cmd {
+	return func() tea.Msg {
+		ws, todos, err := m.historyRepo.WorkspaceAt(context.Background(), workspaceID, at)
+		if err != nil {
+			return errMsg{err}
+		}
+		return timeTravelLoadedMsg{timeTravelView{at: at, workspace: ws, todos: todos}}
+	}
+}
+
+// startTimeTravel opens the time-travel view from the prompt input
+func (m Model) startTimeTravel(value string) tea.Cmd {
+	ws := m.SelectedWorkspace()
+	if ws == nil {
+		return nil
+	}
+
+	at, err := parseAsOf(value, time.Now())
+	if err != nil {
+		return func() tea.Msg {
+			return errMsg{err}
+		}
+	}
+
+	return m.loadTimeTravel(ws.ID, at)
+}
+
+// handleTimeTravelMode handles keys in the read-only time-travel view
+func (m Model) handleTimeTravelMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "T":
+		m.mode = input.ModeNormal
+		m.timeTravel = timeTravelView{}
+		m.notification = ""
+		return m, nil
+	case "j", "down":
+		if m.timeTravel.selectedIndex < len(m.timeTravel.todos)-1 {
+			m.timeTravel.selectedIndex++
+		}
+		return m, nil
+	case "k", "up":
+		if m.timeTravel.selectedIndex > 0 {
+			m.timeTravel.selectedIndex--
+		}
+		return m, nil
+	case "g":
+		m.timeTravel.selectedIndex = 0
+		return m, nil
+	case "G":
+		if len(m.timeTravel.todos) > 0 {
+			m.timeTravel.selectedIndex = len(m.timeTravel.todos) - 1
+		}
+		return m, nil
+	case "[":
+		return m, m.loadTimeTravel(m.timeTravel.workspace.ID, m.timeTravel.at.AddDate(0, 0, -1))
+	case "]":
+		next := m.timeTravel.at.AddDate(0, 0, 1)
+		if now := time.Now(); next.After(now) {
+			next = now
+		}
+		return m, m.loadTimeTravel(m.timeTravel.workspace.ID, next)
+	case "?":
+		m.showHelp = !m.showHelp
+		return m, nil
+	}
+
+	// Everything else would edit; the past is read-only
+	return m, nil
+}
+
+// parseAsOf parses the time-travel prompt. It accepts "2006-01-02 15:04",
+// "2006-01-02", "15:04", "yesterday", weekday names ("monday" or
+// "last monday") and amounts of time ago such as "90m", "3d" or "2w".
+// A day without a time means the end of that day.
+func parseAsOf(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "last ")
+	loc := now.Location()
+
+	endOfDay := func(t time.Time) time.Time {
+		y, mo, d := t.Date()
+		return time.Date(y, mo, d, 23, 59, 59, 0, loc)
+	}
+
+	switch s {
+	case "now", "today":
+		return now, nil
+	case "yesterday":
+		return endOfDay(now.AddDate(0, 0, -1)), nil
+	}
+
+	// Most recent past weekday, never today
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] {
+			days := (int(now.Weekday()) - int(wd) + 7) % 7
+			if days == 0 {
+				days = 7
+			}
+			return endOfDay(now.AddDate(0, 0, -days)), nil
+		}
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return endOfDay(t), nil
+	}
+	if t, err := time.ParseInLocation("15:04", s, loc); err == nil {
+		y, mo, d := now.Date()
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	}
+
+	// Amount of time ago
+	if n := len(s); n >= 2 {
+		if v, err := strconv.Atoi(s[:n-1]); err == nil && v >= 0 {
+			switch s[n-1] {
+			case 'm':
+				return now.Add(-time.Duration(v) * time.Minute), nil
+			case 'h':
+				return now.Add(-time.Duration(v) * time.Hour), nil
+			case 'd':
+				return now.AddDate(0, 0, -v), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*v), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: cannot read %q as a time", domain.ErrInvalidOperation, s)
+}
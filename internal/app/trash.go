@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/repository"
+)
+
+type trashLoadedMsg struct{ entries []*repository.TrashEntry }
+type trashRestoredMsg struct{ entry *repository.TrashEntry }
+type trashPurgedMsg struct{ result *repository.PurgeResult }
+
+// loadTrash returns a command to load the trash entries
+func (m Model) loadTrash() tea.Cmd {
+	return func() tea.Msg {
+		entries, err := m.trashRepo.List(context.Background())
+		if err != nil {
+			return errMsg{err}
+		}
+		return trashLoadedMsg{entries}
+	}
+}
+
+// restoreTrash returns a command that restores a trash entry in place
+func (m Model) restoreTrash(entry *repository.TrashEntry) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.trashRepo.Restore(newActionContext(), entry); err != nil {
+			return errMsg{err}
+		}
+		return trashRestoredMsg{entry}
+	}
+}
+
+// purgeTrash returns a command that permanently deletes entries older
+// than the trash retention
+func (m Model) purgeTrash() tea.Cmd {
+	return func() tea.Msg {
+		result, err := m.trashRepo.Purge(context.Background(), m.trashRetention)
+		if err != nil {
+			return errMsg{err}
+		}
+		return trashPurgedMsg{result}
+	}
+}
+
+// handleTrashKeys handles keys while the trash panel is open
+func (m Model) handleTrashKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+
+	// Handle pending purge (PP)
+	if m.pendingPurge {
+		m.pendingPurge = false
+		m.notification = ""
+		if key == "P" {
+			return m, m.purgeTrash()
+		}
+		return m, nil
+	}
+
+	switch key {
+	case "esc", "q", "t":
+		m.showTrash = false
+		return m, nil
+	case "j", "down":
+		if m.selectedTrashIndex < len(m.trash)-1 {
+			m.selectedTrashIndex++
+		}
+		return m, nil
+	case "k", "up":
+		if m.selectedTrashIndex > 0 {
+			m.selectedTrashIndex--
+		}
+		return m, nil
+	case "g":
+		m.selectedTrashIndex = 0
+		return m, nil
+	case "G":
+		if len(m.trash) > 0 {
+			m.selectedTrashIndex = len(m.trash) - 1
+		}
+		return m, nil
+	case "enter", "r":
+		if m.selectedTrashIndex < len(m.trash) {
+			return m, m.restoreTrash(m.trash[m.selectedTrashIndex])
+		}
+		return m, nil
+	case "P":
+		// Start purge sequence
+		m.pendingPurge = true
+		m.notification = fmt.Sprintf("Press P again to delete items older than %d days for good", int(m.trashRetention.Hours()/24))
+		m.notificationErr = false
+		return m, nil
+	}
+
+	return m, nil
+}
+
+// describePurge summarizes a purge for the status bar
+func describePurge(r *repository.PurgeResult) string {
+	if r.Todos == 0 && r.Workspaces == 0 {
+		return "Nothing old enough to purge"
+	}
+	return fmt.Sprintf("Purged %s and %s", countNoun(r.Todos, "todo"), countNoun(r.Workspaces, "workspace"))
+}
+
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -2,12 +2,16 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/yuichikadota/lazytodo/internal/domain"
 	"github.com/yuichikadota/lazytodo/internal/input"
+	"github.com/yuichikadota/lazytodo/internal/query"
+	"github.com/yuichikadota/lazytodo/internal/repository"
 	"github.com/yuichikadota/lazytodo/internal/wal"
 )
 
@@ -31,22 +35,131 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case workspacesLoadedMsg:
+		// Keep the selection on the same workspace or view as it moves
+		id := m.selectWorkspaceID
+		if ws := m.SelectedWorkspace(); id == "" && ws != nil {
+			id = ws.ID
+		}
+		if view := m.SelectedView(); id == "" && view != nil {
+			id = view.ID
+		}
+		m.selectWorkspaceID = ""
 		m.workspaces = msg.workspaces
-		if len(m.workspaces) > 0 {
+		m.views = msg.views
+		for i, ws := range m.workspaces {
+			if ws.ID == id {
+				m.selectedWsIndex = i
+			}
+		}
+		for i, view := range m.views {
+			if view.ID == id {
+				m.selectedWsIndex = len(m.workspaces) + i
+			}
+		}
+		// Undo can remove the selected workspace
+		if m.selectedWsIndex >= m.workspacePaneRows() && m.workspacePaneRows() > 0 {
+			m.selectedWsIndex = m.workspacePaneRows() - 1
+		}
+		if m.workspacePaneRows() > 0 {
 			return m, m.loadTodos()
 		}
 		return m, nil
 
 	case todosLoadedMsg:
+		// Keep the selection on the same todo as it moves
+		id := m.selectTodoID
+		if todo := m.SelectedTodo(); id == "" && todo != nil {
+			id = todo.ID
+		}
+		m.selectTodoID = ""
 		m.todos = msg.todos
+		m.searchSnippets = msg.snippets
 		m.selectedTodoIndex = 0
+		for i, todo := range m.todos {
+			if todo.ID == id {
+				m.selectedTodoIndex = i
+			}
+		}
+		return m, nil
+
+	case tagsLoadedMsg:
+		// Keep the selection on the same tag as the counts change
+		name := m.selectTag
+		if tag := m.SelectedTag(); name == "" && tag != nil {
+			name = tag.Name
+		}
+		m.selectTag = ""
+		m.tags = msg.tags
+		for i, tag := range m.tags {
+			if tag.Name == name {
+				m.selectedTagIndex = i
+			}
+		}
+		if m.selectedTagIndex >= len(m.tags) {
+			m.selectedTagIndex = max(len(m.tags)-1, 0)
+		}
+		if tag := m.SelectedTag(); tag != nil {
+			return m, m.loadTagTodos(tag)
+		}
+		m.todos = nil
 		return m, nil
 
+	case tagRenamedMsg:
+		m.notification = fmt.Sprintf("Renamed @%s to @%s in %s", msg.from, msg.to, countNoun(msg.count, "todo"))
+		m.notificationErr = false
+		m.selectTag = msg.to
+		return m, tea.Batch(m.loadTags(), clearNotificationAfter(2*time.Second))
+
 	case errMsg:
+		if errors.Is(msg.err, domain.ErrWritePending) {
+			// Retried in the background; walEventMsg tells how it ends
+			m.notification = "Saving changes, retrying..."
+			m.notificationErr = false
+			return m, nil
+		}
 		m.notification = msg.err.Error()
 		m.notificationErr = true
 		return m, nil
 
+	case walEventMsg:
+		// Keep listening for further events
+		next := m.waitForWALEvent()
+		switch fe := msg.event.Err; {
+		case fe == nil:
+			m.notification = fmt.Sprintf("Saved %d pending changes", msg.event.Saved)
+			m.notificationErr = false
+			return m, tea.Batch(next, m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
+		case fe.RetryIn > 0:
+			m.notification = fmt.Sprintf("Saving %d changes, retrying in %s...", fe.Pending, fe.RetryIn)
+			m.notificationErr = false
+			return m, next
+		case fe.Discarded:
+			m.notification = fmt.Sprintf("%d changes could not be saved and were discarded: %v", fe.Pending, fe.Err)
+		default:
+			m.notification = fe.Error()
+		}
+		m.notificationErr = true
+		return m, tea.Batch(next, m.loadWorkspaces())
+
+	case timeTravelLoadedMsg:
+		index := m.timeTravel.selectedIndex
+		m.timeTravel = msg.view
+		if index < len(m.timeTravel.todos) {
+			m.timeTravel.selectedIndex = index
+		}
+		m.mode = input.ModeTimeTravel
+		m.notification = timeTravelHint
+		m.notificationErr = false
+		return m, nil
+
+	case recoveryMsg:
+		m.notification = msg.result.String()
+		m.notificationErr = len(msg.result.Errors) > 0
+		if !m.notificationErr {
+			return m, clearNotificationAfter(5 * time.Second)
+		}
+		return m, nil
+
 	case notificationMsg:
 		m.notification = msg.message
 		m.notificationErr = msg.isError
@@ -63,6 +176,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Todo CRUD responses
 	case todoCreatedMsg:
+		m.selectTodoID = msg.todo.ID
 		m.notification = "Todo created"
 		m.notificationErr = false
 		return m, tea.Batch(m.loadTodos(), clearNotificationAfter(2*time.Second))
@@ -72,6 +186,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.notificationErr = false
 		return m, tea.Batch(m.loadTodos(), clearNotificationAfter(2*time.Second))
 
+	case todoMovedMsg:
+		if m.cut != nil && m.cut.ID == msg.todo.ID {
+			m.cut = nil
+		}
+		m.selectTodoID = msg.todo.ID
+		m.notification = describeMove(msg)
+		m.notificationErr = false
+		return m, tea.Batch(m.loadTodos(), clearNotificationAfter(2*time.Second))
+
 	case todoDeletedMsg:
 		m.notification = "Todo deleted"
 		m.notificationErr = false
@@ -83,6 +206,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Workspace CRUD responses
 	case workspaceCreatedMsg:
+		m.selectWorkspaceID = msg.workspace.ID
 		m.notification = "Workspace created"
 		m.notificationErr = false
 		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
@@ -92,6 +216,27 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.notificationErr = false
 		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
 
+	case viewSavedMsg:
+		m.notification = fmt.Sprintf("Saved view '%s'", msg.view.Name)
+		m.notificationErr = false
+		m.searchResults = nil
+		m.selectWorkspaceID = msg.view.ID
+		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
+
+	case viewRenamedMsg:
+		m.notification = fmt.Sprintf("Renamed view to '%s'", msg.name)
+		m.notificationErr = false
+		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
+
+	case viewDeletedMsg:
+		m.notification = fmt.Sprintf("Deleted view '%s'", msg.name)
+		m.notificationErr = false
+		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
+
+	case deleteImpactMsg:
+		m.confirmDelete = &msg.deletion
+		return m, nil
+
 	case workspaceDeletedMsg:
 		m.notification = "Workspace deleted"
 		m.notificationErr = false
@@ -102,14 +247,71 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
 
 	case undoMsg:
-		m.notification = "Undone"
+		m.notification = "Undone: " + describeGroup(msg.operations)
+		m.notificationErr = false
+		// Reload all data
+		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
+
+	case redoMsg:
+		m.notification = "Redone: " + describeGroup(msg.operations)
 		m.notificationErr = false
 		// Reload all data
 		return m, tea.Batch(m.loadWorkspaces(), clearNotificationAfter(2*time.Second))
 
+	case historyLoadedMsg:
+		m.history = msg.entries
+		if m.selectedHistoryIndex >= len(m.history) {
+			m.selectedHistoryIndex = 0
+		}
+		return m, nil
+
+	case trashLoadedMsg:
+		m.trash = msg.entries
+		if m.selectedTrashIndex >= len(m.trash) && len(m.trash) > 0 {
+			m.selectedTrashIndex = len(m.trash) - 1
+		}
+		return m, nil
+
+	case trashRestoredMsg:
+		m.notification = fmt.Sprintf("Restored '%s'", msg.entry.Name)
+		m.notificationErr = false
+		return m, tea.Batch(m.loadWorkspaces(), m.loadTrash(), clearNotificationAfter(2*time.Second))
+
+	case trashPurgedMsg:
+		m.notification = describePurge(msg.result)
+		m.notificationErr = false
+		return m, tea.Batch(m.loadTrash(), clearNotificationAfter(2*time.Second))
+
+	case historyJumpedMsg:
+		switch {
+		case msg.undone > 0:
+			m.notification = fmt.Sprintf("Jumped back %d steps", msg.undone)
+		case msg.redone > 0:
+			m.notification = fmt.Sprintf("Jumped forward %d steps", msg.redone)
+		default:
+			m.notification = "Already at this point"
+		}
+		m.notificationErr = false
+		return m, tea.Batch(m.loadWorkspaces(), m.loadHistory(), clearNotificationAfter(2*time.Second))
+
 	case searchResultsMsg:
-		m.searchResults = msg.todos
-		m.todos = msg.todos
+		// Results for an earlier keystroke may arrive late
+		if m.mode != input.ModeSearch || msg.query != m.inputBuffer || msg.includeArchived != m.searchArchived {
+			return m, nil
+		}
+		// Keep the last results while the query cannot be read
+		if msg.err != nil {
+			m.searchError = msg.err.Error()
+			return m, nil
+		}
+		m.searchError = ""
+		m.searchResults = make([]*domain.Todo, len(msg.results))
+		m.searchSnippets = make(map[string]string, len(msg.results))
+		for i, r := range msg.results {
+			m.searchResults[i] = r.Todo
+			m.searchSnippets[r.Todo.ID] = r.Snippet
+		}
+		m.todos = m.searchResults
 		m.selectedTodoIndex = 0
 		return m, nil
 
@@ -135,6 +337,26 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, tea.Quit
 	}
 
+	// History panel captures keys while open
+	if m.showHistory {
+		return m.handleHistoryKeys(msg)
+	}
+
+	// Trash panel captures keys while open
+	if m.showTrash {
+		return m.handleTrashKeys(msg)
+	}
+
+	// Workspace picker captures keys while open
+	if m.showPicker {
+		return m.handlePickerKeys(msg)
+	}
+
+	// A delete waiting for confirmation captures keys
+	if m.confirmDelete != nil {
+		return m.handleConfirmKeys(msg)
+	}
+
 	// Mode-specific handling
 	switch m.mode {
 	case input.ModeNormal:
@@ -145,6 +367,8 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleSearchMode(msg)
 	case input.ModeSort:
 		return m.handleSortMode(msg)
+	case input.ModeTimeTravel:
+		return m.handleTimeTravelMode(msg)
 	}
 
 	return m, nil
@@ -162,7 +386,9 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if m.activePane == PaneTodo && m.SelectedTodo() != nil {
 				return m, m.deleteTodo()
 			} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
-				return m, m.deleteWorkspace()
+				return m, m.confirmDeleteWorkspace()
+			} else if m.activePane == PaneWorkspace && m.SelectedView() != nil {
+				return m, m.deleteView()
 			}
 		}
 		// Cancel delete
@@ -175,9 +401,9 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	// Navigation
 	case "j", "down":
-		return m.moveDown(), nil
+		return m.navigate(m.moveDown())
 	case "k", "up":
-		return m.moveUp(), nil
+		return m.navigate(m.moveUp())
 	case "h":
 		m.activePane = PaneWorkspace
 		return m, nil
@@ -192,9 +418,9 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 	case "g":
-		return m.moveToFirst(), nil
+		return m.navigate(m.moveToFirst())
 	case "G":
-		return m.moveToLast(), nil
+		return m.navigate(m.moveToLast())
 
 	// Actions
 	case "i":
@@ -209,10 +435,21 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.inputPrompt = "Edit: "
 			m.inputAction = "edit"
 			m.inputBuffer = m.SelectedWorkspace().Name
+		} else if m.activePane == PaneWorkspace && m.SelectedView() != nil {
+			m.mode = input.ModeInsert
+			m.inputPrompt = "Rename: "
+			m.inputAction = "edit"
+			m.inputBuffer = m.SelectedView().Name
+		} else if m.activePane == PaneWorkspace && m.SelectedTag() != nil {
+			return m.startRenameTag(), nil
 		}
 		return m, nil
 	case "a":
 		// Add new item
+		if m.activePane == PaneTodo && m.refuseInView("add todos in a workspace") ||
+			m.activePane == PaneWorkspace && m.refuseInView("select a workspace to add one next to it") {
+			return m, nil
+		}
 		m.mode = input.ModeInsert
 		m.inputPrompt = "Add: "
 		m.inputAction = "add"
@@ -220,7 +457,7 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "A":
 		// Add child item (only for todos)
-		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil && !m.refuseInView("add subtasks in a workspace") {
 			m.mode = input.ModeInsert
 			m.inputPrompt = "Add child: "
 			m.inputAction = "add_child"
@@ -245,7 +482,7 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case ">":
 		// Indent (make child of sibling above)
-		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil && !m.refuseInView("indent todos in a workspace") {
 			return m, m.indentTodo()
 		} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
 			return m, m.indentWorkspace()
@@ -253,7 +490,7 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "<":
 		// Outdent (move up one level)
-		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil && !m.refuseInView("outdent todos in a workspace") {
 			return m, m.outdentTodo()
 		} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
 			return m, m.outdentWorkspace()
@@ -261,7 +498,7 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "ctrl+j":
 		// Move item down
-		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil && !m.refuseInView("reorder todos in a workspace") {
 			return m, m.moveTodoDown()
 		} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
 			return m, m.moveWorkspaceDown()
@@ -269,25 +506,81 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "ctrl+k":
 		// Move item up
-		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil && !m.refuseInView("reorder todos in a workspace") {
 			return m, m.moveTodoUp()
 		} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
 			return m, m.moveWorkspaceUp()
 		}
 		return m, nil
 
+	case "m":
+		// Move todo to another workspace
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+			return m.openWorkspacePicker(), nil
+		}
+		return m, nil
+	case "x":
+		// Cut todo to paste it elsewhere
+		if m.activePane == PaneTodo && m.SelectedTodo() != nil {
+			return m.cutTodo(), nil
+		}
+		return m, nil
+	case "p":
+		// Paste under the selected todo
+		if m.cut != nil && m.refuseInView("paste into a workspace") {
+			return m, nil
+		}
+		return m, m.pasteTodo(false)
+	case "P":
+		// Paste at the top level of the selected workspace
+		if m.cut != nil && m.refuseInView("paste into a workspace") {
+			return m, nil
+		}
+		return m, m.pasteTodo(true)
+	case "esc":
+		if m.cut != nil {
+			m.cut = nil
+			m.notification = "Cut cancelled"
+			m.notificationErr = false
+		}
+		return m, nil
+
 	// Undo/Redo
 	case "u":
 		return m, m.undo()
 	case "ctrl+r":
 		return m, m.redo()
+	case "U":
+		// Open undo history
+		m.showHistory = true
+		m.selectedHistoryIndex = 0
+		return m, m.loadHistory()
+	case "t":
+		// Open the trash
+		m.showTrash = true
+		m.selectedTrashIndex = 0
+		return m, m.loadTrash()
+	case "T":
+		// View the selected workspace at a past time
+		if m.SelectedWorkspace() != nil {
+			m.mode = input.ModeInsert
+			m.inputPrompt = "View as of: "
+			m.inputAction = "time_travel"
+			m.inputBuffer = ""
+		}
+		return m, nil
 
 	// Mode switches
 	case "/":
 		m.mode = input.ModeSearch
-		m.inputPrompt = "Search: "
+		m.searchArchived = false
+		m.searchError = ""
+		m.inputPrompt = searchPrompt(m.searchArchived)
 		m.inputBuffer = ""
 		return m, nil
+	case "#":
+		// Browse tags in place of the workspaces
+		return m.toggleTags()
 	case "?":
 		// Toggle help screen
 		m.showHelp = !m.showHelp
@@ -297,6 +590,40 @@ func (m Model) handleNormalMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleHistoryKeys handles keys while the history panel is open
+func (m Model) handleHistoryKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "U":
+		m.showHistory = false
+		return m, nil
+	case "j", "down":
+		if m.selectedHistoryIndex < len(m.history)-1 {
+			m.selectedHistoryIndex++
+		}
+		return m, nil
+	case "k", "up":
+		if m.selectedHistoryIndex > 0 {
+			m.selectedHistoryIndex--
+		}
+		return m, nil
+	case "g":
+		m.selectedHistoryIndex = 0
+		return m, nil
+	case "G":
+		if len(m.history) > 0 {
+			m.selectedHistoryIndex = len(m.history) - 1
+		}
+		return m, nil
+	case "enter":
+		if m.selectedHistoryIndex < len(m.history) {
+			return m, m.jumpToHistory(m.history[m.selectedHistoryIndex])
+		}
+		return m, nil
+	}
+
+	return m, nil
+}
+
 // handleInsertMode handles keys in insert mode
 func (m Model) handleInsertMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
@@ -319,21 +646,39 @@ func (m Model) handleInsertMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		switch m.inputAction {
 		case "add":
+			// New items go right after the selected one, as a sibling
 			if m.activePane == PaneTodo {
-				cmd = m.createTodo(m.inputBuffer, "")
+				if todo := m.SelectedTodo(); todo != nil {
+					cmd = m.createTodo(m.inputBuffer, todo.ParentID, todo.ID)
+				} else {
+					cmd = m.createTodo(m.inputBuffer, "", "")
+				}
 			} else {
-				cmd = m.createWorkspace(m.inputBuffer, "")
+				if ws := m.SelectedWorkspace(); ws != nil {
+					cmd = m.createWorkspace(m.inputBuffer, ws.ParentID, ws.ID)
+				} else {
+					cmd = m.createWorkspace(m.inputBuffer, "", "")
+				}
 			}
 		case "add_child":
+			// A new child goes first under the selected todo
 			if m.activePane == PaneTodo && m.SelectedTodo() != nil {
-				cmd = m.createTodo(m.inputBuffer, m.SelectedTodo().ID)
+				cmd = m.createTodo(m.inputBuffer, m.SelectedTodo().ID, "")
 			}
 		case "edit":
 			if m.activePane == PaneTodo && m.SelectedTodo() != nil {
 				cmd = m.updateTodo(m.inputBuffer)
 			} else if m.activePane == PaneWorkspace && m.SelectedWorkspace() != nil {
 				cmd = m.updateWorkspace(m.inputBuffer)
+			} else if m.activePane == PaneWorkspace && m.SelectedView() != nil {
+				cmd = m.renameView(m.inputBuffer)
 			}
+		case "rename_tag":
+			cmd = m.renameTag(m.inputBuffer)
+		case "save_view":
+			cmd = m.saveView(m.inputBuffer, m.viewQuery)
+		case "time_travel":
+			cmd = m.startTimeTravel(m.inputBuffer)
 		}
 
 		m.mode = input.ModeNormal
@@ -342,14 +687,14 @@ func (m Model) handleInsertMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.inputAction = ""
 		return m, cmd
 	case "backspace":
-		if len(m.inputBuffer) > 0 {
-			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		if r := []rune(m.inputBuffer); len(r) > 0 {
+			m.inputBuffer = string(r[:len(r)-1])
 		}
 		return m, nil
 	default:
-		// Add character to buffer
-		if len(msg.String()) == 1 {
-			m.inputBuffer += msg.String()
+		// Add typed text to buffer, in any script
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.inputBuffer += string(msg.Runes)
 		}
 		return m, nil
 	}
@@ -364,12 +709,15 @@ func (m Model) handleSearchMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.inputPrompt = ""
 		m.isSearching = false
 		m.searchResults = nil
+		m.searchSnippets = nil
+		m.searchError = ""
 		// Restore original todos
 		return m, m.loadTodos()
 	case "enter":
 		// Confirm search and stay on results
 		m.mode = input.ModeNormal
 		m.inputPrompt = ""
+		m.searchError = ""
 		if len(m.searchResults) > 0 {
 			m.todos = m.searchResults
 			m.selectedTodoIndex = 0
@@ -377,31 +725,42 @@ func (m Model) handleSearchMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.isSearching = false
 		return m, nil
 	case "backspace":
-		if len(m.inputBuffer) > 0 {
-			m.inputBuffer = m.inputBuffer[:len(m.inputBuffer)-1]
+		if r := []rune(m.inputBuffer); len(r) > 0 {
+			m.inputBuffer = string(r[:len(r)-1])
 		}
 		// Trigger incremental search
 		if m.inputBuffer != "" {
-			return m, m.searchTodos(m.inputBuffer)
+			return m, m.searchTodos(m.inputBuffer, m.searchArchived)
 		}
 		return m, nil
-	case "j", "down":
+	case "ctrl+s":
+		// Save the query as a smart view
+		return m.startSaveView(), nil
+	case "ctrl+a":
+		// Toggle searching archived todos
+		m.searchArchived = !m.searchArchived
+		m.inputPrompt = searchPrompt(m.searchArchived)
+		if m.inputBuffer != "" {
+			return m, m.searchTodos(m.inputBuffer, m.searchArchived)
+		}
+		return m, nil
+	case "down", "ctrl+j":
 		// Navigate search results
 		if m.selectedTodoIndex < len(m.searchResults)-1 {
 			m.selectedTodoIndex++
 		}
 		return m, nil
-	case "k", "up":
+	case "up", "ctrl+k":
 		if m.selectedTodoIndex > 0 {
 			m.selectedTodoIndex--
 		}
 		return m, nil
 	default:
-		// Add character to buffer
-		if len(msg.String()) == 1 {
-			m.inputBuffer += msg.String()
+		// Add typed text to buffer; j and k are letters here
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.inputBuffer += string(msg.Runes)
 			// Trigger incremental search
-			return m, m.searchTodos(m.inputBuffer)
+			return m, m.searchTodos(m.inputBuffer, m.searchArchived)
 		}
 		return m, nil
 	}
@@ -436,9 +795,25 @@ func (m Model) handleSortMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 // Navigation helpers
 
+// navigate switches to the model after a selection key, loading the todos
+// of the newly selected workspace
+func (m Model) navigate(next Model) (tea.Model, tea.Cmd) {
+	if tag := next.SelectedTag(); next.activePane == PaneWorkspace && tag != nil && next.selectedTagIndex != m.selectedTagIndex {
+		return next, next.loadTagTodos(tag)
+	}
+	if next.activePane == PaneWorkspace && next.selectedWsIndex != m.selectedWsIndex {
+		return next, next.loadTodos()
+	}
+	return next, nil
+}
+
 func (m Model) moveDown() Model {
-	if m.activePane == PaneWorkspace {
-		if m.selectedWsIndex < len(m.workspaces)-1 {
+	if m.activePane == PaneWorkspace && m.showTags {
+		if m.selectedTagIndex < len(m.tags)-1 {
+			m.selectedTagIndex++
+		}
+	} else if m.activePane == PaneWorkspace {
+		if m.selectedWsIndex < m.workspacePaneRows()-1 {
 			m.selectedWsIndex++
 		}
 	} else {
@@ -450,7 +825,11 @@ func (m Model) moveDown() Model {
 }
 
 func (m Model) moveUp() Model {
-	if m.activePane == PaneWorkspace {
+	if m.activePane == PaneWorkspace && m.showTags {
+		if m.selectedTagIndex > 0 {
+			m.selectedTagIndex--
+		}
+	} else if m.activePane == PaneWorkspace {
 		if m.selectedWsIndex > 0 {
 			m.selectedWsIndex--
 		}
@@ -463,7 +842,9 @@ func (m Model) moveUp() Model {
 }
 
 func (m Model) moveToFirst() Model {
-	if m.activePane == PaneWorkspace {
+	if m.activePane == PaneWorkspace && m.showTags {
+		m.selectedTagIndex = 0
+	} else if m.activePane == PaneWorkspace {
 		m.selectedWsIndex = 0
 	} else {
 		m.selectedTodoIndex = 0
@@ -472,9 +853,13 @@ func (m Model) moveToFirst() Model {
 }
 
 func (m Model) moveToLast() Model {
-	if m.activePane == PaneWorkspace {
-		if len(m.workspaces) > 0 {
-			m.selectedWsIndex = len(m.workspaces) - 1
+	if m.activePane == PaneWorkspace && m.showTags {
+		if len(m.tags) > 0 {
+			m.selectedTagIndex = len(m.tags) - 1
+		}
+	} else if m.activePane == PaneWorkspace {
+		if m.workspacePaneRows() > 0 {
+			m.selectedWsIndex = m.workspacePaneRows() - 1
 		}
 	} else {
 		if len(m.todos) > 0 {
@@ -491,10 +876,20 @@ func clearNotificationAfter(d time.Duration) tea.Cmd {
 	})
 }
 
+// newActionContext returns the context for one user action. Every
+// operation recorded under it is undone and redone together.
+func newActionContext() context.Context {
+	return wal.WithUndoGroup(context.Background())
+}
+
 // Todo CRUD commands
 
-func (m Model) createTodo(description string, parentID string) tea.Cmd {
+// createTodo creates a todo under parentID right after afterID, or first
+// among its siblings when afterID is empty
+func (m Model) createTodo(description, parentID, afterID string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := m.SelectedWorkspace()
 		if ws == nil {
 			return errMsg{domain.ErrNotFound}
@@ -508,7 +903,7 @@ func (m Model) createTodo(description string, parentID string) tea.Cmd {
 			ParentID:    parentID,
 		}
 
-		if err := m.todoRepo.Create(context.Background(), todo); err != nil {
+		if err := m.todoRepo.CreateAfter(ctx, todo, afterID); err != nil {
 			return errMsg{err}
 		}
 
@@ -518,13 +913,15 @@ func (m Model) createTodo(description string, parentID string) tea.Cmd {
 
 func (m Model) updateTodo(description string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil {
 			return errMsg{domain.ErrNotFound}
 		}
 
 		todo.Description = description
-		if err := m.todoRepo.Update(context.Background(), todo); err != nil {
+		if err := m.todoRepo.Update(ctx, todo); err != nil {
 			return errMsg{err}
 		}
 
@@ -534,12 +931,14 @@ func (m Model) updateTodo(description string) tea.Cmd {
 
 func (m Model) deleteTodo() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil {
 			return errMsg{domain.ErrNotFound}
 		}
 
-		if err := m.todoRepo.Delete(context.Background(), todo.ID); err != nil {
+		if err := m.todoRepo.Delete(ctx, todo.ID); err != nil {
 			return errMsg{err}
 		}
 
@@ -549,6 +948,8 @@ func (m Model) deleteTodo() tea.Cmd {
 
 func (m Model) toggleTodoStatus() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil {
 			return errMsg{domain.ErrNotFound}
@@ -563,7 +964,7 @@ func (m Model) toggleTodoStatus() tea.Cmd {
 			todo.CompletedAt = nil
 		}
 
-		if err := m.todoRepo.Update(context.Background(), todo); err != nil {
+		if err := m.todoRepo.Update(ctx, todo); err != nil {
 			return errMsg{err}
 		}
 
@@ -573,14 +974,18 @@ func (m Model) toggleTodoStatus() tea.Cmd {
 
 // Workspace CRUD commands
 
-func (m Model) createWorkspace(name string, parentID string) tea.Cmd {
+// createWorkspace creates a workspace under parentID right after afterID,
+// or first among its siblings when afterID is empty
+func (m Model) createWorkspace(name, parentID, afterID string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := &domain.Workspace{
 			Name:     name,
 			ParentID: parentID,
 		}
 
-		if err := m.workspaceRepo.Create(context.Background(), ws); err != nil {
+		if err := m.workspaceRepo.CreateAfter(ctx, ws, afterID); err != nil {
 			return errMsg{err}
 		}
 
@@ -590,13 +995,15 @@ func (m Model) createWorkspace(name string, parentID string) tea.Cmd {
 
 func (m Model) updateWorkspace(name string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := m.SelectedWorkspace()
 		if ws == nil {
 			return errMsg{domain.ErrNotFound}
 		}
 
 		ws.Name = name
-		if err := m.workspaceRepo.Update(context.Background(), ws); err != nil {
+		if err := m.workspaceRepo.Update(ctx, ws); err != nil {
 			return errMsg{err}
 		}
 
@@ -604,14 +1011,11 @@ func (m Model) updateWorkspace(name string) tea.Cmd {
 	}
 }
 
-func (m Model) deleteWorkspace() tea.Cmd {
+func (m Model) deleteWorkspace(ws *domain.Workspace) tea.Cmd {
 	return func() tea.Msg {
-		ws := m.SelectedWorkspace()
-		if ws == nil {
-			return errMsg{domain.ErrNotFound}
-		}
+		ctx := newActionContext()
 
-		if err := m.workspaceRepo.Delete(context.Background(), ws.ID); err != nil {
+		if err := m.workspaceRepo.Delete(ctx, ws.ID); err != nil {
 			return errMsg{err}
 		}
 
@@ -623,6 +1027,8 @@ func (m Model) deleteWorkspace() tea.Cmd {
 
 func (m Model) indentTodo() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil {
 			return errMsg{domain.ErrNotFound}
@@ -634,7 +1040,7 @@ func (m Model) indentTodo() tea.Cmd {
 			if t.ID == todo.ID {
 				break
 			}
-			if t.Depth == todo.Depth {
+			if t.ParentID == todo.ParentID {
 				newParentID = t.ID
 			}
 		}
@@ -643,7 +1049,7 @@ func (m Model) indentTodo() tea.Cmd {
 			return notificationMsg{message: "Cannot indent: no sibling above", isError: true}
 		}
 
-		if err := m.todoRepo.Move(context.Background(), todo.ID, newParentID, ""); err != nil {
+		if err := m.todoRepo.Move(ctx, todo.ID, newParentID, ""); err != nil {
 			return errMsg{err}
 		}
 
@@ -653,18 +1059,20 @@ func (m Model) indentTodo() tea.Cmd {
 
 func (m Model) outdentTodo() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil || todo.ParentID == "" {
 			return notificationMsg{message: "Cannot outdent: no parent", isError: true}
 		}
 
 		// Get grandparent ID
-		parent, err := m.todoRepo.GetByID(context.Background(), todo.ParentID)
+		parent, err := m.todoRepo.GetByID(ctx, todo.ParentID)
 		if err != nil {
 			return errMsg{err}
 		}
 
-		if err := m.todoRepo.Move(context.Background(), todo.ID, parent.ParentID, ""); err != nil {
+		if err := m.todoRepo.Move(ctx, todo.ID, parent.ParentID, ""); err != nil {
 			return errMsg{err}
 		}
 
@@ -674,6 +1082,8 @@ func (m Model) outdentTodo() tea.Cmd {
 
 func (m Model) indentWorkspace() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := m.SelectedWorkspace()
 		if ws == nil {
 			return errMsg{domain.ErrNotFound}
@@ -685,7 +1095,7 @@ func (m Model) indentWorkspace() tea.Cmd {
 			if w.ID == ws.ID {
 				break
 			}
-			if w.Depth == ws.Depth {
+			if w.ParentID == ws.ParentID {
 				newParentID = w.ID
 			}
 		}
@@ -694,7 +1104,7 @@ func (m Model) indentWorkspace() tea.Cmd {
 			return notificationMsg{message: "Cannot indent: no sibling above", isError: true}
 		}
 
-		if err := m.workspaceRepo.Move(context.Background(), ws.ID, newParentID); err != nil {
+		if err := m.workspaceRepo.Move(ctx, ws.ID, newParentID); err != nil {
 			return errMsg{err}
 		}
 
@@ -704,18 +1114,20 @@ func (m Model) indentWorkspace() tea.Cmd {
 
 func (m Model) outdentWorkspace() tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := m.SelectedWorkspace()
 		if ws == nil || ws.ParentID == "" {
 			return notificationMsg{message: "Cannot outdent: no parent", isError: true}
 		}
 
 		// Get grandparent ID
-		parent, err := m.workspaceRepo.GetByID(context.Background(), ws.ParentID)
+		parent, err := m.workspaceRepo.GetByID(ctx, ws.ParentID)
 		if err != nil {
 			return errMsg{err}
 		}
 
-		if err := m.workspaceRepo.Move(context.Background(), ws.ID, parent.ParentID); err != nil {
+		if err := m.workspaceRepo.Move(ctx, ws.ID, parent.ParentID); err != nil {
 			return errMsg{err}
 		}
 
@@ -726,72 +1138,61 @@ func (m Model) outdentWorkspace() tea.Cmd {
 // Reorder commands
 
 func (m Model) moveTodoDown() tea.Cmd {
-	return func() tea.Msg {
-		todo := m.SelectedTodo()
-		if todo == nil {
-			return errMsg{domain.ErrNotFound}
-		}
-
-		newPosition := todo.Position + 1
-		if err := m.todoRepo.Reorder(context.Background(), todo.ID, newPosition); err != nil {
-			return errMsg{err}
-		}
-
-		return todoUpdatedMsg{todo: todo}
-	}
+	return m.reorderTodo(1, "Already at bottom")
 }
 
 func (m Model) moveTodoUp() tea.Cmd {
+	return m.reorderTodo(-1, "Already at top")
+}
+
+// reorderTodo moves the selected todo offset places among its siblings
+func (m Model) reorderTodo(offset int, atEnd string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		todo := m.SelectedTodo()
 		if todo == nil {
 			return errMsg{domain.ErrNotFound}
 		}
 
-		if todo.Position <= 0 {
-			return notificationMsg{message: "Already at top", isError: false}
-		}
-
-		newPosition := todo.Position - 1
-		if err := m.todoRepo.Reorder(context.Background(), todo.ID, newPosition); err != nil {
+		moved, err := m.todoRepo.Reorder(ctx, todo.ID, offset)
+		if err != nil {
 			return errMsg{err}
 		}
+		if !moved {
+			return notificationMsg{message: atEnd, isError: false}
+		}
 
 		return todoUpdatedMsg{todo: todo}
 	}
 }
 
 func (m Model) moveWorkspaceDown() tea.Cmd {
-	return func() tea.Msg {
-		ws := m.SelectedWorkspace()
-		if ws == nil {
-			return errMsg{domain.ErrNotFound}
-		}
-
-		newPosition := ws.Position + 1
-		if err := m.workspaceRepo.Reorder(context.Background(), ws.ID, newPosition); err != nil {
-			return errMsg{err}
-		}
-
-		return workspaceUpdatedMsg{workspace: ws}
-	}
+	return m.reorderWorkspace(1, "Already at bottom")
 }
 
 func (m Model) moveWorkspaceUp() tea.Cmd {
+	return m.reorderWorkspace(-1, "Already at top")
+}
+
+// reorderWorkspace moves the selected workspace offset places among its
+// siblings
+func (m Model) reorderWorkspace(offset int, atEnd string) tea.Cmd {
 	return func() tea.Msg {
+		ctx := newActionContext()
+
 		ws := m.SelectedWorkspace()
 		if ws == nil {
 			return errMsg{domain.ErrNotFound}
 		}
 
-		if ws.Position <= 0 {
-			return notificationMsg{message: "Already at top", isError: false}
-		}
-
-		newPosition := ws.Position - 1
-		if err := m.workspaceRepo.Reorder(context.Background(), ws.ID, newPosition); err != nil {
+		moved, err := m.workspaceRepo.Reorder(ctx, ws.ID, offset)
+		if err != nil {
 			return errMsg{err}
 		}
+		if !moved {
+			return notificationMsg{message: atEnd, isError: false}
+		}
 
 		return workspaceUpdatedMsg{workspace: ws}
 	}
@@ -807,7 +1208,7 @@ func (m Model) toggleExpand() tea.Cmd {
 		}
 
 		ws.IsExpanded = !ws.IsExpanded
-		if err := m.workspaceRepo.Update(context.Background(), ws); err != nil {
+		if err := m.workspaceRepo.SetExpanded(context.Background(), ws.ID, ws.IsExpanded); err != nil {
 			return errMsg{err}
 		}
 
@@ -819,7 +1220,7 @@ func (m Model) toggleExpand() tea.Cmd {
 
 func (m Model) undo() tea.Cmd {
 	return func() tea.Msg {
-		ops, err := m.wal.GetUndoOperations(1)
+		ops, err := m.undoGroup()
 		if err != nil {
 			return errMsg{err}
 		}
@@ -828,38 +1229,103 @@ func (m Model) undo() tea.Cmd {
 			return notificationMsg{message: "Nothing to undo", isError: false}
 		}
 
-		op := ops[0]
-		if err := m.wal.MarkUndone(op.ID); err != nil {
+		return undoMsg{operations: ops}
+	}
+}
+
+func (m Model) redo() tea.Cmd {
+	return func() tea.Msg {
+		ops, err := m.redoGroup()
+		if err != nil {
 			return errMsg{err}
 		}
 
-		return undoMsg{operation: op}
+		if len(ops) == 0 {
+			return notificationMsg{message: "Nothing to redo", isError: false}
+		}
+
+		return redoMsg{operations: ops}
 	}
 }
 
-func (m Model) redo() tea.Cmd {
+// jumpToHistory undoes or redoes every group between the current point
+// and target in one transaction, leaving target as the latest applied
+// group. Nothing changes if target can no longer be reached.
+func (m Model) jumpToHistory(target *repository.HistoryEntry) tea.Cmd {
 	return func() tea.Msg {
-		// For redo, we'd need to track undone operations
-		// For now, just show a message
-		return notificationMsg{message: "Redo not yet implemented", isError: false}
+		var undone, redone int
+		var err error
+
+		opID := target.Operations[0].ID
+		if target.IsUndone {
+			redone, err = m.wal.RedoTo(context.Background(), opID, m.applier.ApplyIn)
+		} else {
+			undone, err = m.wal.UndoTo(context.Background(), opID, m.applier.RevertIn)
+		}
+		if errors.Is(err, wal.ErrUnreachable) {
+			return notificationMsg{message: "That point is no longer in the history", isError: true}
+		}
+		if err != nil {
+			return errMsg{err}
+		}
+
+		return historyJumpedMsg{undone: undone, redone: redone}
 	}
 }
 
+// undoGroup reverts the latest group and returns its operations,
+// or nil when there is nothing to undo
+func (m Model) undoGroup() ([]*wal.Operation, error) {
+	return m.wal.Undo(context.Background(), m.applier.RevertIn)
+}
+
+// redoGroup re-applies the oldest undone group and returns its operations,
+// or nil when there is nothing to redo
+func (m Model) redoGroup() ([]*wal.Operation, error) {
+	return m.wal.Redo(context.Background(), m.applier.ApplyIn)
+}
+
+// describeGroup labels an undo group by its first operation
+func describeGroup(ops []*wal.Operation) string {
+	if len(ops) == 0 {
+		return ""
+	}
+	if len(ops) == 1 {
+		return ops[0].Describe()
+	}
+	return fmt.Sprintf("%s (+%d more)", ops[0].Describe(), len(ops)-1)
+}
+
 // Search and sort commands
 
-func (m Model) searchTodos(query string) tea.Cmd {
+func (m Model) searchTodos(text string, includeArchived bool) tea.Cmd {
 	return func() tea.Msg {
-		if query == "" {
-			return searchResultsMsg{todos: nil}
+		msg := searchResultsMsg{query: text, includeArchived: includeArchived}
+		if text == "" {
+			return msg
 		}
 
-		todos, err := m.todoRepo.Search(context.Background(), query, false)
+		results, err := m.todoRepo.Search(context.Background(), text, includeArchived)
+		var syntaxErr *query.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			msg.err = syntaxErr
+			return msg
+		}
 		if err != nil {
 			return errMsg{err}
 		}
 
-		return searchResultsMsg{todos: todos}
+		msg.results = results
+		return msg
+	}
+}
+
+// searchPrompt returns the search input prompt
+func searchPrompt(includeArchived bool) string {
+	if includeArchived {
+		return "Search (with archived): "
 	}
+	return "Search: "
 }
 
 func (m Model) sortTodos(sortBy string) tea.Cmd {
@@ -935,8 +1401,18 @@ type todoDeletedMsg struct{ id string }
 type workspaceCreatedMsg struct{ workspace *domain.Workspace }
 type workspaceUpdatedMsg struct{ workspace *domain.Workspace }
 type workspaceDeletedMsg struct{ id string }
-type undoMsg struct{ operation *wal.Operation }
-type searchResultsMsg struct{ todos []*domain.Todo }
+type undoMsg struct{ operations []*wal.Operation }
+type redoMsg struct{ operations []*wal.Operation }
+type historyJumpedMsg struct {
+	undone int
+	redone int
+}
+type searchResultsMsg struct {
+	query           string
+	includeArchived bool
+	results         []*domain.SearchResult
+	err             error // Malformed query
+}
 type todosSortedMsg struct {
 	todos  []*domain.Todo
 	sortBy string
@@ -7,6 +7,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/yuichikadota/lazytodo/internal/input"
 	"github.com/yuichikadota/lazytodo/internal/ui"
+	"github.com/yuichikadota/lazytodo/internal/wal"
 )
 
 var styles = ui.NewStyles()
@@ -26,6 +27,26 @@ func (m Model) View() string {
 		return m.renderHelp()
 	}
 
+	// Show history panel if active
+	if m.showHistory {
+		return m.renderHistory()
+	}
+
+	// Show trash panel if active
+	if m.showTrash {
+		return m.renderTrash()
+	}
+
+	// Show workspace picker if active
+	if m.showPicker {
+		return m.renderPicker()
+	}
+
+	// Ask before deleting a workspace with its contents
+	if m.confirmDelete != nil {
+		return m.renderConfirmDelete()
+	}
+
 	// Check for welcome screen
 	if !m.HasWorkspaces() {
 		return m.renderWelcome()
@@ -35,8 +56,8 @@ func (m Model) View() string {
 
 	// Calculate dimensions
 	contentHeight := m.height - 2 // Reserve for status bar
-	if m.mode == input.ModeSearch {
-		contentHeight-- // Reserve for search bar
+	if m.showInputBar() {
+		contentHeight-- // Reserve for input bar
 	}
 
 	// Render two panes
@@ -44,8 +65,8 @@ func (m Model) View() string {
 	b.WriteString(panes)
 	b.WriteString("\n")
 
-	// Search bar (only for search mode)
-	if m.mode == input.ModeSearch {
+	// Input bar (search mode and prompts)
+	if m.showInputBar() {
 		inputBar := m.renderInputBar()
 		b.WriteString(inputBar)
 		b.WriteString("\n")
@@ -58,6 +79,11 @@ func (m Model) View() string {
 	return b.String()
 }
 
+// showInputBar returns true if input is typed into the bar below the panes
+func (m Model) showInputBar() bool {
+	return m.mode == input.ModeSearch || m.inputAction == "time_travel" || m.inputAction == "save_view"
+}
+
 // renderError renders the error screen
 func (m Model) renderError() string {
 	errorStyle := lipgloss.NewStyle().
@@ -135,6 +161,7 @@ func (m Model) renderPanes(height int) string {
 	// Render workspace pane
 	wsPane := ui.WorkspacePaneModel{
 		Workspaces:    m.workspaces,
+		Views:         m.views,
 		SelectedIndex: m.selectedWsIndex,
 		IsActive:      m.activePane == PaneWorkspace,
 		Width:         wsWidth,
@@ -145,6 +172,12 @@ func (m Model) renderPanes(height int) string {
 		EditBuffer:    m.inputBuffer,
 		IsAdding:      isWsAdding,
 	}
+	if isWsAdding {
+		levels := ui.TreeLevels(len(m.workspaces),
+			func(i int) string { return m.workspaces[i].ID },
+			func(i int) string { return m.workspaces[i].ParentID })
+		wsPane.AddAfter, wsPane.AddDepth = addPlacement(levels, m.selectedWsIndex, false)
+	}
 
 	// Render todo pane
 	todoPane := ui.TodoPaneModel{
@@ -153,32 +186,103 @@ func (m Model) renderPanes(height int) string {
 		IsActive:      m.activePane == PaneTodo,
 		Width:         todoWidth,
 		Height:        height,
-		WorkspaceName: func() string {
-			if ws := m.SelectedWorkspace(); ws != nil {
-				return ws.Name
-			}
-			return ""
-		}(),
+		WorkspaceName: m.selectionName(),
 		Styles:       styles,
 		IsEditing:    isTodoEditing,
 		EditingIndex: m.selectedTodoIndex,
 		EditBuffer:   m.inputBuffer,
 		IsAdding:     isTodoAdding,
+		Snippets:     m.searchSnippets,
+	}
+	if m.cut != nil {
+		todoPane.CutID = m.cut.ID
+	}
+	if m.showTags {
+		todoPane.WorkspacePaths = m.workspacePaths()
+	}
+	if isTodoAdding {
+		levels := ui.TreeLevels(len(m.todos),
+			func(i int) string { return m.todos[i].ID },
+			func(i int) string { return m.todos[i].ParentID })
+		todoPane.AddAfter, todoPane.AddDepth = addPlacement(levels, m.selectedTodoIndex, m.inputAction == "add_child")
+	}
+
+	// The past is shown read-only in place of the current todos
+	if m.mode == input.ModeTimeTravel {
+		wsPane.IsActive = false
+		todoPane = ui.TodoPaneModel{
+			Todos:         m.timeTravel.todos,
+			SelectedIndex: m.timeTravel.selectedIndex,
+			IsActive:      true,
+			Width:         todoWidth,
+			Height:        height,
+			WorkspaceName: m.timeTravel.workspace.Name,
+			Styles:        styles,
+			ReadOnly:      true,
+			AsOf:          m.timeTravel.at,
+		}
+	}
+
+	leftPane := wsPane.Render()
+	if m.showTags {
+		leftPane = ui.TagPaneModel{
+			Tags:          m.tags,
+			SelectedIndex: m.selectedTagIndex,
+			IsActive:      wsPane.IsActive,
+			Width:         wsWidth,
+			Height:        height,
+			Styles:        styles,
+			IsEditing:     m.mode == input.ModeInsert && m.inputAction == "rename_tag",
+			EditBuffer:    m.inputBuffer,
+		}.Render()
 	}
 
 	// Join horizontally
 	return lipgloss.JoinHorizontal(
 		lipgloss.Top,
-		wsPane.Render(),
+		leftPane,
 		todoPane.Render(),
 	)
 }
 
+// selectionName returns the name of the selected workspace, view or tag
+func (m Model) selectionName() string {
+	if tag := m.SelectedTag(); tag != nil {
+		return "@" + tag.Name
+	}
+	if ws := m.SelectedWorkspace(); ws != nil {
+		return ws.Name
+	}
+	if view := m.SelectedView(); view != nil {
+		return view.Name
+	}
+	return ""
+}
+
+// addPlacement returns the row the add input follows, -1 for none, and the
+// tree level of the new item. A sibling lands after the selected row and
+// its subtree, a child first under the selected row.
+func addPlacement(levels []int, selected int, child bool) (after, level int) {
+	if selected < 0 || selected >= len(levels) {
+		return -1, 0
+	}
+	if child {
+		return selected, levels[selected] + 1
+	}
+
+	after = selected
+	for after+1 < len(levels) && levels[after+1] > levels[selected] {
+		after++
+	}
+	return after, levels[selected]
+}
+
 // renderInputBar renders the input bar
 func (m Model) renderInputBar() string {
 	inputBar := ui.InputBarModel{
 		Prompt: m.inputPrompt,
 		Value:  m.inputBuffer,
+		Error:  m.searchError,
 		Width:  m.width,
 		Styles: styles,
 	}
@@ -191,21 +295,102 @@ func (m Model) renderStatusBar() string {
 	statusBar := ui.StatusBarModel{
 		Mode:          m.mode.String(),
 		TodoCount:     len(m.todos),
-		WorkspaceName: func() string {
-			if ws := m.SelectedWorkspace(); ws != nil {
-				return ws.Name
-			}
-			return ""
-		}(),
+		WorkspaceName: m.selectionName(),
 		Notification: m.notification,
 		IsError:      m.notificationErr,
 		Width:        m.width,
 		Styles:       styles,
 	}
 
+	if m.mode == input.ModeTimeTravel {
+		statusBar.TodoCount = len(m.timeTravel.todos)
+		statusBar.WorkspaceName = m.timeTravel.workspace.Name
+	}
+
 	return statusBar.Render()
 }
 
+// renderHistory renders the undo history panel
+func (m Model) renderHistory() string {
+	entries := make([]ui.HistoryEntry, len(m.history))
+	for i, e := range m.history {
+		entries[i] = ui.HistoryEntry{
+			Summary:   e.Summary,
+			CreatedAt: e.CreatedAt,
+			IsUndone:  e.IsUndone,
+		}
+	}
+
+	panel := ui.HistoryPanelModel{
+		Entries:       entries,
+		SelectedIndex: m.selectedHistoryIndex,
+		Width:         m.width * 2 / 3,
+		Height:        m.height - 4,
+		Styles:        styles,
+	}
+
+	return panel.Overlay(m.width, m.height-1) + "\n" + m.renderStatusBar()
+}
+
+// renderTrash renders the trash panel
+func (m Model) renderTrash() string {
+	entries := make([]ui.TrashEntry, len(m.trash))
+	for i, e := range m.trash {
+		entries[i] = ui.TrashEntry{
+			Name:        e.Name,
+			IsWorkspace: e.EntityType == wal.EntityWorkspace,
+			Location:    e.Location,
+			DeletedAt:   e.DeletedAt,
+			Items:       e.Items,
+		}
+	}
+
+	panel := ui.TrashPanelModel{
+		Entries:       entries,
+		SelectedIndex: m.selectedTrashIndex,
+		Retention:     m.trashRetention,
+		Width:         m.width * 2 / 3,
+		Height:        m.height - 4,
+		Styles:        styles,
+	}
+
+	return panel.Overlay(m.width, m.height-1) + "\n" + m.renderStatusBar()
+}
+
+// renderPicker renders the workspace picker
+func (m Model) renderPicker() string {
+	entries := make([][]string, len(m.picker.matches))
+	for i, c := range m.picker.matches {
+		entries[i] = c.path
+	}
+
+	picker := ui.WorkspacePickerModel{
+		Title:         fmt.Sprintf("Move '%s' to", m.picker.todo.Description),
+		Query:         m.picker.query,
+		Entries:       entries,
+		SelectedIndex: m.picker.selected,
+		Width:         m.width * 2 / 3,
+		Height:        m.height - 4,
+		Styles:        styles,
+	}
+
+	return picker.Overlay(m.width, m.height-1) + "\n" + m.renderStatusBar()
+}
+
+// renderConfirmDelete renders the dialog confirming a workspace delete
+func (m Model) renderConfirmDelete() string {
+	d := m.confirmDelete
+	dialog := ui.ConfirmDialogModel{
+		Title:   fmt.Sprintf("Delete workspace '%s'?", d.workspace.Name),
+		Message: d.describe(),
+		Action:  "delete",
+		Width:   min(m.width*2/3, 60),
+		Styles:  styles,
+	}
+
+	return dialog.Overlay(m.width, m.height-1) + "\n" + m.renderStatusBar()
+}
+
 // renderHelp renders the help screen
 func (m Model) renderHelp() string {
 	helpContent := `
@@ -221,7 +406,8 @@ func (m Model) renderHelp() string {
    a          Add new item
    A          Add child item
    i          Edit current item
-   dd         Delete current item
+   dd         Delete current item (a workspace asks
+              first, with what goes with it)
    Enter/Space Toggle todo status
    o          Toggle expand/collapse
 
@@ -229,14 +415,35 @@ func (m Model) renderHelp() string {
    >          Indent (make child)
    <          Outdent (move up level)
    Ctrl+j/k   Move item down/up
+   m          Move todo to another workspace
+   x          Cut todo with its subtasks
+   p/P        Paste under selected todo / at top level
 
  SEARCH
    /          Enter search mode
+              Filters: tag:work status:pending urgency>=3
+              due<2026-11-01 (or today, 3d, none) ws:Backend
+              archived:yes|no|only
+   Ctrl+a     Include archived todos
+   Ctrl+s     Save search as a smart view
+              (i renames it, dd deletes it)
+   Ctrl+j/k   Select result
    Esc        Exit search mode
 
+ TAGS
+   #          Browse tags in place of the workspaces
+              (todos of every workspace with the tag)
+   i          Rename the selected tag; an existing
+              name merges the two
+
  OTHER
    ?          Toggle this help
    u          Undo
+   Ctrl+r     Redo
+   U          Undo history
+   t          Trash (Enter: restore, PP: purge old items)
+   T          View workspace as of a past time
+              (e.g. monday, yesterday, 3d, 2026-10-12 14:00)
    q          Quit
 
  Press ? to close this help
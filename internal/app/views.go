@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/input"
+)
+
+// Smart views are saved searches listed after the workspaces. Selecting
+// one runs its query, so the todo pane shows the matches across every
+// workspace. A view holds no todos of its own: nothing can be added,
+// pasted or rearranged in it.
+
+// viewSavedMsg reports a view saved from the search input
+type viewSavedMsg struct{ view *domain.SavedView }
+
+// viewRenamedMsg reports a renamed view
+type viewRenamedMsg struct{ name string }
+
+// viewDeletedMsg reports a deleted view
+type viewDeletedMsg struct{ name string }
+
+// SelectedView returns the smart view selected in the workspace pane,
+// or nil when a workspace is selected or the tag browser is open
+func (m Model) SelectedView() *domain.SavedView {
+	i := m.selectedWsIndex - len(m.workspaces)
+	if m.showTags || i < 0 || i >= len(m.views) {
+		return nil
+	}
+	return m.views[i]
+}
+
+// workspacePaneRows returns the number of rows in the workspace pane
+func (m Model) workspacePaneRows() int {
+	return len(m.workspaces) + len(m.views)
+}
+
+// refuseInView blocks an action that needs a real workspace while a smart
+// view is selected or the tag browser is open, and reports whether it did
+func (m *Model) refuseInView(action string) bool {
+	switch {
+	case m.showTags:
+		m.notification = fmt.Sprintf("Tags only show the todos that have them; %s", action)
+	case m.SelectedView() != nil:
+		m.notification = fmt.Sprintf("Smart views only show search results; %s", action)
+	default:
+		return false
+	}
+	m.notificationErr = true
+	return true
+}
+
+// startSaveView asks for a name for the query being typed
+func (m Model) startSaveView() Model {
+	if m.inputBuffer == "" {
+		return m
+	}
+	if m.searchError != "" {
+		m.notification = "Fix the query before saving it"
+		m.notificationErr = true
+		return m
+	}
+	m.viewQuery = m.inputBuffer
+	m.searchError = ""
+	m.mode = input.ModeInsert
+	m.inputPrompt = "Save view as: "
+	m.inputAction = "save_view"
+	m.inputBuffer = ""
+	return m
+}
+
+// saveView saves query as a view called name
+func (m Model) saveView(name, query string) tea.Cmd {
+	return func() tea.Msg {
+		view := &domain.SavedView{Name: name, Query: query}
+		if err := m.viewRepo.Create(newActionContext(), view); err != nil {
+			return errMsg{err}
+		}
+		return viewSavedMsg{view}
+	}
+}
+
+// renameView renames the selected view
+func (m Model) renameView(name string) tea.Cmd {
+	view := m.SelectedView()
+	if view == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := m.viewRepo.Rename(newActionContext(), view.ID, name); err != nil {
+			return errMsg{err}
+		}
+		return viewRenamedMsg{name}
+	}
+}
+
+// deleteView deletes the selected view
+func (m Model) deleteView() tea.Cmd {
+	view := m.SelectedView()
+	if view == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := m.viewRepo.Delete(newActionContext(), view.ID); err != nil {
+			return errMsg{err}
+		}
+		return viewDeletedMsg{view.Name}
+	}
+}
+
+// loadViewTodos returns a command that runs the query of view
+func (m Model) loadViewTodos(view *domain.SavedView) tea.Cmd {
+	return func() tea.Msg {
+		results, err := m.todoRepo.Search(context.Background(), view.Query, false)
+		if err != nil {
+			return errMsg{fmt.Errorf("view '%s': %w", view.Name, err)}
+		}
+
+		msg := todosLoadedMsg{
+			todos:    make([]*domain.Todo, len(results)),
+			snippets: make(map[string]string, len(results)),
+		}
+		for i, r := range results {
+			msg.todos[i] = r.Todo
+			msg.snippets[r.Todo.ID] = r.Snippet
+		}
+		return msg
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/repository"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Fsck checks the workspace and todo trees for cycles, orphans and
+// inconsistent closure rows, and repairs them with -repair. Without
+// -repair the database is opened read-only.
+func Fsck(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", repository.DefaultDBPath(), "database path")
+	repair := fs.Bool("repair", false, "repair the problems found")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Checking only reads, so it cannot change the database it reports on
+	if !*repair {
+		return checkDB(*dbPath, out)
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := wal.New(db.DB, wal.Config{
+		ApplyFunc: repository.NewApplier(db).Apply,
+	})
+	defer w.Close()
+
+	// Repair the data as the app would see it
+	recovery, err := w.RunRecovery()
+	if err != nil {
+		return err
+	}
+	if !recovery.Empty() {
+		fmt.Fprintln(out, recovery)
+	}
+
+	ctx := context.Background()
+	issues, err := repository.RepairIntegrity(ctx, db)
+	if err != nil {
+		return err
+	}
+	printIssues(out, issues, "repaired")
+	if len(issues) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return nil
+	}
+
+	// Undoing past the repair would bring the broken rows back
+	if _, err := w.Checkpoint(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Repaired %s; undo history before the repair was cleared\n", countNoun(len(issues), "problem"))
+
+	remaining, err := repository.CheckIntegrity(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		printIssues(out, remaining, "repair")
+		return fmt.Errorf("%s left after repair", countNoun(len(remaining), "problem"))
+	}
+
+	return nil
+}
+
+// checkDB reports the problems in the database at path without changing
+// it: migrations not yet run, logged operations not yet applied and
+// broken trees
+func checkDB(path string, out io.Writer) error {
+	db, err := openReadOnlyDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The trees can only be checked against the current schema
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	var pending int
+	for _, s := range statuses {
+		// One that needs a feature this build lacks waits for a build with it
+		if !s.Applied && s.Needs == "" {
+			fmt.Fprintf(out, "migration %03d_%s has not been run\n", s.Version, s.Name)
+			fmt.Fprintln(out, "    repair: run 'lazytodo migrate up'")
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("found %s; migrate the database to check the trees", countNoun(pending, "pending migration"))
+	}
+
+	// The app replays these on startup, before it looks at the trees
+	unapplied, err := wal.New(db.DB, wal.Config{}).Recovery()
+	if err != nil {
+		return err
+	}
+	for _, op := range unapplied {
+		fmt.Fprintf(out, "operation %d (%s) was logged but not applied\n", op.ID, op.Describe())
+		fmt.Fprintln(out, "    repair: replay it")
+	}
+
+	issues, err := repository.CheckIntegrity(context.Background(), db)
+	if err != nil {
+		return err
+	}
+	printIssues(out, issues, "repair")
+	if n := len(unapplied) + len(issues); n > 0 {
+		return fmt.Errorf("found %s; run 'lazytodo fsck -repair' to fix", countNoun(n, "problem"))
+	}
+	fmt.Fprintln(out, "No problems found")
+	return nil
+}
+
+func printIssues(out io.Writer, issues []*domain.IntegrityError, verb string) {
+	for _, issue := range issues {
+		fmt.Fprintln(out, issue)
+		fmt.Fprintf(out, "    %s: %s\n", verb, issue.Repair)
+	}
+}
+
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
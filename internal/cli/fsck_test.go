@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/repository"
+)
+
+// unappliedOps returns the number of logged operations not yet applied
+func unappliedOps(t *testing.T, path string) int {
+	t.Helper()
+	db, err := repository.NewReadOnlyDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM operation_log WHERE applied = 0`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFsckReportsUnappliedOperationsWithoutReplayingThem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lazytodo.db")
+	db, err := repository.NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO operation_log (operation_type, entity_type, entity_id, payload, applied, created_at)
+		VALUES ('create', 'workspace', 'home', '{"after":{"id":"home","name":"Home"}}', 0, '2024-01-01T00:00:00Z')
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = Fsck([]string{"-db", path}, &out)
+	if err == nil || !strings.Contains(out.String(), "logged but not applied") {
+		t.Errorf("fsck returned %v with\n%s\nwant the unapplied operation reported", err, out.String())
+	}
+	if n := unappliedOps(t, path); n != 1 {
+		t.Errorf("%d operations are unapplied after the check, want it left for the app", n)
+	}
+}
+
+func TestFsckReportsPendingMigrationsWithoutRunningThem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lazytodo.db")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := Fsck([]string{"-db", path}, &out)
+	if err == nil || !strings.Contains(out.String(), "001_initial has not been run") {
+		t.Errorf("fsck returned %v with\n%s\nwant the pending migrations reported", err, out.String())
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("the database was written to by the check")
+	}
+}
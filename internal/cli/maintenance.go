@@ -0,0 +1,150 @@
+// Package cli implements the non-interactive lazytodo subcommands
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/repository"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Maintenance compacts the operation log per the retention policy,
+// vacuums the database and reports the size before and after
+func Maintenance(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("maintenance", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", repository.DefaultDBPath(), "database path")
+	keepGroups := fs.Int("keep-groups", 0, "undo groups to keep (0: default, -1: no limit)")
+	keepDays := fs.Int("keep-days", 0, "days of undo history to keep (0: default, -1: no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policy := wal.RetentionPolicy{MaxGroups: *keepGroups}
+	if *keepDays != 0 {
+		policy.MaxAge = time.Duration(*keepDays) * 24 * time.Hour
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := wal.New(db.DB, wal.Config{
+		ApplyFunc: repository.NewApplier(db).Apply,
+		Retention: policy,
+	})
+	defer w.Close()
+
+	// Never compact over operations a crashed session left behind
+	recovery, err := w.RunRecovery()
+	if err != nil {
+		return err
+	}
+	if !recovery.Empty() {
+		fmt.Fprintln(out, recovery)
+	}
+
+	before, err := w.Stats()
+	if err != nil {
+		return err
+	}
+	beforeSize := fileSize(*dbPath)
+
+	cp, err := w.Compact()
+	if err != nil {
+		return err
+	}
+
+	if err := db.Vacuum(context.Background()); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+
+	after, err := w.Stats()
+	if err != nil {
+		return err
+	}
+	afterSize := fileSize(*dbPath)
+
+	fmt.Fprintf(out, "Before: %s, database %s\n", describeStats(before), formatBytes(beforeSize))
+	if cp != nil {
+		fmt.Fprintf(out, "Compacted %d operations in %d undo groups into checkpoint #%d\n", cp.Operations, cp.Groups, cp.ID)
+	} else {
+		fmt.Fprintln(out, "Nothing to compact")
+	}
+	fmt.Fprintf(out, "After:  %s, database %s\n", describeStats(after), formatBytes(afterSize))
+
+	return nil
+}
+
+// openDB opens and migrates the database at path
+func openDB(path string) (*repository.DB, error) {
+	db, err := openExistingDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openExistingDB opens the database at path without creating or
+// migrating it
+func openExistingDB(path string) (*repository.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return repository.NewDB(path)
+}
+
+// openReadOnlyDB opens the existing database at path for reading only
+func openReadOnlyDB(path string) (*repository.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return repository.NewReadOnlyDB(path)
+}
+
+func describeStats(s *wal.Stats) string {
+	desc := fmt.Sprintf("%d operations in %d undo groups, %s of payload", s.Operations, s.Groups, formatBytes(s.PayloadBytes))
+	if s.Unapplied > 0 {
+		desc += fmt.Sprintf(" (%d unapplied)", s.Unapplied)
+	}
+	return desc
+}
+
+// fileSize returns the size of the database including its SQLite WAL file
+func fileSize(path string) int64 {
+	var total int64
+	for _, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/yuichikadota/lazytodo/internal/repository"
+)
+
+// Migrate runs "lazytodo migrate status|up|down"
+func Migrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lazytodo migrate status|up|down [-db path] [-to version]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", repository.DefaultDBPath(), "database path")
+	to := fs.Int("to", -1, "version to roll back to (down only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// Status only reads, so it cannot change the database it reports on
+	open := openExistingDB
+	if action == "status" {
+		open = repository.NewReadOnlyDB
+	}
+	db, err := open(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch action {
+	case "status":
+		// Report only
+	case "up":
+		if err := db.Migrate(); err != nil {
+			return err
+		}
+	case "down":
+		if *to < 0 {
+			return fmt.Errorf("migrate down needs -to, e.g. -to 1 keeps only migration 001")
+		}
+		if err := db.Rollback(*to); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tROLLBACK")
+	for _, s := range statuses {
+		status := "pending"
+		switch {
+		case s.Unknown:
+			status = "UNKNOWN"
+		case s.Modified:
+			status = "MODIFIED"
+		case s.Applied:
+			status = "applied"
+		case s.Needs != "":
+			status = "needs " + s.Needs
+		}
+		rollback := "yes"
+		if s.Down == "" {
+			rollback = "no"
+		}
+		fmt.Fprintf(tw, "%03d\t%s\t%s\t%s\t%s\n", s.Version, s.Name, status, s.AppliedAt, rollback)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		if s.Needs != "" {
+			fmt.Fprintf(out, "\n%03d_%s waits for SQLite built with %s; build lazytodo with make to apply it\n", s.Version, s.Name, s.Needs)
+		}
+	}
+	return nil
+}
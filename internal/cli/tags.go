@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yuichikadota/lazytodo/internal/repository"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Tags runs "lazytodo tags list|rename"
+func Tags(args []string, out io.Writer) error {
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("tags "+action, flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("db", repository.DefaultDBPath(), "database path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case action == "list" && fs.NArg() == 0:
+	case action == "rename" && fs.NArg() == 2:
+	default:
+		return fmt.Errorf("usage: lazytodo tags [list] [-db path] | lazytodo tags rename [-db path] FROM TO")
+	}
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := wal.New(db.DB, wal.Config{
+		ApplyFunc: repository.NewApplier(db).Apply,
+	})
+	defer w.Close()
+
+	// Rename rewrites descriptions, so bring back what a crashed session
+	// left behind first
+	recovery, err := w.RunRecovery()
+	if err != nil {
+		return err
+	}
+	if !recovery.Empty() {
+		fmt.Fprintln(out, recovery)
+	}
+
+	ctx := context.Background()
+	repo := repository.NewTagRepository(db, w)
+
+	if action == "rename" {
+		from := strings.TrimPrefix(fs.Arg(0), "@")
+		to := strings.TrimPrefix(fs.Arg(1), "@")
+		n, err := repo.Rename(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Renamed @%s to @%s in %s\n", from, to, countNoun(n, "todo"))
+		return nil
+	}
+
+	tags, err := repo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		fmt.Fprintln(out, "No tags")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tPENDING\tCOMPLETED")
+	for _, t := range tags {
+		fmt.Fprintf(tw, "@%s\t%d\t%d\n", t.Name, t.Pending, t.Completed)
+	}
+	return tw.Flush()
+}
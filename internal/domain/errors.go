@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Fatal errors - application should exit
 var (
@@ -15,7 +18,11 @@ var (
 	ErrOrphanNode        = errors.New("orphan node detected")
 	ErrCircularReference = errors.New("circular reference detected")
 	ErrWriteFailed       = errors.New("write operation failed")
+	ErrWritePending      = errors.New("write operation pending")
 	ErrInvalidOperation  = errors.New("invalid operation")
+	ErrHistoryUnavailable = errors.New("history not available")
+	ErrInvalidTimestamp  = errors.New("invalid timestamp")
+	ErrConflict          = errors.New("write conflict")
 )
 
 // Warning errors - operation continues with defaults
@@ -24,3 +31,25 @@ var (
 	ErrInvalidTheme      = errors.New("invalid theme configuration")
 	ErrInvalidKeybinding = errors.New("invalid keybinding configuration")
 )
+
+// IntegrityError is one inconsistency found in a stored tree. It wraps
+// ErrCircularReference, ErrOrphanNode or ErrIntegrityViolation.
+type IntegrityError struct {
+	Err    error
+	Entity string // "todo" or "workspace"
+	ID     string
+	Name   string
+	Detail string // What is wrong
+	Repair string // What repairing it does
+}
+
+func (e *IntegrityError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s %s: %v: %s", e.Entity, e.ID, e.Err, e.Detail)
+	}
+	return fmt.Sprintf("%s '%s' (%s): %v: %s", e.Entity, e.Name, e.ID, e.Err, e.Detail)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
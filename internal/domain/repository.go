@@ -10,12 +10,22 @@ type WorkspaceRepository interface {
 	// Create creates a new workspace
 	Create(ctx context.Context, workspace *Workspace) error
 
+	// CreateAfter creates a new workspace right after a sibling
+	CreateAfter(ctx context.Context, workspace *Workspace, afterID string) error
+
 	// Update updates an existing workspace
 	Update(ctx context.Context, workspace *Workspace) error
 
-	// Delete soft-deletes a workspace
+	// SetExpanded expands or collapses a workspace in the tree
+	SetExpanded(ctx context.Context, id string, expanded bool) error
+
+	// Delete soft-deletes a workspace with its descendants and their todos
 	Delete(ctx context.Context, id string) error
 
+	// DeleteImpact counts the descendant workspaces and todos Delete
+	// would remove along with a workspace
+	DeleteImpact(ctx context.Context, id string) (workspaces, todos int, err error)
+
 	// GetByID retrieves a workspace by ID
 	GetByID(ctx context.Context, id string) (*Workspace, error)
 
@@ -34,8 +44,9 @@ type WorkspaceRepository interface {
 	// Move moves a workspace to a new parent
 	Move(ctx context.Context, id string, newParentID string) error
 
-	// Reorder changes the position of a workspace among siblings
-	Reorder(ctx context.Context, id string, newPosition int) error
+	// Reorder moves a workspace offset places among its siblings and
+	// reports whether it moved
+	Reorder(ctx context.Context, id string, offset int) (bool, error)
 
 	// GetOrCreateArchive ensures the _archive workspace exists
 	GetOrCreateArchive(ctx context.Context) (*Workspace, error)
@@ -46,6 +57,9 @@ type TodoRepository interface {
 	// Create creates a new todo
 	Create(ctx context.Context, todo *Todo) error
 
+	// CreateAfter creates a new todo right after a sibling
+	CreateAfter(ctx context.Context, todo *Todo, afterID string) error
+
 	// Update updates an existing todo
 	Update(ctx context.Context, todo *Todo) error
 
@@ -67,11 +81,13 @@ type TodoRepository interface {
 	// Move moves a todo to a new parent or workspace
 	Move(ctx context.Context, id string, newParentID string, newWorkspaceID string) error
 
-	// Reorder changes the position of a todo among siblings
-	Reorder(ctx context.Context, id string, newPosition int) error
+	// Reorder moves a todo offset places among its siblings and reports
+	// whether it moved
+	Reorder(ctx context.Context, id string, offset int) (bool, error)
 
-	// Search searches todos by description
-	Search(ctx context.Context, query string, includeArchived bool) ([]*Todo, error)
+	// Search finds todos by words in their description, best match first,
+	// and by filters such as tag:work or urgency>=3
+	Search(ctx context.Context, query string, includeArchived bool) ([]*SearchResult, error)
 
 	// Archive marks a todo as archived
 	Archive(ctx context.Context, id string) error
@@ -79,3 +95,28 @@ type TodoRepository interface {
 	// GetCompletedBefore retrieves todos completed before a given time
 	GetCompletedBefore(ctx context.Context, before time.Time) ([]*Todo, error)
 }
+
+// SavedViewRepository defines the interface for saved search persistence
+type SavedViewRepository interface {
+	// Create saves a new view after the existing ones
+	Create(ctx context.Context, view *SavedView) error
+
+	// Rename renames a view
+	Rename(ctx context.Context, id string, name string) error
+
+	// Delete removes a view
+	Delete(ctx context.Context, id string) error
+
+	// GetAll retrieves every view in order
+	GetAll(ctx context.Context) ([]*SavedView, error)
+}
+
+// TagRepository defines the interface for tags across every todo
+type TagRepository interface {
+	// Rename renames a tag and the tags under it in every todo, merging
+	// it into to when to exists. It returns the number of todos changed.
+	Rename(ctx context.Context, from, to string) (int, error)
+
+	// GetAll retrieves every tag of an active todo with its counts
+	GetAll(ctx context.Context) ([]*Tag, error)
+}
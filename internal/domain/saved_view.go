@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// SavedView is a named search shown next to the workspaces. Opening it
+// runs Query, so its todos are always current. A view holds no todos of
+// its own and cannot be the target of an add or a move.
+type SavedView struct {
+	ID        string
+	Name      string
+	Query     string
+	Position  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
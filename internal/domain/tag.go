@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tags are written in descriptions as @name. A name is letters, marks,
+// digits and underscores in any script, so @仕事 is a tag; slashes nest a
+// tag under another, so @work/backend is a tag under @work.
+
+// TagSeparator separates the levels of a tag
+const TagSeparator = "/"
+
+// tagRegex matches @tag patterns
+var tagRegex = regexp.MustCompile(`@([\p{L}\p{M}\p{N}_]+(?:/[\p{L}\p{M}\p{N}_]+)*)`)
+
+// tagName matches a whole tag name, without the @
+var tagName = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_]+(?:/[\p{L}\p{M}\p{N}_]+)*$`)
+
+// Tag is a tag with the number of active todos that have it or a tag
+// under it
+type Tag struct {
+	Name      string
+	Pending   int
+	Completed int
+}
+
+// ParseTags returns the distinct tags of a description in the order they
+// first appear
+func ParseTags(description string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range tagRegex.FindAllStringSubmatch(description, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			tags = append(tags, match[1])
+		}
+	}
+	return tags
+}
+
+// ValidTag reports whether s is a tag name, without the @
+func ValidTag(s string) bool {
+	return tagName.MatchString(s)
+}
+
+// TagUnder reports whether tag is ancestor or nested under it
+func TagUnder(tag, ancestor string) bool {
+	return tag == ancestor || strings.HasPrefix(tag, ancestor+TagSeparator)
+}
+
+// TagAncestors returns tag and every tag it is nested under, outermost
+// first: work, work/backend, work/backend/api
+func TagAncestors(tag string) []string {
+	parts := strings.Split(tag, TagSeparator)
+	tags := make([]string, len(parts))
+	for i := range parts {
+		tags[i] = strings.Join(parts[:i+1], TagSeparator)
+	}
+	return tags
+}
+
+// RenameTag rewrites the tags of description that are from or nested
+// under it so they start with to instead: renaming work to job turns
+// @work/api into @job/api. A renamed tag that repeats one already in the
+// description is dropped, which is how two tags merge. It reports whether
+// the description changed.
+func RenameTag(description, from, to string) (string, bool) {
+	var b strings.Builder
+	kept := make(map[string]bool) // Tags written so far, true if renamed
+	last, changed := 0, false
+
+	for _, m := range tagRegex.FindAllStringSubmatchIndex(description, -1) {
+		tag := description[m[2]:m[3]]
+		renamed := TagUnder(tag, from)
+		if renamed {
+			tag = to + tag[len(from):]
+		}
+
+		wasRenamed, seen := kept[tag]
+		if seen && (renamed || wasRenamed) {
+			// Drop the repeat with the space before it
+			b.WriteString(strings.TrimSuffix(description[last:m[0]], " "))
+			last, changed = m[1], true
+			continue
+		}
+		kept[tag] = renamed || wasRenamed
+
+		b.WriteString(description[last:m[0]])
+		b.WriteString("@" + tag)
+		last = m[1]
+		changed = changed || renamed && tag != description[m[2]:m[3]]
+	}
+	if !changed {
+		return description, false
+	}
+
+	b.WriteString(description[last:])
+	return strings.TrimSpace(b.String()), true
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		description string
+		want        []string
+	}{
+		{"Buy milk", nil},
+		{"Buy milk @home", []string{"home"}},
+		{"Report @work/backend @work", []string{"work/backend", "work"}},
+		{"Call @home and @home again", []string{"home"}},
+		{"Plan @仕事 and @café", []string{"仕事", "café"}},
+		{"Trailing slash @work/", []string{"work"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := ParseTags(tt.description); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags are %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagAncestors(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"work", []string{"work"}},
+		{"work/backend/api", []string{"work", "work/backend", "work/backend/api"}},
+		{"仕事/会議", []string{"仕事", "仕事/会議"}},
+	}
+
+	for _, tt := range tests {
+		if got := TagAncestors(tt.tag); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ancestors of %q are %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		from, to    string
+		want        string // Empty if nothing changes
+	}{
+		{name: "tag", description: "Weed @garden", from: "garden", to: "yard", want: "Weed @yard"},
+		{name: "nested tags", description: "Mow @garden/lawn @garden", from: "garden", to: "yard", want: "Mow @yard/lawn @yard"},
+		{name: "nested tag only", description: "Mow @garden/lawn @garden", from: "garden/lawn", to: "lawn", want: "Mow @lawn @garden"},
+		{name: "tags that only share a prefix", description: "Paint @gardening", from: "garden", to: "yard"},
+		{name: "unicode", description: "会議 @仕事/会議", from: "仕事", to: "work", want: "会議 @work/会議"},
+		{name: "into a tag", description: "Mow @garden @yard", from: "garden", to: "yard", want: "Mow @yard"},
+		{name: "into a tag before it", description: "Mow @yard @garden now", from: "garden", to: "yard", want: "Mow @yard now"},
+		{name: "into a nested tag", description: "Mow @garden/lawn @yard/lawn", from: "garden", to: "yard", want: "Mow @yard/lawn"},
+		{name: "two tags into one", description: "Mow @garden @lawn", from: "lawn", to: "garden", want: "Mow @garden"},
+		{name: "into its own subtree", description: "Ship @work @work/api", from: "work", to: "work/old", want: "Ship @work/old @work/old/api"},
+		{name: "repeats that are not renamed", description: "Mow @yard @yard", from: "garden", to: "yard"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := RenameTag(tt.description, tt.from, tt.to)
+			want := tt.want
+			if want == "" {
+				want = tt.description
+			}
+			if got != want || changed != (tt.want != "") {
+				t.Errorf("RenameTag(%q, %q, %q) = %q, %v; want %q, %v", tt.description, tt.from, tt.to, got, changed, want, tt.want != "")
+			}
+		})
+	}
+}
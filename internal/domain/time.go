@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeLayout is the format every timestamp is stored in. Times are written
+// in UTC so stored values compare and sort correctly as strings.
+const TimeLayout = time.RFC3339
+
+// FormatTime formats a time for storage
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseTime parses a stored timestamp into local time
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(TimeLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidTimestamp, s)
+	}
+	return t.Local(), nil
+}
@@ -1,7 +1,6 @@
 package domain
 
 import (
-	"regexp"
 	"time"
 )
 
@@ -39,6 +38,18 @@ type Todo struct {
 	IsArchived  bool
 }
 
+// Markers around the matched words in a search snippet
+const (
+	MatchStart = "\x02"
+	MatchEnd   = "\x03"
+)
+
+// SearchResult is a todo found by a search
+type SearchResult struct {
+	Todo    *Todo
+	Snippet string // Description around the matches, each between MatchStart and MatchEnd
+}
+
 // IsDeleted returns true if the todo is soft-deleted
 func (t *Todo) IsDeleted() bool {
 	return t.DeletedAt != nil
@@ -73,9 +84,6 @@ func (t *Todo) IsDueToday() bool {
 		t.DueDate.Day() == now.Day()
 }
 
-// tagRegex matches @tag patterns
-var tagRegex = regexp.MustCompile(`@(\w+)`)
-
 // ExtractTags returns all @tags from the description
 func (t *Todo) ExtractTags() []string {
 	matches := tagRegex.FindAllStringSubmatch(t.Description, -1)
@@ -88,10 +96,11 @@ func (t *Todo) ExtractTags() []string {
 	return tags
 }
 
-// HasTag returns true if the todo has the specified tag
+// HasTag returns true if the todo has the specified tag or one nested
+// under it
 func (t *Todo) HasTag(tag string) bool {
 	for _, t := range t.ExtractTags() {
-		if t == tag {
+		if TagUnder(t, tag) {
 			return true
 		}
 	}
@@ -8,6 +8,7 @@ const (
 	ModeInsert
 	ModeSearch
 	ModeSort
+	ModeTimeTravel
 )
 
 // String returns the string representation of the mode
@@ -21,6 +22,8 @@ func (m Mode) String() string {
 		return "SEARCH"
 	case ModeSort:
 		return "SORT"
+	case ModeTimeTravel:
+		return "PAST"
 	default:
 		return "UNKNOWN"
 	}
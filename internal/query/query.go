@@ -0,0 +1,316 @@
+// Package query parses the search language typed after "/": free text
+// mixed with filters such as tag:work, status:pending, urgency>=3,
+// due<2026-11-01, ws:Backend and archived:yes. A tag filter also matches
+// the tags nested under it.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// Field is what a filter tests
+type Field string
+
+const (
+	FieldTag       Field = "tag"
+	FieldStatus    Field = "status"
+	FieldUrgency   Field = "urgency"
+	FieldDue       Field = "due"
+	FieldWorkspace Field = "ws"
+	FieldArchived  Field = "archived"
+)
+
+// fields lists the filters
+var fields = []Field{FieldTag, FieldStatus, FieldUrgency, FieldDue, FieldWorkspace, FieldArchived}
+
+// Op compares a field with a value
+type Op string
+
+const (
+	OpEq Op = ":" // "=" is read as ":"
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// Values of due: that are not days
+const (
+	DueNone = "none" // No due date
+	DueAny  = "any"  // Any due date
+)
+
+// Values of archived:
+const (
+	ArchivedYes  = "yes"  // Archived todos too
+	ArchivedNo   = "no"   // No archived todos
+	ArchivedOnly = "only" // Archived todos only
+)
+
+// Filter is one field condition
+type Filter struct {
+	Field Field
+	Op    Op
+	Value string    // Normalized value, e.g. "completed" for status:done
+	Level int       // Urgency level for urgency
+	Day   time.Time // Local midnight for due, unless Value is DueNone or DueAny
+}
+
+// Query is a parsed search
+type Query struct {
+	Text    []string // Free text words and quoted phrases
+	Filters []Filter
+}
+
+// IsEmpty reports whether the query has neither text nor filters
+func (q *Query) IsEmpty() bool {
+	return len(q.Text) == 0 && len(q.Filters) == 0
+}
+
+// SyntaxError is a malformed part of a query
+type SyntaxError struct {
+	Pos  int    // Rune offset of Term in the query
+	Term string // The term as typed
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%q: %s", e.Term, e.Msg)
+}
+
+// token is a whitespace-separated term of the query
+type token struct {
+	text string
+	pos  int
+}
+
+// Parse parses a query, reading relative days such as "today" against now
+func Parse(s string, now time.Time) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, tok := range tokens {
+		field, op, value, ok := splitFilter(tok.text)
+		if !ok {
+			text, err := unquote(tok, tok.text)
+			if err != nil {
+				return nil, err
+			}
+			if text != "" {
+				q.Text = append(q.Text, text)
+			}
+			continue
+		}
+
+		filter, err := parseFilter(tok, field, op, value, now)
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+	return q, nil
+}
+
+// tokenize splits s on whitespace outside double quotes
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	start, quoted := -1, false
+
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsSpace(r) && !quoted {
+			if start >= 0 {
+				tokens = append(tokens, token{cur.String(), start})
+				cur.Reset()
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if r == '"' {
+			quoted = !quoted
+		}
+		cur.WriteRune(r)
+	}
+
+	if quoted {
+		return nil, &SyntaxError{Pos: start, Term: cur.String(), Msg: "missing closing quote"}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{cur.String(), start})
+	}
+	return tokens, nil
+}
+
+// splitFilter splits a term like urgency>=3 into its field, operator and
+// value. Terms that do not start with the name of a filter and an
+// operator are text, so "note: call bob" and URLs are searched for as
+// typed.
+func splitFilter(term string) (field, op, value string, ok bool) {
+	i := strings.IndexFunc(term, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i <= 0 || !isField(term[:i]) {
+		return "", "", "", false
+	}
+
+	for _, o := range []string{"<=", ">=", "!=", ":", "=", "<", ">"} {
+		if strings.HasPrefix(term[i:], o) {
+			return term[:i], o, term[i+len(o):], true
+		}
+	}
+	return "", "", "", false
+}
+
+// isField reports whether name, in any case, names a filter
+func isField(name string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(name, string(f)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilter checks a filter and reads its value
+func parseFilter(tok token, field, op, value string, now time.Time) (Filter, error) {
+	fail := func(format string, args ...interface{}) (Filter, error) {
+		return Filter{}, &SyntaxError{Pos: tok.pos, Term: tok.text, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	f := Filter{Field: Field(strings.ToLower(field)), Op: Op(op)}
+	if f.Op == "=" {
+		f.Op = OpEq
+	}
+
+	if f.Op == "!=" {
+		return fail("'!=' is not supported")
+	}
+	if f.Op != OpEq && f.Field != FieldUrgency && f.Field != FieldDue {
+		return fail("%s only takes ':'", f.Field)
+	}
+
+	v, err := unquote(tok, value)
+	if err != nil {
+		return Filter{}, err
+	}
+	if v == "" {
+		return fail("missing value")
+	}
+	lower := strings.ToLower(v)
+
+	switch f.Field {
+	case FieldTag:
+		f.Value = strings.TrimPrefix(v, "@")
+		if !domain.ValidTag(f.Value) {
+			return fail("tags use letters, digits and _, with / between levels")
+		}
+
+	case FieldStatus:
+		switch lower {
+		case "pending", "todo":
+			f.Value = "pending"
+		case "completed", "done":
+			f.Value = "completed"
+		default:
+			return fail("status is pending or completed")
+		}
+
+	case FieldUrgency:
+		levels := map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+		level, ok := levels[lower]
+		if !ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 4 {
+				return fail("urgency is 1-4 or low, medium, high, critical")
+			}
+			level = n
+		}
+		f.Value, f.Level = strconv.Itoa(level), level
+
+	case FieldDue:
+		if lower == DueNone || lower == DueAny {
+			if f.Op != OpEq {
+				return fail("due:%s only takes ':'", lower)
+			}
+			f.Value = lower
+			break
+		}
+		day, ok := parseDay(lower, now)
+		if !ok {
+			return fail("due is a date (2006-01-02), today, tomorrow, yesterday, a number of days or weeks from today (3d, 2w), none or any")
+		}
+		f.Value, f.Day = day.Format("2006-01-02"), day
+
+	case FieldWorkspace:
+		f.Value = v
+
+	case FieldArchived:
+		switch lower {
+		case "yes", "y", "true", "include":
+			f.Value = ArchivedYes
+		case "no", "n", "false", "exclude":
+			f.Value = ArchivedNo
+		case "only":
+			f.Value = ArchivedOnly
+		default:
+			return fail("archived is yes, no or only")
+		}
+	}
+
+	return f, nil
+}
+
+// parseDay reads a day as local midnight
+func parseDay(s string, now time.Time) (time.Time, bool) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	switch s {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, true
+	}
+
+	// Days or weeks from today
+	if n := len(s); n >= 2 {
+		if v, err := strconv.Atoi(s[:n-1]); err == nil {
+			switch s[n-1] {
+			case 'd':
+				return today.AddDate(0, 0, v), true
+			case 'w':
+				return today.AddDate(0, 0, 7*v), true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// unquote removes the double quotes around a value or phrase
+func unquote(tok token, s string) (string, error) {
+	if !strings.Contains(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' || strings.Contains(s[1:len(s)-1], `"`) {
+		return "", &SyntaxError{Pos: tok.pos, Term: tok.text, Msg: "quote the whole value, e.g. ws:\"Old child\""}
+	}
+	return s[1 : len(s)-1], nil
+}
@@ -0,0 +1,85 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		input   string
+		text    []string
+		filters []Filter
+	}{
+		{input: "buy milk", text: []string{"buy", "milk"}},
+		{input: `"buy milk" today`, text: []string{"buy milk", "today"}},
+		{input: "tag:work", filters: []Filter{{Field: FieldTag, Op: OpEq, Value: "work"}}},
+		{input: "TAG:@home/garden", filters: []Filter{{Field: FieldTag, Op: OpEq, Value: "home/garden"}}},
+		{input: "status:done", filters: []Filter{{Field: FieldStatus, Op: OpEq, Value: "completed"}}},
+		{input: "urgency>=high", filters: []Filter{{Field: FieldUrgency, Op: OpGe, Value: "3", Level: 3}}},
+		{input: "due<2w", filters: []Filter{{Field: FieldDue, Op: OpLt, Value: "2026-03-24", Day: day(2026, 3, 24)}}},
+		{input: "due=none", filters: []Filter{{Field: FieldDue, Op: OpEq, Value: DueNone}}},
+		{input: `ws:"Side projects"`, filters: []Filter{{Field: FieldWorkspace, Op: OpEq, Value: "Side projects"}}},
+		{input: "archived:only", filters: []Filter{{Field: FieldArchived, Op: OpEq, Value: ArchivedOnly}}},
+		{
+			input:   "report tag:work",
+			text:    []string{"report"},
+			filters: []Filter{{Field: FieldTag, Op: OpEq, Value: "work"}},
+		},
+
+		// Terms that only look like filters are text
+		{input: "note: call bob", text: []string{"note:", "call", "bob"}},
+		{input: "https://example.com/a", text: []string{"https://example.com/a"}},
+		{input: "re:invoice", text: []string{"re:invoice"}},
+		{input: "a<b", text: []string{"a<b"}},
+		{input: "10:30 standup", text: []string{"10:30", "standup"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			q, err := Parse(tt.input, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.Text, tt.text) {
+				t.Errorf("text is %q, want %q", q.Text, tt.text)
+			}
+			if !reflect.DeepEqual(q.Filters, tt.filters) {
+				t.Errorf("filters are %+v, want %+v", q.Filters, tt.filters)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		term  string
+	}{
+		{input: `"buy milk`, term: `"buy milk`},
+		{input: "milk status:maybe", term: "status:maybe"},
+		{input: "urgency:9", term: "urgency:9"},
+		{input: "tag>work", term: "tag>work"},
+		{input: "status!=done", term: "status!=done"},
+		{input: "due:someday", term: "due:someday"},
+		{input: "tag:", term: "tag:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input, time.Now())
+			var syntax *SyntaxError
+			if !errors.As(err, &syntax) {
+				t.Fatalf("got %v, want a syntax error", err)
+			}
+			if syntax.Term != tt.term {
+				t.Errorf("error is about %q, want %q", syntax.Term, tt.term)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Applier writes WAL operations to the main tables
+type Applier struct {
+	db *DB
+}
+
+// NewApplier creates a new applier
+func NewApplier(db *DB) *Applier {
+	return &Applier{db: db}
+}
+
+// Apply brings the main tables to the After state of each operation, in order.
+// Applying the same operation twice leaves the tables unchanged. An
+// operation whose rows were changed since it was planned fails with
+// domain.ErrConflict, and nothing is written.
+func (a *Applier) Apply(ops []*wal.Operation) error {
+	ctx := context.Background()
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := a.ApplyIn(tx, ops); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApplyIn is Apply inside tx. It is meant for wal.Redo, which marks the
+// operations redone in the same transaction.
+func (a *Applier) ApplyIn(tx *sql.Tx, ops []*wal.Operation) error {
+	ctx := context.Background()
+
+	for _, op := range ops {
+		if err := applyChecked(ctx, tx, op, false); err != nil {
+			return fmt.Errorf("failed to apply op %d: %w", op.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// RevertIn restores the Before state of each operation in tx, in the
+// given order: deleted rows come back with their closure rows, edits are
+// rolled back, moved nodes return to their old parent and position, and
+// created rows are removed. Pass operations newest first. Reverting fails
+// with domain.ErrConflict if the rows no longer hold the After state, for
+// example because another process changed them. It is meant for
+// wal.Undo, which marks the operations undone in the same transaction.
+func (a *Applier) RevertIn(tx *sql.Tx, ops []*wal.Operation) error {
+	ctx := context.Background()
+
+	for _, op := range ops {
+		if err := applyChecked(ctx, tx, op, true); err != nil {
+			return fmt.Errorf("failed to revert op %d: %w", op.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// applyOperation moves the rows touched by op from one side of its payload
+// to the other. With reverse set it restores the Before state.
+func applyOperation(ctx context.Context, q querier, op *wal.Operation, reverse bool) error {
+	from, to := op.Payload.Before, op.Payload.After
+	if reverse {
+		from, to = to, from
+	}
+
+	switch op.EntityType {
+	case wal.EntityTodo:
+		var fromSnap, toSnap *TodoSnapshot
+		if err := decodeSnapshot(from, &fromSnap); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toSnap); err != nil {
+			return err
+		}
+		return applyTodoSnapshot(ctx, q, fromSnap, toSnap)
+
+	case wal.EntityWorkspace:
+		var fromSnap, toSnap *WorkspaceSnapshot
+		if err := decodeSnapshot(from, &fromSnap); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toSnap); err != nil {
+			return err
+		}
+		return applyWorkspaceSnapshot(ctx, q, fromSnap, toSnap)
+
+	case wal.EntitySavedView:
+		var fromRec, toRec *SavedViewRecord
+		if err := decodeSnapshot(from, &fromRec); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toRec); err != nil {
+			return err
+		}
+		return applySavedViewSnapshot(ctx, q, fromRec, toRec)
+	}
+
+	return fmt.Errorf("%w: unknown entity type %q", domain.ErrInvalidOperation, op.EntityType)
+}
+
+// recordOperation logs a change in the WAL and applies it right away,
+// so callers read their own writes. The operation joins the undo group
+// carried by ctx. Callers take the WAL lock before they read the rows
+// they snapshot; if the rows still changed before the operation was
+// applied, it is dropped and recordOperation fails with domain.ErrConflict.
+// If applying fails and will be retried, it fails with
+// domain.ErrWritePending: the change is logged and may still be saved.
+func recordOperation(ctx context.Context, w *wal.WAL, entity wal.EntityType, opType wal.OperationType, id string, before, after interface{}) error {
+	ctx, unlock := w.Lock(ctx)
+	defer unlock()
+
+	payload, err := newPayload(before, after)
+	if err != nil {
+		return err
+	}
+
+	op := &wal.Operation{
+		OperationType: opType,
+		EntityType:    entity,
+		EntityID:      id,
+		Payload:       payload,
+		UndoGroupID:   wal.UndoGroupFromContext(ctx),
+		System:        wal.IsSystem(ctx),
+	}
+
+	if err := w.Append(op); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrWriteFailed, err)
+	}
+	if err := w.Flush(); err != nil {
+		// A flush that will be retried has not failed yet
+		var fe *wal.FlushError
+		if errors.As(err, &fe) && fe.RetryIn > 0 {
+			return fmt.Errorf("%w: %v", domain.ErrWritePending, err)
+		}
+		return fmt.Errorf("%w: %v", domain.ErrWriteFailed, err)
+	}
+	if op.Rejected != nil {
+		return op.Rejected
+	}
+
+	return nil
+}
+
+// newPayload encodes the before and after snapshots of an operation.
+// A nil snapshot is left out of the payload.
+func newPayload(before, after interface{}) (wal.Payload, error) {
+	var p wal.Payload
+	var err error
+
+	if p.Before, err = encodeSnapshot(before); err != nil {
+		return p, err
+	}
+	if p.After, err = encodeSnapshot(after); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func encodeSnapshot(snap interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// decodeSnapshot decodes a payload snapshot, leaving dst nil when absent
+func decodeSnapshot(raw json.RawMessage, dst interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return nil
+}
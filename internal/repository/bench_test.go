@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// The benchmarks time the read and move paths on a database seeded with
+// a forest of todos spread over a few workspaces. Seeding writes the rows
+// directly; the measured operations go through the repositories as the
+// app calls them. The database is seeded once and shared by every
+// benchmark, e.g.
+//
+//	go test -tags sqlite_fts5 ./internal/repository -run '^$' -bench 100k
+
+const (
+	benchTodos      = 100000
+	benchWorkspaces = 10
+)
+
+var bench struct {
+	once    sync.Once
+	dir     string
+	store   *testStore
+	fixture *benchFixture
+	err     error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if bench.store != nil {
+		bench.store.wal.Close()
+		bench.store.db.Close()
+	}
+	if bench.dir != "" {
+		os.RemoveAll(bench.dir)
+	}
+	os.Exit(code)
+}
+
+// benchStore returns the seeded database, seeding it on first use
+func benchStore(b *testing.B) (*testStore, *benchFixture) {
+	b.Helper()
+	bench.once.Do(func() {
+		if bench.dir, bench.err = os.MkdirTemp("", "lazytodo-bench-"); bench.err != nil {
+			return
+		}
+		bench.store, bench.fixture, bench.err = seedBenchStore(filepath.Join(bench.dir, "bench.db"))
+	})
+	if bench.err != nil {
+		b.Fatalf("failed to seed: %v", bench.err)
+	}
+	b.ResetTimer()
+	return bench.store, bench.fixture
+}
+
+func BenchmarkGetByWorkspace100k(b *testing.B) {
+	s, f := benchStore(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := s.todos.GetByWorkspace(context.Background(), f.workspaces[0], false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetByWorkspaceWithArchived100k(b *testing.B) {
+	s, f := benchStore(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := s.todos.GetByWorkspace(context.Background(), f.workspaces[0], true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearch100k(b *testing.B) {
+	s, _ := benchStore(b)
+	queries := []struct{ name, query string }{
+		{"common word", "report"},
+		{"rare words", "quarterly invoice"},
+		{"filters", "tag:work urgency>=3 status:pending"},
+		{"text and filters", "review due<2w"},
+	}
+	for _, q := range queries {
+		b.Run(q.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.todos.Search(context.Background(), q.query, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetCompletedBefore100k(b *testing.B) {
+	s, _ := benchStore(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := s.todos.GetCompletedBefore(context.Background(), time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMoveSubtree100k(b *testing.B) {
+	s, f := benchStore(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		id, parentID := f.pickMove()
+		if err := s.todos.Move(wal.WithUndoGroup(ctx), id, parentID, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMoveSubtreeToAnotherWorkspace100k(b *testing.B) {
+	s, f := benchStore(b)
+	ctx := context.Background()
+	home := f.workspaces[0]
+	for i := 0; i < b.N; i++ {
+		id, _ := f.pickMove()
+		f.parent[id] = ""
+		to := f.workspaces[f.rng.Intn(len(f.workspaces))]
+		if err := s.todos.Move(wal.WithUndoGroup(ctx), id, "", to); err != nil {
+			b.Fatal(err)
+		}
+		// Put it back so the first workspace keeps its size
+		if err := s.todos.Move(wal.WithUndoGroup(ctx), id, "", home); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchFixture is what the benchmarks need to know about the seeded data
+type benchFixture struct {
+	rng        *rand.Rand
+	workspaces []string
+	todos      map[string][]string // All todos per workspace
+	parent     map[string]string
+}
+
+// pickMove picks a todo of the first workspace and a new parent for it
+// outside its subtree, or the top level
+func (f *benchFixture) pickMove() (id, parentID string) {
+	todos := f.todos[f.workspaces[0]]
+	for {
+		id = todos[f.rng.Intn(len(todos))]
+		if f.rng.Intn(4) == 0 {
+			f.parent[id] = ""
+			return id, ""
+		}
+		parentID = todos[f.rng.Intn(len(todos))]
+		if !within(f.parent, id, parentID) {
+			f.parent[id] = parentID
+			return id, parentID
+		}
+	}
+}
+
+// benchWords make up the generated descriptions. The first ones are
+// common, the last ones rare.
+var benchWords = []string{
+	"report", "review", "update", "call", "plan", "write", "fix", "check",
+	"draft", "send", "prepare", "meeting", "notes", "budget", "design",
+	"release", "deploy", "test", "docs", "email", "quarterly", "invoice",
+}
+
+var benchTags = []string{"work", "home", "urgent", "later", "team"}
+
+// benchMaxDepth bounds how deep the generated trees get
+const benchMaxDepth = 6
+
+// seedBenchStore opens a database at path, creates the workspaces through
+// the repository, then writes the todos with their closure and tag rows
+// in a single transaction
+func seedBenchStore(path string) (*testStore, *benchFixture, error) {
+	db, err := NewDB(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	s := &testStore{db: db, applier: NewApplier(db)}
+	s.wal = wal.New(db.DB, wal.Config{ApplyFunc: s.applier.Apply})
+	s.workspaces = NewWorkspaceRepository(db, s.wal)
+	s.todos = NewTodoRepository(db, s.wal)
+
+	f, err := seedBenchTodos(context.Background(), s)
+	if err != nil {
+		s.wal.Close()
+		db.Close()
+		return nil, nil, err
+	}
+	return s, f, nil
+}
+
+func seedBenchTodos(ctx context.Context, s *testStore) (*benchFixture, error) {
+	rng := rand.New(rand.NewSource(1))
+	f := &benchFixture{
+		rng:    rng,
+		todos:  make(map[string][]string),
+		parent: make(map[string]string),
+	}
+	for i := 0; i < benchWorkspaces; i++ {
+		ws := &domain.Workspace{ID: fmt.Sprintf("ws-%02d", i), Name: fmt.Sprintf("Workspace %d", i)}
+		if err := s.workspaces.Create(ctx, ws); err != nil {
+			return nil, err
+		}
+		f.workspaces = append(f.workspaces, ws.ID)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insertTodo, err := tx.PrepareContext(ctx, `
+		INSERT INTO todos (id, workspace_id, description, position, status, urgency,
+			due_date, created_at, updated_at, completed_at, is_archived)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer insertTodo.Close()
+	insertClosure, err := tx.PrepareContext(ctx, `
+		INSERT INTO todo_closure (ancestor_id, descendant_id, depth) VALUES (?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer insertClosure.Close()
+	insertTag, err := tx.PrepareContext(ctx, `INSERT INTO todo_tags (todo_id, tag) VALUES (?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer insertTag.Close()
+
+	now := time.Now()
+	ancestors := make(map[string][]string) // Nearest first
+	children := make(map[string]int)
+	for i := 0; i < benchTodos; i++ {
+		id := fmt.Sprintf("todo-%06d", i)
+		ws := f.workspaces[i%len(f.workspaces)]
+
+		// Half the todos go under an earlier todo of the same workspace
+		var parentID string
+		if peers := f.todos[ws]; len(peers) > 0 && rng.Intn(2) == 0 {
+			p := peers[len(peers)-1-rng.Intn(min(len(peers), 50))]
+			if len(ancestors[p]) < benchMaxDepth-1 {
+				parentID = p
+			}
+		}
+		position := children[parentID+"/"+ws]
+		children[parentID+"/"+ws]++
+
+		created := now.Add(-time.Duration(rng.Intn(365*24)) * time.Hour)
+		status, completedAt, archived := domain.StatusPending, sql.NullString{}, false
+		if rng.Intn(4) == 0 {
+			status = domain.StatusCompleted
+			completedAt = sql.NullString{String: domain.FormatTime(created.Add(time.Hour)), Valid: true}
+			archived = rng.Intn(2) == 0
+		}
+		var due sql.NullString
+		if rng.Intn(3) == 0 {
+			due = sql.NullString{String: domain.FormatTime(now.AddDate(0, 0, rng.Intn(60)-20)), Valid: true}
+		}
+
+		desc := describeBenchTodo(rng)
+		_, err := insertTodo.ExecContext(ctx, id, ws, desc, position, status, 1+rng.Intn(4),
+			due, domain.FormatTime(created), domain.FormatTime(created), completedAt, archived)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range domain.ParseTags(desc) {
+			if _, err := insertTag.ExecContext(ctx, id, tag); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := insertClosure.ExecContext(ctx, id, id, 0); err != nil {
+			return nil, err
+		}
+		if parentID != "" {
+			ancestors[id] = append([]string{parentID}, ancestors[parentID]...)
+			for depth, a := range ancestors[id] {
+				if _, err := insertClosure.ExecContext(ctx, a, id, depth+1); err != nil {
+					return nil, err
+				}
+			}
+			f.parent[id] = parentID
+		}
+		f.todos[ws] = append(f.todos[ws], id)
+	}
+
+	return f, tx.Commit()
+}
+
+// describeBenchTodo makes up a description of a few words, some of them
+// tags
+func describeBenchTodo(rng *rand.Rand) string {
+	n := 2 + rng.Intn(5)
+	desc := ""
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			desc += " "
+		}
+		// Favour the common words
+		desc += benchWords[rng.Intn(1+rng.Intn(len(benchWords)))]
+	}
+	if rng.Intn(3) == 0 {
+		desc += " @" + benchTags[rng.Intn(len(benchTags))]
+	}
+	return desc
+}
@@ -0,0 +1,463 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// An operation is planned from rows read before it is logged, and applied
+// after. Writers in this process hold the WAL lock from the read to the
+// apply, but another process, or an operation waiting for a retry, can
+// still change the rows in between. So the applier checks, in the
+// transaction that writes the operation, that its rows still hold the
+// state it was planned from, and rejects it with domain.ErrConflict
+// otherwise rather than overwrite a change it never saw.
+
+// applyChecked applies op like applyOperation once its rows are checked.
+// Rows that already hold the target state were written before a crash,
+// and the operation is skipped.
+func applyChecked(ctx context.Context, q querier, op *wal.Operation, reverse bool) error {
+	from, to := op.Payload.Before, op.Payload.After
+	if reverse {
+		from, to = to, from
+	}
+
+	var done bool
+	var err error
+	switch op.EntityType {
+	case wal.EntityTodo:
+		var fromSnap, toSnap *TodoSnapshot
+		if err := decodeSnapshot(from, &fromSnap); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toSnap); err != nil {
+			return err
+		}
+		done, err = checkTodoOperation(ctx, q, op, fromSnap, toSnap, reverse)
+
+	case wal.EntityWorkspace:
+		var fromSnap, toSnap *WorkspaceSnapshot
+		if err := decodeSnapshot(from, &fromSnap); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toSnap); err != nil {
+			return err
+		}
+		done, err = checkWorkspaceOperation(ctx, q, op, fromSnap, toSnap, reverse)
+
+	case wal.EntitySavedView:
+		var fromRec, toRec *SavedViewRecord
+		if err := decodeSnapshot(from, &fromRec); err != nil {
+			return err
+		}
+		if err := decodeSnapshot(to, &toRec); err != nil {
+			return err
+		}
+		done, err = checkSavedViewOperation(ctx, q, op, fromRec, toRec)
+	}
+	if err != nil || done {
+		return err
+	}
+
+	return applyOperation(ctx, q, op, reverse)
+}
+
+// conflictError is the error of an operation whose rows changed since it
+// was planned
+func conflictError(op *wal.Operation) error {
+	return fmt.Errorf("%w: the %s changed before this change could be saved, try again", domain.ErrConflict, op.EntityType)
+}
+
+// checkTodoOperation reports true if the rows of a todo operation already
+// hold its target state, and fails if they hold neither state. A delete
+// also fails if the subtree gained or lost active todos, and a move if it
+// no longer makes a valid tree.
+func checkTodoOperation(ctx context.Context, q querier, op *wal.Operation, from, to *TodoSnapshot, reverse bool) (bool, error) {
+	ids := unionIDs(from.IDs(), to.IDs())
+	current, err := loadTodoSnapshot(ctx, q, ids)
+	if err != nil {
+		return false, err
+	}
+
+	if ok, err := todosMatch(current, to, ids); err != nil || ok {
+		return ok, err
+	}
+	if ok, err := todosMatch(current, from, ids); err != nil || !ok {
+		return false, orConflict(err, op)
+	}
+
+	if op.OperationType == wal.OpDelete && !reverse {
+		active, err := loadActiveSubtreeIDs(ctx, q, "todos", "todo_closure", op.EntityID)
+		if err != nil {
+			return false, err
+		}
+		if !sameIDs(active, from.IDs()) {
+			return false, conflictError(op)
+		}
+	}
+	if op.OperationType == wal.OpMove {
+		if err := checkTodoMove(ctx, q, op, to); err != nil {
+			return false, err
+		}
+	}
+
+	if to != nil {
+		ok, err := ancestryMatches(ctx, q, "todo_closure", to.IDs(), to.Closure)
+		if err != nil || !ok {
+			return false, orConflict(err, op)
+		}
+	}
+	return false, nil
+}
+
+// checkWorkspaceOperation reports true if the rows of a workspace
+// operation, and of the todos it carries, already hold its target state,
+// and fails if they hold neither state. A delete also fails if the
+// workspaces or todos it would send to the trash are no longer the same,
+// and a move if it no longer makes a valid tree.
+func checkWorkspaceOperation(ctx context.Context, q querier, op *wal.Operation, from, to *WorkspaceSnapshot, reverse bool) (bool, error) {
+	ids := unionIDs(from.IDs(), to.IDs())
+	current, err := loadWorkspaceSnapshot(ctx, q, ids)
+	if err != nil {
+		return false, err
+	}
+	todoIDs := unionIDs(from.todos().IDs(), to.todos().IDs())
+	if current.Todos, err = loadTodoSnapshot(ctx, q, todoIDs); err != nil {
+		return false, err
+	}
+
+	if ok, err := workspacesMatch(current, to, ids, todoIDs); err != nil || ok {
+		return ok, err
+	}
+	if ok, err := workspacesMatch(current, from, ids, todoIDs); err != nil || !ok {
+		return false, orConflict(err, op)
+	}
+
+	if op.OperationType == wal.OpDelete && !reverse {
+		active, activeTodos, err := loadDeletionIDs(ctx, q, op.EntityID)
+		if err != nil {
+			return false, err
+		}
+		if !sameIDs(active, from.IDs()) || !sameIDs(activeTodos, from.todos().IDs()) {
+			return false, conflictError(op)
+		}
+	}
+	if op.OperationType == wal.OpMove {
+		if err := checkWorkspaceMove(ctx, q, op, to); err != nil {
+			return false, err
+		}
+	}
+
+	if to != nil {
+		ok, err := ancestryMatches(ctx, q, "workspace_closure", to.IDs(), to.Closure)
+		if err == nil && ok && to.Todos != nil {
+			ok, err = ancestryMatches(ctx, q, "todo_closure", to.Todos.IDs(), to.Todos.Closure)
+		}
+		if err != nil || !ok {
+			return false, orConflict(err, op)
+		}
+	}
+	return false, nil
+}
+
+// checkTodoMove checks, as the move is written, what planning it checked:
+// the subtree still holds the todos it moves, and the parent it lands
+// under is active, outside the subtree and in the todo's workspace, which
+// is active too. Undoing a move is checked the same way.
+func checkTodoMove(ctx context.Context, q querier, op *wal.Operation, to *TodoSnapshot) error {
+	root := findTodoRecord(to, op.EntityID)
+	if root == nil {
+		return nil
+	}
+	ids := to.IDs()
+	if parentID := parentOf(to.Closure, op.EntityID); parentID != "" {
+		if err := checkNotUnder(ctx, q, "todo_closure", parentID, ids, root.Description); err != nil {
+			return err
+		}
+		parent, err := loadTodoSnapshot(ctx, q, []string{parentID})
+		if err != nil {
+			return err
+		}
+		if len(parent.Todos) == 0 || parent.Todos[0].DeletedAt != nil {
+			return moveError(domain.ErrInvalidOperation, "the parent of %s is in the trash", quote(root.Description))
+		}
+		if parent.Todos[0].WorkspaceID != root.WorkspaceID {
+			return moveError(domain.ErrInvalidOperation, "the parent %s is in another workspace", quote(parent.Todos[0].Description))
+		}
+	}
+
+	ws, err := loadWorkspaceSnapshot(ctx, q, []string{root.WorkspaceID})
+	if err != nil {
+		return err
+	}
+	if len(ws.Workspaces) == 0 || ws.Workspaces[0].DeletedAt != nil {
+		return moveError(domain.ErrInvalidOperation, "the workspace of %s is in the trash", quote(root.Description))
+	}
+
+	return checkSubtree(ctx, q, "todo_closure", op, ids)
+}
+
+// checkWorkspaceMove checks, as the move is written, that the subtree
+// still holds the workspaces it moves and that the parent it lands under
+// is active and outside the subtree
+func checkWorkspaceMove(ctx context.Context, q querier, op *wal.Operation, to *WorkspaceSnapshot) error {
+	root := findWorkspaceRecord(to, op.EntityID)
+	if root == nil {
+		return nil
+	}
+	ids := to.IDs()
+	if parentID := parentOf(to.Closure, op.EntityID); parentID != "" {
+		if err := checkNotUnder(ctx, q, "workspace_closure", parentID, ids, root.Name); err != nil {
+			return err
+		}
+		parent, err := loadWorkspaceSnapshot(ctx, q, []string{parentID})
+		if err != nil {
+			return err
+		}
+		if len(parent.Workspaces) == 0 || parent.Workspaces[0].DeletedAt != nil {
+			return moveError(domain.ErrInvalidOperation, "the parent of %s is in the trash", quote(root.Name))
+		}
+	}
+
+	return checkSubtree(ctx, q, "workspace_closure", op, ids)
+}
+
+// checkSubtree fails if the node moved by op has gained or lost
+// descendants since the move was planned; their closure rows would not
+// follow it
+func checkSubtree(ctx context.Context, q querier, closure string, op *wal.Operation, ids []string) error {
+	current, err := loadSubtreeIDs(ctx, q, closure, op.EntityID)
+	if err != nil {
+		return err
+	}
+	if !sameIDs(current, ids) {
+		return conflictError(op)
+	}
+	return nil
+}
+
+// checkNotUnder fails if parentID is one of ids, the moved subtree, or
+// hangs under one of them
+func checkNotUnder(ctx context.Context, q querier, closure, parentID string, ids []string, name string) error {
+	ancestors, err := loadClosure(ctx, q, closure, []string{parentID})
+	if err != nil {
+		return err
+	}
+	for _, c := range ancestors {
+		if slices.Contains(ids, c.AncestorID) {
+			return moveError(domain.ErrCircularReference, "%s cannot be moved under itself or its own subtree", quote(name))
+		}
+	}
+	return nil
+}
+
+// moveError is the error of a move that is no longer valid. It is a
+// conflict, so the WAL drops the move instead of retrying it.
+func moveError(reason error, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %w: %s", domain.ErrConflict, reason, fmt.Sprintf(format, args...))
+}
+
+// checkSavedViewOperation reports true if the view already holds the
+// target state, and fails if it holds neither state
+func checkSavedViewOperation(ctx context.Context, q querier, op *wal.Operation, from, to *SavedViewRecord) (bool, error) {
+	id := op.EntityID
+	if to != nil {
+		id = to.ID
+	} else if from != nil {
+		id = from.ID
+	}
+
+	current, err := loadSavedView(ctx, q, id)
+	if err != nil {
+		return false, err
+	}
+	if reflect.DeepEqual(current, to) {
+		return true, nil
+	}
+	if !reflect.DeepEqual(current, from) {
+		return false, conflictError(op)
+	}
+	return false, nil
+}
+
+// todosMatch reports whether current, the stored rows of ids, are exactly
+// want: its todos as recorded with their closure rows, and nothing for
+// the other ids
+func todosMatch(current, want *TodoSnapshot, ids []string) (bool, error) {
+	if want == nil {
+		want = &TodoSnapshot{}
+	}
+
+	recorded := make(map[string]TodoRecord, len(want.Todos))
+	for _, t := range want.Todos {
+		t, err := t.canonical()
+		if err != nil {
+			return false, err
+		}
+		recorded[t.ID] = t
+	}
+	stored := make(map[string]TodoRecord, len(current.Todos))
+	for _, t := range current.Todos {
+		t, err := t.canonical()
+		if err != nil {
+			return false, err
+		}
+		stored[t.ID] = t
+	}
+
+	for _, id := range ids {
+		r, inWant := recorded[id]
+		s, inStore := stored[id]
+		if inWant != inStore || !reflect.DeepEqual(r, s) {
+			return false, nil
+		}
+	}
+	return sameClosure(current.Closure, want.Closure), nil
+}
+
+// workspacesMatch reports whether current, the stored rows of ids and of
+// the todos in todoIDs, are exactly want. Whether a workspace is expanded
+// is not logged state, so it is not compared.
+func workspacesMatch(current, want *WorkspaceSnapshot, ids, todoIDs []string) (bool, error) {
+	if want == nil {
+		want = &WorkspaceSnapshot{}
+	}
+
+	recorded := make(map[string]WorkspaceRecord, len(want.Workspaces))
+	for _, w := range want.Workspaces {
+		w, err := w.canonical()
+		if err != nil {
+			return false, err
+		}
+		w.IsExpanded = false
+		recorded[w.ID] = w
+	}
+	stored := make(map[string]WorkspaceRecord, len(current.Workspaces))
+	for _, w := range current.Workspaces {
+		w, err := w.canonical()
+		if err != nil {
+			return false, err
+		}
+		w.IsExpanded = false
+		stored[w.ID] = w
+	}
+
+	for _, id := range ids {
+		r, inWant := recorded[id]
+		s, inStore := stored[id]
+		if inWant != inStore || !reflect.DeepEqual(r, s) {
+			return false, nil
+		}
+	}
+	if !sameClosure(current.Closure, want.Closure) {
+		return false, nil
+	}
+	return todosMatch(current.Todos, want.Todos, todoIDs)
+}
+
+// ancestryMatches reports whether every node of a snapshot whose parent is
+// outside it still hangs under that parent's ancestors as the snapshot's
+// closure rows say. Creates and moves compute those rows from the
+// parent's own rows when they are planned; if the parent moved since,
+// writing them would break the tree.
+func ancestryMatches(ctx context.Context, q querier, table string, ids []string, closure []ClosureRecord) (bool, error) {
+	inside := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		inside[id] = true
+	}
+
+	parents := make(map[string]string) // Node -> parent outside the snapshot
+	var parentIDs []string
+	above := make(map[string][]ClosureRecord) // Node -> its rows to ancestors
+	for _, c := range closure {
+		if c.Depth == 0 {
+			continue
+		}
+		above[c.DescendantID] = append(above[c.DescendantID], c)
+		if c.Depth == 1 && !inside[c.AncestorID] {
+			parents[c.DescendantID] = c.AncestorID
+			parentIDs = append(parentIDs, c.AncestorID)
+		}
+	}
+	if len(parents) == 0 {
+		return true, nil
+	}
+
+	rows, err := loadClosure(ctx, q, table, parentIDs)
+	if err != nil {
+		return false, err
+	}
+	chains := make(map[string][]ClosureRecord)
+	for _, r := range rows {
+		chains[r.DescendantID] = append(chains[r.DescendantID], r)
+	}
+
+	for node, parent := range parents {
+		var want []ClosureRecord
+		for _, p := range chains[parent] {
+			want = append(want, ClosureRecord{AncestorID: p.AncestorID, DescendantID: node, Depth: p.Depth + 1})
+		}
+		if !sameClosure(want, above[node]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// orConflict returns err, or the conflict error of op when err is nil
+func orConflict(err error, op *wal.Operation) error {
+	if err != nil {
+		return err
+	}
+	return conflictError(op)
+}
+
+// sameClosure reports whether a and b hold the same rows, in any order
+func sameClosure(a, b []ClosureRecord) bool {
+	set := make(map[ClosureRecord]bool, len(a))
+	for _, c := range a {
+		set[c] = true
+	}
+	other := make(map[ClosureRecord]bool, len(b))
+	for _, c := range b {
+		if !set[c] {
+			return false
+		}
+		other[c] = true
+	}
+	return len(set) == len(other)
+}
+
+// sameIDs reports whether a and b hold the same IDs, in any order
+func sameIDs(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+		other[id] = true
+	}
+	return len(set) == len(other)
+}
+
+// unionIDs returns the IDs in a or b, each once
+func unionIDs(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var ids []string
+	for _, id := range append(append([]string(nil), a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+func TestStaleUpdateIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	todo := s.todo(t, ws.ID, "", "Buy milk")
+
+	// Planned before the rename below, applied after it
+	before, err := loadTodoSnapshot(ctx, s.db, []string{todo.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := before.clone()
+	after.Todos[0].Urgency = domain.UrgencyHigh
+
+	renamed := s.get(t, todo.ID)
+	renamed.Description = "Buy oat milk"
+	if err := s.todos.Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	logged := s.logSize(t)
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpUpdate, todo.ID, before, after)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("stale update: got %v, want %v", err, domain.ErrConflict)
+	}
+
+	got := s.get(t, todo.ID)
+	if got.Description != "Buy oat milk" || got.Urgency != domain.UrgencyLow {
+		t.Errorf("todo is %q with urgency %d, want the rename kept and the stale update dropped", got.Description, got.Urgency)
+	}
+	if n := s.logSize(t); n != logged {
+		t.Errorf("log has %d operations, want the rejected one dropped (%d)", n, logged)
+	}
+
+	// Undo still reverts the rename, not the rejected update
+	s.undo(t)
+	if got := s.get(t, todo.ID); got.Description != "Buy milk" {
+		t.Errorf("after undo the todo is %q, want %q", got.Description, "Buy milk")
+	}
+}
+
+func TestStaleDeleteIsRejectedWhenTheSubtreeGrew(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	plan := s.todo(t, ws.ID, "", "Plan")
+
+	ids, err := loadActiveSubtreeIDs(ctx, s.db, "todos", "todo_closure", plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := loadTodoSnapshot(ctx, s.db, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := before.clone()
+	now := domain.FormatTime(plan.CreatedAt)
+	after.Todos[0].DeletedAt = &now
+
+	child := s.todo(t, ws.ID, plan.ID, "Step one")
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpDelete, plan.ID, before, after)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("stale delete: got %v, want %v", err, domain.ErrConflict)
+	}
+	if s.get(t, plan.ID).IsDeleted() || s.get(t, child.ID).IsDeleted() {
+		t.Error("the stale delete reached the todos")
+	}
+	s.checkIntegrity(t)
+}
+
+func TestStaleWorkspaceDeleteIsRejectedWhenATodoWasAdded(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	home := s.workspace(t, "Home", "")
+	garden := s.workspace(t, "Garden", home.ID)
+	s.todo(t, garden.ID, "", "Weed the beds")
+
+	ids, todoIDs, err := loadDeletionIDs(ctx, s.db, home.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := loadWorkspaceSnapshot(ctx, s.db, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Todos, err = loadTodoSnapshot(ctx, s.db, todoIDs); err != nil {
+		t.Fatal(err)
+	}
+	after := before.clone()
+	now := domain.FormatTime(home.CreatedAt)
+	for i := range after.Workspaces {
+		after.Workspaces[i].DeletedAt = &now
+	}
+	for i := range after.Todos.Todos {
+		after.Todos.Todos[i].DeletedAt = &now
+	}
+
+	added := s.todo(t, garden.ID, "", "Mow the lawn")
+
+	err = recordOperation(ctx, s.wal, wal.EntityWorkspace, wal.OpDelete, home.ID, before, after)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("stale delete: got %v, want %v", err, domain.ErrConflict)
+	}
+	if s.get(t, added.ID).IsDeleted() {
+		t.Error("the todo added after the delete was planned went to the trash")
+	}
+	if _, err := s.workspaces.GetByID(ctx, garden.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateUnderAMovedParentIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	plan := s.todo(t, ws.ID, "", "Plan")
+	chores := s.todo(t, ws.ID, "", "Chores")
+
+	// The closure rows of the new todo are computed under Plan at the top
+	child := &domain.Todo{WorkspaceID: ws.ID, ParentID: plan.ID, Description: "Step one", Status: domain.StatusPending}
+	after, err := newTodoSnapshot(ctx, s.db, child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.todos.Move(ctx, plan.ID, chores.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpCreate, child.ID, nil, after)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("create under a moved parent: got %v, want %v", err, domain.ErrConflict)
+	}
+	s.checkIntegrity(t)
+}
+
+func TestApplyingTwiceChangesNothing(t *testing.T) {
+	s := newTestStore(t)
+	ws := s.workspace(t, "Home", "")
+	todo := s.todo(t, ws.ID, "", "Buy milk")
+
+	ops, err := s.wal.GetUndoGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.applier.Apply(ops); err != nil {
+		t.Fatalf("applying the create again: %v", err)
+	}
+	if got := s.get(t, todo.ID); got.Description != "Buy milk" {
+		t.Errorf("todo is %q after a second apply", got.Description)
+	}
+}
+
+func TestConcurrentReordersAllApply(t *testing.T) {
+	s := newTestStore(t)
+	ws := s.workspace(t, "Home", "")
+	first := s.todo(t, ws.ID, "", "First")
+	for _, d := range []string{"b", "c", "d", "e", "f", "g", "h", "i"} {
+		s.todo(t, ws.ID, "", d)
+	}
+
+	// Each reorder reads the positions it changes; the WAL lock makes the
+	// next one read them only after the previous one is applied
+	const moves = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, moves)
+	for i := 0; i < moves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.todos.Reorder(wal.WithUndoGroup(context.Background()), first.ID, 1)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("reorder: %v", err)
+		}
+	}
+	if got := s.get(t, first.ID).Position; got != moves {
+		t.Errorf("after %d moves down the todo is at %d, want %d", moves, got, moves)
+	}
+}
+
+func TestUndoOfRowsChangedElsewhereFails(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	todo := s.todo(t, ws.ID, "", "Buy milk")
+
+	renamed := s.get(t, todo.ID)
+	renamed.Description = "Buy oat milk"
+	if err := s.todos.Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process edits the todo without going through this log
+	if _, err := s.db.Exec(`UPDATE todos SET urgency = 4 WHERE id = ?`, todo.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.wal.Undo(ctx, s.applier.RevertIn)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("undo: got %v, want %v", err, domain.ErrConflict)
+	}
+	if got := s.get(t, todo.ID); got.Description != "Buy oat milk" || got.Urgency != domain.UrgencyCritical {
+		t.Errorf("todo is %q with urgency %d, want it left as it was", got.Description, got.Urgency)
+	}
+	redo, err := s.wal.GetRedoGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redo) != 0 {
+		t.Error("the failed undo was marked undone")
+	}
+}
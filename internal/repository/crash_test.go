@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// The crash test kills lazytodo between writing an operation to the WAL
+// and applying it, then checks that startup recovery replays it exactly
+// once. Every step of a fixed workload is crashed at every fault point,
+// each run in a child process, the test binary itself, against a fresh
+// database. The recovered database is compared with one where the same
+// steps ran without a crash.
+
+// crashPoint is where the child process dies
+type crashPoint string
+
+const (
+	// afterLog crashes once the operation is in the log but not applied
+	afterLog crashPoint = "after-log"
+	// afterApply crashes once the operation is applied but not marked applied
+	afterApply crashPoint = "after-apply"
+)
+
+// crashChildEnv tells the test binary to run as a crashing child. It holds
+// the fault point, the workload step and the database path.
+const crashChildEnv = "LAZYTODO_CRASH_CHILD"
+
+// crashExitCode is how the child reports that it died at the fault point
+const crashExitCode = 75
+
+func TestCrashRecovery(t *testing.T) {
+	if spec := os.Getenv(crashChildEnv); spec != "" {
+		runCrashChild(t, spec)
+		return
+	}
+	if testing.Short() {
+		t.Skip("crashes a child process per workload step")
+	}
+
+	for _, point := range []crashPoint{afterLog, afterApply} {
+		for i, step := range crashWorkload {
+			point, i := point, i
+			t.Run(fmt.Sprintf("%s/%02d %s", point, i, step.name), func(t *testing.T) {
+				t.Parallel()
+				checkCrash(t, point, i)
+			})
+		}
+	}
+}
+
+// checkCrash crashes a child at one step and checks the recovered database
+func checkCrash(t *testing.T, point crashPoint, step int) {
+	dir := t.TempDir()
+	crashedPath := filepath.Join(dir, "crashed.db")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashRecovery$")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s:%d:%s", crashChildEnv, point, step, crashedPath))
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != crashExitCode {
+		t.Fatalf("child did not crash at the fault point: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Recover the way the app does on startup
+	crashed := openTestStore(t, crashedPath)
+	result, err := crashed.wal.RunRecovery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("recovery: %v", errors.Join(result.Errors...))
+	}
+	if result.RecoveredOps != 1 {
+		t.Fatalf("recovered %d operations, want 1", result.RecoveredOps)
+	}
+
+	reference := openTestStore(t, filepath.Join(dir, "reference.db"))
+	for i := 0; i <= step; i++ {
+		if err := crashWorkload[i].run(context.Background(), reference); err != nil {
+			t.Fatalf("reference step %d: %v", i, err)
+		}
+	}
+	compareStores(t, crashed, reference)
+
+	// Every step logs exactly one operation, and all of them are applied
+	var total, unapplied int
+	err = crashed.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(applied = 0), 0) FROM operation_log`).Scan(&total, &unapplied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != step+1 || unapplied != 0 {
+		t.Fatalf("log has %d operations (%d unapplied), want %d applied", total, unapplied, step+1)
+	}
+
+	// Replaying the latest operation again must not change anything
+	if _, err := crashed.db.Exec(`UPDATE operation_log SET applied = 0 WHERE id = (SELECT MAX(id) FROM operation_log)`); err != nil {
+		t.Fatal(err)
+	}
+	result, err = crashed.wal.RunRecovery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 || result.RecoveredOps != 1 {
+		t.Fatalf("second replay recovered %d operations, want 1: %v", result.RecoveredOps, errors.Join(result.Errors...))
+	}
+	compareStores(t, crashed, reference)
+}
+
+// runCrashChild runs the workload up to a step and dies at the fault point
+func runCrashChild(t *testing.T, spec string) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		t.Fatalf("malformed %s %q", crashChildEnv, spec)
+	}
+	point := crashPoint(parts[0])
+	step, err := strconv.Atoi(parts[1])
+	if err != nil || step < 0 || step >= len(crashWorkload) {
+		t.Fatalf("step %q out of range", parts[1])
+	}
+
+	armed := false
+	s := openWrappedTestStore(t, parts[2], func(apply func([]*wal.Operation) error) func([]*wal.Operation) error {
+		return func(ops []*wal.Operation) error {
+			if !armed {
+				return apply(ops)
+			}
+			switch point {
+			case afterLog:
+				os.Exit(crashExitCode)
+			case afterApply:
+				if err := apply(ops); err != nil {
+					return err
+				}
+				os.Exit(crashExitCode)
+			}
+			return fmt.Errorf("unknown fault point %q", point)
+		}
+	})
+
+	ctx := context.Background()
+	for i := 0; i <= step; i++ {
+		armed = i == step
+		if err := crashWorkload[i].run(ctx, s); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	t.Fatalf("step %d did not reach the fault point", step)
+}
+
+// compareStores checks that two databases hold the same data. Timestamps
+// are ignored since the runs happen at different times.
+func compareStores(t *testing.T, got, want *testStore) {
+	t.Helper()
+	queries := []string{
+		`SELECT id, name, position, is_expanded, deleted_at IS NOT NULL FROM workspaces ORDER BY id`,
+		`SELECT ancestor_id, descendant_id, depth FROM workspace_closure ORDER BY ancestor_id, descendant_id`,
+		`SELECT id, workspace_id, description, position, status, urgency, completed_at IS NOT NULL, deleted_at IS NOT NULL, is_archived FROM todos ORDER BY id`,
+		`SELECT ancestor_id, descendant_id, depth FROM todo_closure ORDER BY ancestor_id, descendant_id`,
+		`SELECT todo_id, tag FROM todo_tags ORDER BY todo_id, tag`,
+	}
+
+	for _, q := range queries {
+		if g, w := dumpRows(t, got.db, q), dumpRows(t, want.db, q); g != w {
+			t.Fatalf("state differs for %q:\ngot:\n%swant:\n%s", q, g, w)
+		}
+	}
+}
+
+// dumpRows renders the result of a query one row per line
+func dumpRows(t *testing.T, db *DB, query string) string {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range values {
+			if i > 0 {
+				b.WriteString("|")
+			}
+			b.WriteString(v.String)
+		}
+		b.WriteString("\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// crashStep is one user action that logs exactly one operation
+type crashStep struct {
+	name string
+	run  func(ctx context.Context, s *testStore) error
+}
+
+// crashWorkload covers every kind of operation. IDs are fixed so runs can
+// be compared row by row.
+var crashWorkload = []crashStep{
+	{"create workspace", func(ctx context.Context, s *testStore) error {
+		return s.workspaces.Create(ctx, &domain.Workspace{ID: "ws-home", Name: "Home", IsExpanded: true})
+	}},
+	{"create child workspace", func(ctx context.Context, s *testStore) error {
+		return s.workspaces.Create(ctx, &domain.Workspace{ID: "ws-garden", Name: "Garden", ParentID: "ws-home", IsExpanded: true})
+	}},
+	{"create workspace", func(ctx context.Context, s *testStore) error {
+		return s.workspaces.Create(ctx, &domain.Workspace{ID: "ws-scratch", Name: "Scratch", Position: 1})
+	}},
+	{"create todo", func(ctx context.Context, s *testStore) error {
+		return s.todos.Create(ctx, crashTodo("t-groceries", "ws-home", "", "Buy groceries", 0))
+	}},
+	{"create subtask", func(ctx context.Context, s *testStore) error {
+		return s.todos.Create(ctx, crashTodo("t-milk", "ws-home", "t-groceries", "Milk", 0))
+	}},
+	{"create subtask", func(ctx context.Context, s *testStore) error {
+		return s.todos.Create(ctx, crashTodo("t-bread", "ws-home", "t-groceries", "Bread", 1))
+	}},
+	{"create todo", func(ctx context.Context, s *testStore) error {
+		return s.todos.Create(ctx, crashTodo("t-weeds", "ws-home", "", "Weeds", 1))
+	}},
+	{"rename todo", func(ctx context.Context, s *testStore) error {
+		return updateCrashTodo(ctx, s, "t-weeds", func(t *domain.Todo) {
+			t.Description = "Pull weeds @garden"
+		})
+	}},
+	{"rename tag", func(ctx context.Context, s *testStore) error {
+		_, err := s.tags.Rename(ctx, "garden", "outdoors/garden")
+		return err
+	}},
+	{"complete todo", func(ctx context.Context, s *testStore) error {
+		return updateCrashTodo(ctx, s, "t-milk", func(t *domain.Todo) {
+			now := time.Now()
+			t.Status = domain.StatusCompleted
+			t.CompletedAt = &now
+		})
+	}},
+	{"move under todo", func(ctx context.Context, s *testStore) error {
+		return s.todos.Move(ctx, "t-bread", "t-weeds", "")
+	}},
+	{"move to workspace", func(ctx context.Context, s *testStore) error {
+		return s.todos.Move(ctx, "t-weeds", "", "ws-garden")
+	}},
+	{"insert todo", func(ctx context.Context, s *testStore) error {
+		return s.todos.CreateAfter(ctx, crashTodo("t-mail", "ws-home", "", "Post mail", 0), "")
+	}},
+	{"reorder todo", func(ctx context.Context, s *testStore) error {
+		_, err := s.todos.Reorder(ctx, "t-groceries", -1)
+		return err
+	}},
+	{"archive todo", func(ctx context.Context, s *testStore) error {
+		return s.todos.Archive(ctx, "t-milk")
+	}},
+	{"rename workspace", func(ctx context.Context, s *testStore) error {
+		ws, err := s.workspaces.GetByID(ctx, "ws-garden")
+		if err != nil {
+			return err
+		}
+		ws.Name = "Backyard"
+		return s.workspaces.Update(ctx, ws)
+	}},
+	{"move workspace", func(ctx context.Context, s *testStore) error {
+		return s.workspaces.Move(ctx, "ws-garden", "ws-scratch")
+	}},
+	{"delete subtree", func(ctx context.Context, s *testStore) error {
+		return s.todos.Delete(ctx, "t-groceries")
+	}},
+	{"delete workspace", func(ctx context.Context, s *testStore) error {
+		return s.workspaces.Delete(ctx, "ws-home")
+	}},
+	{"restore workspace", func(ctx context.Context, s *testStore) error {
+		return s.trash.Restore(ctx, &TrashEntry{EntityType: wal.EntityWorkspace, ID: "ws-home"})
+	}},
+}
+
+func crashTodo(id, workspaceID, parentID, description string, position int) *domain.Todo {
+	return &domain.Todo{
+		ID:          id,
+		WorkspaceID: workspaceID,
+		ParentID:    parentID,
+		Description: description,
+		Position:    position,
+		Status:      domain.StatusPending,
+		Urgency:     domain.UrgencyMedium,
+	}
+}
+
+func updateCrashTodo(ctx context.Context, s *testStore, id string, change func(t *domain.Todo)) error {
+	todo, err := s.todos.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	change(todo)
+	return s.todos.Update(ctx, todo)
+}
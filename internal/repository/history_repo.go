@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// HistoryEntry is one undo group of the operation log
+type HistoryEntry struct {
+	GroupID    string
+	Summary    string
+	CreatedAt  time.Time
+	IsUndone   bool
+	Operations []*wal.Operation // Newest first
+}
+
+// Contains returns true if the entry holds the operation
+func (e *HistoryEntry) Contains(opID int64) bool {
+	for _, op := range e.Operations {
+		if op.ID == opID {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryRepository reads the undo history from the operation log
+type HistoryRepository struct {
+	db  *DB
+	wal *wal.WAL
+}
+
+// NewHistoryRepository creates a new history repository
+func NewHistoryRepository(db *DB, w *wal.WAL) *HistoryRepository {
+	return &HistoryRepository{db: db, wal: w}
+}
+
+// GetHistory returns the most recent undo groups, newest first
+func (r *HistoryRepository) GetHistory(ctx context.Context, limit int) ([]*HistoryEntry, error) {
+	ops, err := r.wal.GetHistory(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*HistoryEntry
+	var current *HistoryEntry
+	for _, op := range ops {
+		// Operations without a group form a group of their own
+		if current == nil || op.UndoGroupID == "" || op.UndoGroupID != current.GroupID {
+			current = &HistoryEntry{
+				GroupID:   op.UndoGroupID,
+				CreatedAt: op.CreatedAt,
+				IsUndone:  op.IsUndone,
+			}
+			entries = append(entries, current)
+		}
+		current.Operations = append(current.Operations, op)
+	}
+
+	for _, e := range entries {
+		// Describe the group by the operation that started it
+		first := e.Operations[len(e.Operations)-1]
+		e.Summary = r.Summarize(ctx, first)
+		if n := len(e.Operations) - 1; n > 0 {
+			e.Summary += fmt.Sprintf(" (+%d more)", n)
+		}
+	}
+
+	return entries, nil
+}
+
+// WorkspaceAt returns a workspace and its todos as they were at the given
+// time. Every transition since is stepped back, newest first, in a
+// transaction that is rolled back, so the tables are left untouched: an
+// operation applied or redone since is reverted, and one undone since is
+// applied again.
+func (r *HistoryRepository) WorkspaceAt(ctx context.Context, workspaceID string, at time.Time) (*domain.Workspace, []*domain.Todo, error) {
+	start, err := r.wal.HistoryStart()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !start.IsZero() && at.Before(start) {
+		return nil, nil, fmt.Errorf("%w: history before %s has been compacted",
+			domain.ErrHistoryUnavailable, start.Local().Format("Jan 2 15:04"))
+	}
+
+	transitions, err := r.wal.GetTransitionsSince(at)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, t := range transitions {
+		if err := applyOperation(ctx, tx, t.Op, !t.Undone); err != nil {
+			return nil, nil, fmt.Errorf("failed to step back op %d: %w", t.Op.ID, err)
+		}
+	}
+
+	snap, err := loadWorkspaceSnapshot(ctx, tx, []string{workspaceID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(snap.Workspaces) == 0 || snap.Workspaces[0].DeletedAt != nil {
+		return nil, nil, fmt.Errorf("%w: workspace did not exist at that time", domain.ErrNotFound)
+	}
+	ws := &domain.Workspace{
+		ID:         workspaceID,
+		Name:       snap.Workspaces[0].Name,
+		Position:   snap.Workspaces[0].Position,
+		IsExpanded: snap.Workspaces[0].IsExpanded,
+	}
+
+	todos, err := queryWorkspaceTodos(ctx, tx, workspaceID, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ws, todos, nil
+}
+
+// Summarize returns a readable description of an operation,
+// e.g. "moved 'Write spec' under 'Q3 plan'"
+func (r *HistoryRepository) Summarize(ctx context.Context, op *wal.Operation) string {
+	switch op.EntityType {
+	case wal.EntityTodo:
+		var before, after *TodoSnapshot
+		if decodeSnapshot(op.Payload.Before, &before) != nil || decodeSnapshot(op.Payload.After, &after) != nil {
+			return op.Describe()
+		}
+		return r.summarizeTodo(ctx, op, before, after)
+
+	case wal.EntityWorkspace:
+		var before, after *WorkspaceSnapshot
+		if decodeSnapshot(op.Payload.Before, &before) != nil || decodeSnapshot(op.Payload.After, &after) != nil {
+			return op.Describe()
+		}
+		return r.summarizeWorkspace(ctx, op, before, after)
+
+	case wal.EntitySavedView:
+		var before, after *SavedViewRecord
+		if decodeSnapshot(op.Payload.Before, &before) != nil || decodeSnapshot(op.Payload.After, &after) != nil {
+			return op.Describe()
+		}
+		return summarizeSavedView(op, before, after)
+	}
+
+	return op.Describe()
+}
+
+func summarizeSavedView(op *wal.Operation, before, after *SavedViewRecord) string {
+	switch {
+	case before == nil && after != nil:
+		return "saved view " + quote(after.Name)
+	case before != nil && after == nil:
+		return "deleted view " + quote(before.Name)
+	case before != nil && before.Name != after.Name:
+		return fmt.Sprintf("renamed view %s to %s", quote(before.Name), quote(after.Name))
+	}
+	return op.Describe()
+}
+
+func (r *HistoryRepository) summarizeTodo(ctx context.Context, op *wal.Operation, before, after *TodoSnapshot) string {
+	old := findTodoRecord(before, op.EntityID)
+	cur := findTodoRecord(after, op.EntityID)
+	if cur == nil && old == nil {
+		return op.Describe()
+	}
+	if cur == nil {
+		cur = old
+	}
+	if before == nil {
+		before = &TodoSnapshot{}
+	}
+	if after == nil {
+		after = &TodoSnapshot{}
+	}
+	name := quote(cur.Description)
+
+	switch op.OperationType {
+	case wal.OpCreate:
+		if parentID := parentOf(after.Closure, op.EntityID); parentID != "" {
+			return fmt.Sprintf("added %s under %s", name, quote(r.todoName(ctx, parentID, after)))
+		}
+		return "added " + name
+
+	case wal.OpDelete:
+		switch n := len(before.Todos) - 1; {
+		case n == 1:
+			return fmt.Sprintf("deleted %s and 1 subtask", name)
+		case n > 1:
+			return fmt.Sprintf("deleted %s and %d subtasks", name, n)
+		}
+		return "deleted " + name
+
+	case wal.OpMove:
+		if old != nil && old.WorkspaceID != cur.WorkspaceID {
+			return fmt.Sprintf("moved %s to workspace %s", name, quote(r.workspaceName(ctx, cur.WorkspaceID, nil)))
+		}
+		if parentID := parentOf(after.Closure, op.EntityID); parentID != "" {
+			return fmt.Sprintf("moved %s under %s", name, quote(r.todoName(ctx, parentID, after)))
+		}
+		return fmt.Sprintf("moved %s to top level", name)
+
+	case wal.OpUpdate:
+		switch {
+		case old == nil:
+			return "edited " + name
+		case old.DeletedAt != nil && cur.DeletedAt == nil:
+			return "restored " + name
+		case old.Description != cur.Description:
+			return fmt.Sprintf("renamed %s to %s", quote(old.Description), name)
+		case old.Status != cur.Status && cur.Status == "completed":
+			return "completed " + name
+		case old.Status != cur.Status:
+			return "reopened " + name
+		case !old.IsArchived && cur.IsArchived:
+			return "archived " + name
+		case old.Position != cur.Position:
+			return "reordered " + name
+		}
+		return "edited " + name
+	}
+
+	return op.Describe()
+}
+
+func (r *HistoryRepository) summarizeWorkspace(ctx context.Context, op *wal.Operation, before, after *WorkspaceSnapshot) string {
+	old := findWorkspaceRecord(before, op.EntityID)
+	cur := findWorkspaceRecord(after, op.EntityID)
+	if cur == nil && old == nil {
+		return op.Describe()
+	}
+	if cur == nil {
+		cur = old
+	}
+	if after == nil {
+		after = &WorkspaceSnapshot{}
+	}
+	name := quote(cur.Name)
+
+	switch op.OperationType {
+	case wal.OpCreate:
+		if parentID := parentOf(after.Closure, op.EntityID); parentID != "" {
+			return fmt.Sprintf("created workspace %s under %s", name, quote(r.workspaceName(ctx, parentID, after)))
+		}
+		return "created workspace " + name
+
+	case wal.OpDelete:
+		return "deleted workspace " + name
+
+	case wal.OpMove:
+		if parentID := parentOf(after.Closure, op.EntityID); parentID != "" {
+			return fmt.Sprintf("moved workspace %s under %s", name, quote(r.workspaceName(ctx, parentID, after)))
+		}
+		return fmt.Sprintf("moved workspace %s to top level", name)
+
+	case wal.OpUpdate:
+		switch {
+		case old == nil:
+			return "edited workspace " + name
+		case old.DeletedAt != nil && cur.DeletedAt == nil:
+			return "restored workspace " + name
+		case old.Name != cur.Name:
+			return fmt.Sprintf("renamed workspace %s to %s", quote(old.Name), name)
+		case old.IsExpanded != cur.IsExpanded && cur.IsExpanded:
+			return "expanded " + name
+		case old.IsExpanded != cur.IsExpanded:
+			return "collapsed " + name
+		case old.Position != cur.Position:
+			return "reordered workspace " + name
+		}
+		return "edited workspace " + name
+	}
+
+	return op.Describe()
+}
+
+// todoName looks a todo description up in the snapshot first, then in the
+// table (deleted rows included)
+func (r *HistoryRepository) todoName(ctx context.Context, id string, snap *TodoSnapshot) string {
+	if rec := findTodoRecord(snap, id); rec != nil {
+		return rec.Description
+	}
+
+	var desc string
+	err := r.db.QueryRowContext(ctx, `SELECT description FROM todos WHERE id = ?`, id).Scan(&desc)
+	if err != nil {
+		return "?"
+	}
+	return desc
+}
+
+// workspaceName looks a workspace name up in the snapshot first, then in
+// the table (deleted rows included)
+func (r *HistoryRepository) workspaceName(ctx context.Context, id string, snap *WorkspaceSnapshot) string {
+	if rec := findWorkspaceRecord(snap, id); rec != nil {
+		return rec.Name
+	}
+
+	var name string
+	err := r.db.QueryRowContext(ctx, `SELECT name FROM workspaces WHERE id = ?`, id).Scan(&name)
+	if err != nil {
+		return "?"
+	}
+	return name
+}
+
+// Helper functions
+
+func findTodoRecord(snap *TodoSnapshot, id string) *TodoRecord {
+	if snap == nil {
+		return nil
+	}
+	for i := range snap.Todos {
+		if snap.Todos[i].ID == id {
+			return &snap.Todos[i]
+		}
+	}
+	return nil
+}
+
+func findWorkspaceRecord(snap *WorkspaceSnapshot, id string) *WorkspaceRecord {
+	if snap == nil {
+		return nil
+	}
+	for i := range snap.Workspaces {
+		if snap.Workspaces[i].ID == id {
+			return &snap.Workspaces[i]
+		}
+	}
+	return nil
+}
+
+// parentOf returns the direct parent recorded in closure rows, if any
+func parentOf(closure []ClosureRecord, id string) string {
+	for _, c := range closure {
+		if c.DescendantID == id && c.Depth == 1 {
+			return c.AncestorID
+		}
+	}
+	return ""
+}
+
+func quote(s string) string {
+	const maxLen = 40
+	if r := []rune(s); len(r) > maxLen {
+		s = string(r[:maxLen-3]) + "..."
+	}
+	return "'" + s + "'"
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// backdate moves every logged operation and transition d into the past
+func (s *testStore) backdate(t *testing.T, d time.Duration) {
+	t.Helper()
+	shift := fmt.Sprintf("-%d seconds", int(d.Seconds()))
+	for _, table := range []string{"operation_log", "operation_transitions"} {
+		_, err := s.db.Exec(`UPDATE `+table+` SET created_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at, ?)`, shift)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// todoAt returns a todo of a workspace as it was at the given time
+func (s *testStore) todoAt(t *testing.T, workspaceID, id string, at time.Time) *domain.Todo {
+	t.Helper()
+	_, todos, err := s.history.WorkspaceAt(context.Background(), workspaceID, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, todo := range todos {
+		if todo.ID == id {
+			return todo
+		}
+	}
+	t.Fatalf("todo %s was not in the workspace at %s", id, at)
+	return nil
+}
+
+func TestWorkspaceAtStepsBackUndoAndRedo(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	todo := s.todo(t, ws.ID, "", "Buy milk")
+	s.backdate(t, 3*time.Hour)
+
+	renamed := s.get(t, todo.ID)
+	renamed.Description = "Buy oat milk"
+	if err := s.todos.Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	s.backdate(t, time.Hour)
+
+	// Undone now, so an hour ago the rename was in place
+	s.undo(t)
+	halfHourAgo := time.Now().Add(-30 * time.Minute)
+	if got := s.todoAt(t, ws.ID, todo.ID, halfHourAgo); got.Description != "Buy oat milk" {
+		t.Errorf("after the undo, the todo was %q half an hour ago, want %q", got.Description, "Buy oat milk")
+	}
+
+	// Redone and undone again makes no difference
+	if _, err := s.wal.Redo(ctx, s.applier.ApplyIn); err != nil {
+		t.Fatal(err)
+	}
+	s.undo(t)
+	if got := s.todoAt(t, ws.ID, todo.ID, halfHourAgo); got.Description != "Buy oat milk" {
+		t.Errorf("after a redo and undo, the todo was %q half an hour ago", got.Description)
+	}
+
+	// A new change drops the rename from the redo branch, not from the past
+	urgent := s.get(t, todo.ID)
+	urgent.Urgency = domain.UrgencyCritical
+	if err := s.todos.Update(ctx, urgent); err != nil {
+		t.Fatal(err)
+	}
+	got := s.todoAt(t, ws.ID, todo.ID, halfHourAgo)
+	if got.Description != "Buy oat milk" || got.Urgency != domain.UrgencyLow {
+		t.Errorf("after a new change, the todo was %q with urgency %d half an hour ago", got.Description, got.Urgency)
+	}
+
+	if got := s.todoAt(t, ws.ID, todo.ID, time.Now().Add(-2*time.Hour)); got.Description != "Buy milk" {
+		t.Errorf("two hours ago the todo was %q, want %q", got.Description, "Buy milk")
+	}
+}
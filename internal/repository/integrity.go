@@ -0,0 +1,571 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// treeTables names the tables that store one tree
+type treeTables struct {
+	entity     string // "todo" or "workspace"
+	table      string
+	closure    string
+	nameColumn string
+}
+
+var (
+	workspaceTables = treeTables{"workspace", "workspaces", "workspace_closure", "name"}
+	todoTables      = treeTables{"todo", "todos", "todo_closure", "description"}
+)
+
+// treeNode is a row of a tree table as seen by the integrity checker
+type treeNode struct {
+	id           string
+	name         string
+	deletedAt    sql.NullString
+	deletedBatch sql.NullString
+	workspaceID  string // Todos only
+
+	// The denormalized parent and depth, todos only
+	parentID sql.NullString
+	depth    int
+}
+
+// integrityCheck holds the problems found in one tree and the plan that
+// repairs them
+type integrityCheck struct {
+	tables treeTables
+	nodes  map[string]*treeNode
+	ids    []string          // Sorted, so reports are stable
+	parent map[string]string // Parent of each node once repaired
+
+	issues []*domain.IntegrityError
+	hidden map[*domain.IntegrityError]bool // Only concern rows that are not shown
+
+	// Repair plan
+	dangling []ClosureRecord
+	rebuild  map[string][]ClosureRecord // Closure rows to write per node
+	purge    []string
+	moveTo   map[string]string   // Workspace to move each todo to
+	trash    map[string]deletion // Deletion to give each node
+	resync   []string            // Todos whose parent and depth to rewrite
+}
+
+// CheckIntegrity checks the workspace and todo trees and returns every
+// problem found without changing anything
+func CheckIntegrity(ctx context.Context, db *DB) ([]*domain.IntegrityError, error) {
+	checks, err := checkTrees(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*domain.IntegrityError
+	for _, c := range checks {
+		issues = append(issues, c.issues...)
+	}
+	return issues, nil
+}
+
+// RepairIntegrity carries out the repair of every problem CheckIntegrity
+// finds in a single transaction and returns the problems repaired.
+// Repairs are written directly, not through the operation log.
+func RepairIntegrity(ctx context.Context, db *DB) ([]*domain.IntegrityError, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	checks, err := checkTrees(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*domain.IntegrityError
+	for _, c := range checks {
+		if err := c.repair(ctx, tx); err != nil {
+			return nil, err
+		}
+		issues = append(issues, c.issues...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit repairs: %w", err)
+	}
+	return issues, nil
+}
+
+// checkTrees checks the workspace tree, then the todo tree against it
+func checkTrees(ctx context.Context, q querier) ([]*integrityCheck, error) {
+	workspaces, err := checkTree(ctx, q, workspaceTables)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := checkTodoTree(ctx, q, workspaces)
+	if err != nil {
+		return nil, err
+	}
+	return []*integrityCheck{workspaces, todos}, nil
+}
+
+// checkTodoTree checks the todo tree and where each todo lives
+func checkTodoTree(ctx context.Context, q querier, workspaces *integrityCheck) (*integrityCheck, error) {
+	c, err := checkTree(ctx, q, todoTables)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range c.ids {
+		n := c.nodes[id]
+		if workspaces.nodes[n.workspaceID] == nil {
+			c.purge = append(c.purge, id)
+			c.report(domain.ErrOrphanNode, id,
+				fmt.Sprintf("belongs to workspace %s, which does not exist", n.workspaceID),
+				"delete it permanently")
+			continue
+		}
+
+		wsID := c.workspaceOf(id, workspaces)
+		if d := workspaces.deletion(wsID); d.at != "" && c.deletion(id).at == "" {
+			c.trash[id] = d
+			issue := c.report(domain.ErrOrphanNode, id,
+				fmt.Sprintf("is active but its workspace %s is deleted", workspaces.label(wsID)),
+				"move it to the trash with its workspace")
+			c.hidden[issue] = true
+		}
+
+		// A todo whose closure rows are rebuilt is reported already
+		parentID, depth := c.parent[id], len(c.expectedClosure(id))-1
+		if n.parentID.String != parentID || n.depth != depth {
+			c.resync = append(c.resync, id)
+			if _, ok := c.rebuild[id]; !ok {
+				c.report(domain.ErrIntegrityViolation, id,
+					fmt.Sprintf("stored parent %q and depth %d disagree with its closure rows", n.parentID.String, n.depth),
+					"rewrite them from its parent chain")
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// checkTree looks for dangling closure rows, nodes with several parents,
+// cycles, closure rows that disagree with the parent chain and active
+// nodes under deleted ones
+func checkTree(ctx context.Context, q querier, t treeTables) (*integrityCheck, error) {
+	c := &integrityCheck{
+		tables:  t,
+		parent:  make(map[string]string),
+		hidden:  make(map[*domain.IntegrityError]bool),
+		rebuild: make(map[string][]ClosureRecord),
+		moveTo:  make(map[string]string),
+		trash:   make(map[string]deletion),
+	}
+	if err := c.loadNodes(ctx, q); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT ancestor_id, descendant_id, depth FROM `+t.closure)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s rows: %w", t.closure, err)
+	}
+	defer rows.Close()
+
+	actual := make(map[string]map[string]int) // descendant -> ancestor -> depth
+	parents := make(map[string][]string)
+	for rows.Next() {
+		var r ClosureRecord
+		if err := rows.Scan(&r.AncestorID, &r.DescendantID, &r.Depth); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", t.closure, err)
+		}
+
+		if c.nodes[r.AncestorID] == nil || c.nodes[r.DescendantID] == nil {
+			c.dangling = append(c.dangling, r)
+			c.report(domain.ErrOrphanNode, r.DescendantID,
+				fmt.Sprintf("closure row %s → %s refers to a %s that does not exist", r.AncestorID, r.DescendantID, t.entity),
+				"delete the closure row")
+			continue
+		}
+
+		if actual[r.DescendantID] == nil {
+			actual[r.DescendantID] = make(map[string]int)
+		}
+		actual[r.DescendantID][r.AncestorID] = r.Depth
+		if r.Depth == 1 && r.AncestorID != r.DescendantID {
+			parents[r.DescendantID] = append(parents[r.DescendantID], r.AncestorID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load %s rows: %w", t.closure, err)
+	}
+
+	c.checkParents(parents, actual)
+	c.checkCycles()
+	c.checkClosure(actual)
+	for _, id := range c.ids {
+		c.deletion(id)
+	}
+
+	return c, nil
+}
+
+// loadNodes reads every row of the tree, deleted ones included
+func (c *integrityCheck) loadNodes(ctx context.Context, q querier) error {
+	todoColumns := "'', NULL, 0"
+	if c.tables == todoTables {
+		todoColumns = "workspace_id, parent_id, depth"
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, `+c.tables.nameColumn+`, deleted_at, deleted_batch, `+todoColumns+`
+		FROM `+c.tables.table+`
+		ORDER BY id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", c.tables.table, err)
+	}
+	defer rows.Close()
+
+	c.nodes = make(map[string]*treeNode)
+	for rows.Next() {
+		var n treeNode
+		if err := rows.Scan(&n.id, &n.name, &n.deletedAt, &n.deletedBatch, &n.workspaceID, &n.parentID, &n.depth); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", c.tables.table, err)
+		}
+		c.nodes[n.id] = &n
+		c.ids = append(c.ids, n.id)
+	}
+
+	return rows.Err()
+}
+
+// checkParents keeps one parent for each node. When a node has several,
+// the one whose ancestors agree best with the node's rows wins.
+func (c *integrityCheck) checkParents(parents map[string][]string, actual map[string]map[string]int) {
+	for _, id := range c.ids {
+		candidates := parents[id]
+		if len(candidates) == 0 {
+			// Rows with the wrong depth can leave no parent; the
+			// nearest ancestor is the best guess
+			nearest, nearestDepth := "", 0
+			for ancestor, depth := range actual[id] {
+				if ancestor != id && depth > 0 && (nearest == "" || depth < nearestDepth || depth == nearestDepth && ancestor < nearest) {
+					nearest, nearestDepth = ancestor, depth
+				}
+			}
+			if nearest != "" {
+				c.parent[id] = nearest
+			}
+			continue
+		}
+		if len(candidates) == 1 {
+			c.parent[id] = candidates[0]
+			continue
+		}
+
+		sort.Strings(candidates)
+		best, bestScore := "", -1
+		for _, p := range candidates {
+			score := 0
+			for ancestor, depth := range actual[p] {
+				if d, ok := actual[id][ancestor]; ok && d == depth+1 {
+					score++
+				}
+			}
+			if score > bestScore {
+				best, bestScore = p, score
+			}
+		}
+		c.parent[id] = best
+
+		labels := make([]string, len(candidates))
+		for i, p := range candidates {
+			labels[i] = c.label(p)
+		}
+		c.report(domain.ErrIntegrityViolation, id,
+			fmt.Sprintf("has %d parents: %s", len(candidates), strings.Join(labels, ", ")),
+			fmt.Sprintf("keep %s as its parent", c.label(best)))
+	}
+}
+
+// checkCycles follows each node's parent chain and breaks every loop by
+// moving its first node to the top level
+func (c *integrityCheck) checkCycles() {
+	done := make(map[string]bool)
+	for _, id := range c.ids {
+		var path []string
+		onPath := make(map[string]int)
+		for n, ok := id, true; ok && !done[n]; n, ok = c.parent[n] {
+			if i, seen := onPath[n]; seen {
+				c.breakCycle(path[i:])
+				break
+			}
+			onPath[n] = len(path)
+			path = append(path, n)
+		}
+		for _, n := range path {
+			done[n] = true
+		}
+	}
+}
+
+func (c *integrityCheck) breakCycle(cycle []string) {
+	first := 0
+	for i, n := range cycle {
+		if n < cycle[first] {
+			first = i
+		}
+	}
+
+	chain := make([]string, 0, len(cycle)+1)
+	for i := range cycle {
+		chain = append(chain, c.label(cycle[(first+i)%len(cycle)]))
+	}
+	chain = append(chain, chain[0])
+
+	id := cycle[first]
+	delete(c.parent, id)
+	c.report(domain.ErrCircularReference, id,
+		fmt.Sprintf("is its own ancestor: %s", strings.Join(chain, " → ")),
+		"move it to the top level")
+}
+
+// checkClosure compares each node's closure rows with its parent chain:
+// missing transitive rows, rows with the wrong depth and rows to nodes
+// that are not ancestors
+func (c *integrityCheck) checkClosure(actual map[string]map[string]int) {
+	for _, id := range c.ids {
+		expected := c.expectedClosure(id)
+		have := actual[id]
+
+		var problems, missing, wrongDepth, extra []string
+		want := make(map[string]bool)
+		for _, r := range expected {
+			want[r.AncestorID] = true
+			depth, ok := have[r.AncestorID]
+			switch {
+			case !ok && r.AncestorID == id:
+				problems = append(problems, "no self row")
+			case !ok:
+				missing = append(missing, c.label(r.AncestorID))
+			case depth != r.Depth && r.AncestorID == id:
+				c.report(domain.ErrCircularReference, id,
+					fmt.Sprintf("is listed as its own ancestor at depth %d", depth),
+					"rebuild its closure rows from its parent chain")
+				c.rebuild[id] = expected
+			case depth != r.Depth:
+				wrongDepth = append(wrongDepth, fmt.Sprintf("%s (%d, expected %d)", c.label(r.AncestorID), depth, r.Depth))
+			}
+		}
+		for ancestor := range have {
+			if !want[ancestor] {
+				extra = append(extra, c.label(ancestor))
+			}
+		}
+		sort.Strings(extra)
+
+		if len(missing) > 0 {
+			problems = append(problems, "missing transitive rows for "+strings.Join(missing, ", "))
+		}
+		if len(wrongDepth) > 0 {
+			problems = append(problems, "inconsistent depth for "+strings.Join(wrongDepth, ", "))
+		}
+		if len(extra) > 0 {
+			problems = append(problems, "rows for "+strings.Join(extra, ", ")+", which are not its ancestors")
+		}
+		if len(problems) == 0 {
+			continue
+		}
+
+		c.rebuild[id] = expected
+		c.report(domain.ErrIntegrityViolation, id,
+			"closure rows disagree with its parent chain: "+strings.Join(problems, "; "),
+			"rebuild its closure rows from its parent chain")
+	}
+}
+
+// expectedClosure returns the closure rows of a node derived from the
+// parent chain, self row first
+func (c *integrityCheck) expectedClosure(id string) []ClosureRecord {
+	var rows []ClosureRecord
+	for n, ok := id, true; ok && len(rows) <= len(c.ids); n, ok = c.parent[n] {
+		rows = append(rows, ClosureRecord{AncestorID: n, DescendantID: id, Depth: len(rows)})
+	}
+	return rows
+}
+
+// deletion is when, and in which batch, a node went to the trash
+type deletion struct {
+	at    string
+	batch string
+}
+
+// deletion returns how a node was deleted, or the zero deletion if it is
+// active. An active node under a deleted one is planned to go to the
+// trash with it, in the same batch.
+func (c *integrityCheck) deletion(id string) deletion {
+	n := c.nodes[id]
+	if n == nil {
+		return deletion{}
+	}
+	if n.deletedAt.Valid {
+		d := deletion{at: n.deletedAt.String, batch: n.deletedBatch.String}
+		if !n.deletedBatch.Valid {
+			d.batch = d.at
+		}
+		return d
+	}
+	if d, ok := c.trash[id]; ok {
+		return d
+	}
+
+	p, ok := c.parent[id]
+	if !ok {
+		return deletion{}
+	}
+	d := c.deletion(p)
+	if d.at != "" {
+		c.trash[id] = d
+		issue := c.report(domain.ErrOrphanNode, id,
+			fmt.Sprintf("is active but its parent %s is deleted", c.label(p)),
+			"move it to the trash with its parent")
+		c.hidden[issue] = true
+	}
+	return d
+}
+
+// workspaceOf returns the workspace a todo belongs in, which is its
+// parent's. A todo filed elsewhere is planned to move there.
+func (c *integrityCheck) workspaceOf(id string, workspaces *integrityCheck) string {
+	if ws, ok := c.moveTo[id]; ok {
+		return ws
+	}
+
+	n := c.nodes[id]
+	p, ok := c.parent[id]
+	if !ok {
+		return n.workspaceID
+	}
+	ws := c.workspaceOf(p, workspaces)
+	if ws == n.workspaceID || workspaces.nodes[ws] == nil {
+		return n.workspaceID
+	}
+
+	c.moveTo[id] = ws
+	c.report(domain.ErrIntegrityViolation, id,
+		fmt.Sprintf("is in workspace %s but its parent %s is in %s",
+			workspaces.label(n.workspaceID), c.label(p), workspaces.label(ws)),
+		fmt.Sprintf("move it to workspace %s", workspaces.label(ws)))
+	return ws
+}
+
+// report records a problem with a node
+func (c *integrityCheck) report(err error, id, detail, repair string) *domain.IntegrityError {
+	issue := &domain.IntegrityError{
+		Err:    err,
+		Entity: c.tables.entity,
+		ID:     id,
+		Detail: detail,
+		Repair: repair,
+	}
+	if n := c.nodes[id]; n != nil {
+		issue.Name = n.name
+	}
+	c.issues = append(c.issues, issue)
+	return issue
+}
+
+// label names a node for a report
+func (c *integrityCheck) label(id string) string {
+	if n := c.nodes[id]; n != nil {
+		return "'" + n.name + "'"
+	}
+	return id
+}
+
+// visible returns the problems that show in the app
+func (c *integrityCheck) visible() []*domain.IntegrityError {
+	var issues []*domain.IntegrityError
+	for _, issue := range c.issues {
+		if !c.hidden[issue] {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// repair carries out the whole repair plan
+func (c *integrityCheck) repair(ctx context.Context, q querier) error {
+	for _, r := range c.dangling {
+		_, err := q.ExecContext(ctx, `
+			DELETE FROM `+c.tables.closure+` WHERE ancestor_id = ? AND descendant_id = ?
+		`, r.AncestorID, r.DescendantID)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s row: %w", c.tables.closure, err)
+		}
+	}
+
+	purged := make(map[string]bool)
+	for _, id := range c.purge {
+		purged[id] = true
+		if _, err := q.ExecContext(ctx, `DELETE FROM `+c.tables.table+` WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", c.tables.entity, err)
+		}
+	}
+
+	for _, id := range c.ids {
+		rows, ok := c.rebuild[id]
+		if !ok || purged[id] {
+			continue
+		}
+		if err := replaceClosure(ctx, q, c.tables.closure, []string{id}, rows); err != nil {
+			return err
+		}
+	}
+
+	now := domain.FormatTime(time.Now())
+	for id, ws := range c.moveTo {
+		if purged[id] {
+			continue
+		}
+		_, err := q.ExecContext(ctx, `
+			UPDATE todos SET workspace_id = ?, updated_at = ? WHERE id = ?
+		`, ws, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to move todo: %w", err)
+		}
+	}
+
+	for _, id := range c.resync {
+		if purged[id] {
+			continue
+		}
+		var parentID sql.NullString
+		if p, ok := c.parent[id]; ok {
+			parentID = sql.NullString{String: p, Valid: true}
+		}
+		_, err := q.ExecContext(ctx, `
+			UPDATE todos SET parent_id = ?, depth = ? WHERE id = ?
+		`, parentID, len(c.expectedClosure(id))-1, id)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite todo parent: %w", err)
+		}
+	}
+
+	for id, d := range c.trash {
+		_, err := q.ExecContext(ctx, `
+			UPDATE `+c.tables.table+` SET deleted_at = ?, deleted_batch = ?, updated_at = ?
+			WHERE id = ? AND deleted_at IS NULL
+		`, d.at, d.batch, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to move %s to the trash: %w", c.tables.entity, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// createMilk stores a workspace with a todo and a subtask under it
+func (s *testStore) createMilk(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.workspaces.Create(ctx, &domain.Workspace{ID: "home", Name: "Home"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, todo := range []*domain.Todo{
+		{ID: "milk", WorkspaceID: "home", Description: "Buy milk"},
+		{ID: "oat", WorkspaceID: "home", ParentID: "milk", Description: "Oat milk"},
+	} {
+		todo.Status, todo.Urgency = domain.StatusPending, domain.UrgencyLow
+		if err := s.todos.Create(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// repair repairs the database and returns the problems it repaired
+func (s *testStore) repair(t *testing.T) []*domain.IntegrityError {
+	t.Helper()
+	issues, err := RepairIntegrity(context.Background(), s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issues
+}
+
+func TestRepairBreaksCycles(t *testing.T) {
+	s := newTestStore(t)
+	s.createMilk(t)
+
+	// The milk is now also under its own subtask
+	if _, err := s.db.Exec(`INSERT INTO todo_closure (ancestor_id, descendant_id, depth) VALUES ('oat', 'milk', 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, issue := range s.repair(t) {
+		found = found || errors.Is(issue, domain.ErrCircularReference)
+	}
+	if !found {
+		t.Error("repair did not report the cycle")
+	}
+	s.checkIntegrity(t)
+}
+
+func TestRepairTrashesTodosUnderADeletedOne(t *testing.T) {
+	s := newTestStore(t)
+	s.createMilk(t)
+
+	// The milk went to the trash without its subtask
+	if _, err := s.db.Exec(`UPDATE todos SET deleted_at = '2024-01-01T00:00:00Z', deleted_batch = 'b' WHERE id = 'milk'`); err != nil {
+		t.Fatal(err)
+	}
+
+	if issues := s.repair(t); len(issues) == 0 {
+		t.Fatal("repair found nothing")
+	}
+	s.checkIntegrity(t)
+	if !s.get(t, "oat").IsDeleted() {
+		t.Error("the subtask is still active")
+	}
+	entries := s.trashEntries(t)
+	if len(entries) != 1 || entries["Buy milk"] == nil || entries["Buy milk"].Items != 2 {
+		t.Errorf("trash lists %v, want the milk with its subtask", entries)
+	}
+}
+
+func TestRepairPurgesTodosOfAMissingWorkspace(t *testing.T) {
+	s := newTestStore(t)
+	s.createMilk(t)
+
+	// The workspace went away with foreign keys off, leaving its todos
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`DELETE FROM workspaces WHERE id = 'home'`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close()
+
+	issues := s.repair(t)
+	var orphans int
+	for _, issue := range issues {
+		if errors.Is(issue, domain.ErrOrphanNode) {
+			orphans++
+		}
+	}
+	if orphans != 3 {
+		t.Errorf("repair found %d orphans in %v, want the workspace's closure row, the milk and its subtask", orphans, issues)
+	}
+	s.checkIntegrity(t)
+
+	var left int
+	if err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM todos) + (SELECT COUNT(*) FROM todo_closure)`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d todo and closure rows are left", left)
+	}
+}
@@ -0,0 +1,431 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// migrationFile matches "001_initial.sql" and "001_initial.down.sql"
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+?)(\.down)?\.sql$`)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // Empty if the migration cannot be rolled back
+	Checksum string // SHA-256 of Up
+}
+
+// MigrationStatus describes a migration and its state in the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+	Modified  bool   // The file changed after it was applied
+	Unknown   bool   // Applied by a newer version of lazytodo
+	Needs     string // Feature this build of SQLite lacks, so Migrate leaves it pending
+}
+
+// loadMigrations reads every migration embedded in migrationsFS, in order
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		match := migrationFile.FindStringSubmatch(f.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: unexpected migration file %s", domain.ErrMigrationFailed, f.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := migrationsFS.ReadFile("migrations/" + f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: migration %03d has two names", domain.ErrMigrationFailed, version)
+		}
+
+		if match[3] != "" {
+			m.Down = string(content)
+		} else {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: migration %03d has no up file", domain.ErrMigrationFailed, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// migrationSteps fill data a migration script cannot compute in SQL. Each
+// runs after the up script of its version, in the same transaction.
+var migrationSteps = map[int]func(ctx context.Context, q querier) error{
+	6: fillTodoTags,
+}
+
+// featureMigrations need a feature SQLite can be built without. Migrate
+// leaves one pending while this build lacks its feature, and suspends one
+// applied by a build that had it, so the next build with the feature
+// applies it again. No later migration may depend on one of them.
+var featureMigrations = map[int]featureMigration{
+	searchIndexVersion: {feature: "FTS5", suspend: dropSearchTriggers},
+}
+
+// featureMigration is the feature a migration needs
+type featureMigration struct {
+	feature string // As in the compile option ENABLE_<feature>
+	suspend string // Script that undoes what can run without the feature
+}
+
+// hasFeature reports whether this build of SQLite has a feature
+func (db *DB) hasFeature(feature string) (bool, error) {
+	var used bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used(?)`, "ENABLE_"+feature).Scan(&used); err != nil {
+		return false, fmt.Errorf("failed to check for %s: %w", feature, err)
+	}
+	return used, nil
+}
+
+// appliedMigration is a row of schema_version
+type appliedMigration struct {
+	checksum  string
+	appliedAt string
+}
+
+// ensureVersionTable creates schema_version, adding the columns older
+// databases lack
+func (db *DB) ensureVersionTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			applied_at TEXT NOT NULL DEFAULT (datetime('now'))
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version: %w", err)
+	}
+
+	columns, err := db.versionColumns()
+	if err != nil {
+		return err
+	}
+	for _, col := range []string{"name", "checksum"} {
+		if columns[col] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE schema_version ADD COLUMN ` + col + ` TEXT`); err != nil {
+			return fmt.Errorf("failed to add schema_version.%s: %w", col, err)
+		}
+	}
+
+	return nil
+}
+
+// versionColumns returns the columns of schema_version, or none if the
+// table does not exist
+func (db *DB) versionColumns() (map[string]bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('schema_version')`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect schema_version: %w", err)
+	}
+	defer rows.Close()
+
+	names, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// appliedMigrations returns the applied versions, bringing schema_version
+// up to date first. Rows recorded before checksums existed get the
+// checksum of the current file. Only Migrate and Rollback call it.
+func (db *DB) appliedMigrations(migrations []Migration) (map[int]appliedMigration, error) {
+	if err := db.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		_, err := db.Exec(`
+			UPDATE schema_version SET name = ?, checksum = ?
+			WHERE version = ? AND checksum IS NULL
+		`, m.Name, m.Checksum, m.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record checksum of migration %03d: %w", m.Version, err)
+		}
+	}
+
+	return db.readAppliedMigrations()
+}
+
+// readAppliedMigrations returns the applied versions without writing to
+// the database. Rows recorded before checksums existed have none.
+func (db *DB) readAppliedMigrations() (map[int]appliedMigration, error) {
+	columns, err := db.versionColumns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return map[int]appliedMigration{}, nil
+	}
+	checksum := "NULL"
+	if columns["checksum"] {
+		checksum = "checksum"
+	}
+
+	rows, err := db.Query(`SELECT version, COALESCE(` + checksum + `, ''), applied_at FROM schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_version: %w", err)
+		}
+		applied[version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+// MigrationStatus returns every known migration and whether it has been
+// applied. It only reads, so it works on a read-only database. A version
+// recorded before checksums existed is not reported as modified.
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.readAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = a.appliedAt
+			statuses[i].Modified = a.checksum != "" && a.checksum != m.Checksum
+			delete(applied, m.Version)
+			continue
+		}
+		if fm, ok := featureMigrations[m.Version]; ok {
+			has, err := db.hasFeature(fm.feature)
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				statuses[i].Needs = fm.feature
+			}
+		}
+	}
+
+	// Whatever is left has no file
+	for version, a := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: version, Name: "?"},
+			Applied:   true,
+			AppliedAt: a.appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Migrate applies every pending migration in order, each in its own
+// transaction. It refuses to run if an applied migration file changed or
+// the database is newer than this binary.
+func (db *DB) Migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := db.appliedMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	if err := checkApplied(migrations, applied); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		_, done := applied[m.Version]
+		if fm, ok := featureMigrations[m.Version]; ok {
+			has, err := db.hasFeature(fm.feature)
+			if err != nil {
+				return err
+			}
+			if !has {
+				if done {
+					if err := db.runMigration(m, fm.suspend, true); err != nil {
+						return err
+					}
+					delete(applied, m.Version)
+				}
+				continue
+			}
+		}
+		if done {
+			continue
+		}
+		if err := db.runMigration(m, m.Up, false); err != nil {
+			return err
+		}
+		applied[m.Version] = appliedMigration{}
+	}
+
+	_, db.searchIndex = applied[searchIndexVersion]
+	return nil
+}
+
+// Rollback runs the down migrations of every applied version above
+// target, newest first. It refuses if any of them has no down migration.
+func (db *DB) Rollback(target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := db.appliedMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	if err := checkApplied(migrations, applied); err != nil {
+		return err
+	}
+
+	// Refuse before anything is rolled back, rather than stop halfway
+	var steps []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("%w: migration %03d_%s cannot be rolled back", domain.ErrMigrationFailed, m.Version, m.Name)
+		}
+		steps = append(steps, m)
+	}
+
+	for _, m := range steps {
+		if err := db.runMigration(m, m.Down, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkApplied verifies applied migrations against the embedded files
+func checkApplied(migrations []Migration, applied map[int]appliedMigration) error {
+	known := make(map[int]bool)
+	for _, m := range migrations {
+		known[m.Version] = true
+		a, ok := applied[m.Version]
+		if ok && a.checksum != m.Checksum {
+			return fmt.Errorf("%w: migration %03d_%s changed after it was applied", domain.ErrMigrationFailed, m.Version, m.Name)
+		}
+	}
+
+	var unknown []string
+	for version := range applied {
+		if !known[version] {
+			unknown = append(unknown, fmt.Sprintf("%03d", version))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: database has migrations %s unknown to this version of lazytodo",
+			domain.ErrMigrationFailed, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// runMigration runs one migration script and records it in a transaction
+func (db *DB) runMigration(m Migration, script string, down bool) error {
+	direction := "migration"
+	if down {
+		direction = "rollback"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("%w: %s %03d_%s: %v", domain.ErrMigrationFailed, direction, m.Version, m.Name, err)
+	}
+	if step := migrationSteps[m.Version]; step != nil && !down {
+		if err := step(context.Background(), tx); err != nil {
+			return fmt.Errorf("%w: %s %03d_%s: %v", domain.ErrMigrationFailed, direction, m.Version, m.Name, err)
+		}
+	}
+
+	if down {
+		_, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, m.Version)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO schema_version (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(version) DO UPDATE SET name = excluded.name, checksum = excluded.checksum,
+				applied_at = excluded.applied_at
+		`, m.Version, m.Name, m.Checksum, domain.FormatTime(time.Now()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record %s %03d: %w", direction, m.Version, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// migratedDB creates a migrated database and returns its path
+func migratedDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lazytodo.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checksumOf returns the recorded checksum of a version
+func checksumOf(t *testing.T, db *DB, version int) sql.NullString {
+	t.Helper()
+	var sum sql.NullString
+	if err := db.QueryRow(`SELECT checksum FROM schema_version WHERE version = ?`, version).Scan(&sum); err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestMigrationStatusOnlyReads(t *testing.T) {
+	path := migratedDB(t)
+
+	// As recorded before checksums existed
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE schema_version SET checksum = NULL WHERE version = 2`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	ro, err := NewReadOnlyDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := ro.MigrationStatus()
+	ro.Close()
+	if err != nil {
+		t.Fatalf("status on a read-only database: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied && s.Needs == "" || s.Modified || s.Unknown {
+			t.Errorf("migration %03d: applied %v, modified %v, unknown %v", s.Version, s.Applied, s.Modified, s.Unknown)
+		}
+	}
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if sum := checksumOf(t, db, 2); sum.Valid {
+		t.Error("status recorded a checksum")
+	}
+
+	// Migrate fills it in
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if sum := checksumOf(t, db, 2); !sum.Valid {
+		t.Error("migrate left the checksum empty")
+	}
+}
+
+func TestRollbackAndMigrateAgain(t *testing.T) {
+	db, err := NewDB(migratedDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Rollback(3); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate after rollback: %v", err)
+	}
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied && s.Needs == "" {
+			t.Errorf("migration %03d is pending after migrating again", s.Version)
+		}
+	}
+}
+
+func TestRollbackRefusesAMigrationWithoutDown(t *testing.T) {
+	db, err := NewDB(migratedDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Rollback(2)
+	if !errors.Is(err, domain.ErrMigrationFailed) {
+		t.Fatalf("rollback past 003: got %v, want %v", err, domain.ErrMigrationFailed)
+	}
+
+	// Nothing was rolled back on the way
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied && s.Needs == "" {
+			t.Errorf("migration %03d was rolled back before the refusal", s.Version)
+		}
+	}
+}
+
+func TestSearchIndexMigrationFollowsTheBuild(t *testing.T) {
+	s := newTestStore(t)
+	fts5, err := s.db.hasFeature("FTS5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := s.workspace(t, "Home", "")
+
+	if !fts5 {
+		// As a build with FTS5 left it
+		s.todo(t, ws.ID, "", "Buy milk")
+		m := searchIndexMigration(t)
+		_, err := s.db.Exec(`
+			CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+				INSERT INTO todos_fts (rowid, description) VALUES (new.rowid, new.description);
+			END;
+			INSERT INTO schema_version (version, name, checksum) VALUES (?, ?, ?);
+		`, m.Version, m.Name, m.Checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		// As a build without FTS5 left it
+		if _, err := s.db.Exec(dropSearchTriggers); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.db.Exec(`DELETE FROM schema_version WHERE version = ?`, searchIndexVersion); err != nil {
+			t.Fatal(err)
+		}
+		s.todo(t, ws.ID, "", "Buy milk")
+	}
+
+	if err := s.db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.db.HasSearchIndex() != fts5 {
+		t.Errorf("search index in use: %v, want %v", s.db.HasSearchIndex(), fts5)
+	}
+	statuses, err := s.db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if st.Version != searchIndexVersion {
+			continue
+		}
+		if fts5 && !st.Applied || !fts5 && (st.Applied || st.Needs != "FTS5") {
+			t.Errorf("with FTS5 %v the migration is applied %v, needs %q", fts5, st.Applied, st.Needs)
+		}
+	}
+
+	// Writes work without the triggers, and the rebuilt index has them
+	s.todo(t, ws.ID, "", "Milk the goat")
+	if found := s.search(t, "milk"); len(found) != 2 {
+		t.Errorf("search found %q, want both todos", found)
+	}
+}
+
+// searchIndexMigration returns the migration that creates todos_fts
+func searchIndexMigration(t *testing.T) Migration {
+	t.Helper()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.Version == searchIndexVersion {
+			return m
+		}
+	}
+	t.Fatal("no search index migration")
+	return Migration{}
+}
@@ -0,0 +1,8 @@
+-- Revert lazytodo initial schema
+-- schema_version is kept; the migration runner manages it
+
+DROP TABLE IF EXISTS operation_log;
+DROP TABLE IF EXISTS todo_closure;
+DROP TABLE IF EXISTS todos;
+DROP TABLE IF EXISTS workspace_closure;
+DROP TABLE IF EXISTS workspaces;
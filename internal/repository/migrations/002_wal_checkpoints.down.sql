@@ -0,0 +1,3 @@
+-- Revert WAL compaction checkpoints
+
+DROP TABLE IF EXISTS wal_checkpoints;
@@ -0,0 +1,13 @@
+-- WAL compaction checkpoints
+-- Applied operations past the undo retention are folded into the main
+-- tables and dropped from operation_log; each compaction leaves a row here.
+
+CREATE TABLE IF NOT EXISTS wal_checkpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    last_op_id INTEGER NOT NULL,   -- Newest operation folded into the main tables
+    operations INTEGER NOT NULL,   -- Operations dropped from the log
+    undo_groups INTEGER NOT NULL,  -- Undo groups dropped from the log
+    created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+INSERT OR IGNORE INTO schema_version (version) VALUES (2);
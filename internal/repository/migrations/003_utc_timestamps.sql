@@ -0,0 +1,26 @@
+-- Store every timestamp as UTC RFC3339 ("2006-01-02T15:04:05Z")
+-- Older rows hold either RFC3339 with a local offset, written by the
+-- repositories, or "2006-01-02 15:04:05" UTC, written by column defaults.
+-- strftime understands both; values it cannot read are left for the
+-- application to report.
+
+UPDATE workspaces SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at),
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updated_at), updated_at),
+    deleted_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', deleted_at), deleted_at);
+
+UPDATE todos SET
+    due_date = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', due_date), due_date),
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at),
+    updated_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updated_at), updated_at),
+    completed_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', completed_at), completed_at),
+    deleted_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', deleted_at), deleted_at);
+
+UPDATE operation_log SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at);
+
+UPDATE wal_checkpoints SET
+    created_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), created_at);
+
+UPDATE schema_version SET
+    applied_at = COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', applied_at), applied_at);
@@ -0,0 +1,37 @@
+-- Revert saved searches
+-- View operations are dropped from the log, which then goes back to
+-- accepting only workspaces and todos.
+
+DROP TABLE IF EXISTS saved_views;
+
+DELETE FROM operation_log WHERE entity_type = 'view';
+
+CREATE TABLE operation_log_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    operation_type TEXT NOT NULL,  -- 'create', 'update', 'delete', 'move'
+    entity_type TEXT NOT NULL,     -- 'workspace', 'todo'
+    entity_id TEXT NOT NULL,
+    payload TEXT NOT NULL,         -- JSON (includes previous state)
+    applied INTEGER NOT NULL DEFAULT 0,
+    is_undone INTEGER NOT NULL DEFAULT 0,
+    undo_group_id TEXT,            -- Group related operations
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+
+    CHECK (operation_type IN ('create', 'update', 'delete', 'move')),
+    CHECK (entity_type IN ('workspace', 'todo'))
+);
+
+INSERT INTO operation_log_old (id, operation_type, entity_type, entity_id, payload,
+    applied, is_undone, undo_group_id, created_at)
+SELECT id, operation_type, entity_type, entity_id, payload,
+    applied, is_undone, undo_group_id, created_at
+FROM operation_log;
+
+DELETE FROM sqlite_sequence WHERE name = 'operation_log_old';
+UPDATE sqlite_sequence SET name = 'operation_log_old' WHERE name = 'operation_log';
+
+DROP TABLE operation_log;
+ALTER TABLE operation_log_old RENAME TO operation_log;
+
+CREATE INDEX IF NOT EXISTS idx_operation_log_applied ON operation_log(applied);
+CREATE INDEX IF NOT EXISTS idx_operation_log_undo ON operation_log(is_undone, created_at DESC);
@@ -0,0 +1,43 @@
+-- Saved searches shown as smart views next to the workspaces
+-- Saving, renaming and deleting a view go through the WAL like any other
+-- change, so operation_log is rebuilt to accept the 'view' entity type.
+-- Its id sequence is carried over so compacted ids are never reused.
+
+CREATE TABLE IF NOT EXISTS saved_views (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,  -- Search in the language of package query
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE operation_log_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    operation_type TEXT NOT NULL,  -- 'create', 'update', 'delete', 'move'
+    entity_type TEXT NOT NULL,     -- 'workspace', 'todo', 'view'
+    entity_id TEXT NOT NULL,
+    payload TEXT NOT NULL,         -- JSON (includes previous state)
+    applied INTEGER NOT NULL DEFAULT 0,
+    is_undone INTEGER NOT NULL DEFAULT 0,
+    undo_group_id TEXT,            -- Group related operations
+    created_at TEXT NOT NULL DEFAULT (datetime('now')),
+
+    CHECK (operation_type IN ('create', 'update', 'delete', 'move')),
+    CHECK (entity_type IN ('workspace', 'todo', 'view'))
+);
+
+INSERT INTO operation_log_new (id, operation_type, entity_type, entity_id, payload,
+    applied, is_undone, undo_group_id, created_at)
+SELECT id, operation_type, entity_type, entity_id, payload,
+    applied, is_undone, undo_group_id, created_at
+FROM operation_log;
+
+DELETE FROM sqlite_sequence WHERE name = 'operation_log_new';
+UPDATE sqlite_sequence SET name = 'operation_log_new' WHERE name = 'operation_log';
+
+DROP TABLE operation_log;
+ALTER TABLE operation_log_new RENAME TO operation_log;
+
+CREATE INDEX IF NOT EXISTS idx_operation_log_applied ON operation_log(applied);
+CREATE INDEX IF NOT EXISTS idx_operation_log_undo ON operation_log(is_undone, created_at DESC);
@@ -0,0 +1,9 @@
+-- Revert the denormalized parent and depth of todos
+
+DROP TRIGGER IF EXISTS todo_closure_tree_insert;
+DROP TRIGGER IF EXISTS todo_closure_tree_delete;
+DROP INDEX IF EXISTS idx_todos_workspace_active;
+DROP INDEX IF EXISTS idx_todos_parent;
+
+ALTER TABLE todos DROP COLUMN parent_id;
+ALTER TABLE todos DROP COLUMN depth;
@@ -0,0 +1,37 @@
+-- Denormalize each todo's parent and depth
+-- Reading them from todo_closure took two correlated subqueries per row,
+-- which dominated loading and searching large workspaces. Triggers on
+-- todo_closure keep the columns in step with every write to it, so the
+-- applier, undo and repairs need no special handling.
+
+ALTER TABLE todos ADD COLUMN parent_id TEXT;
+ALTER TABLE todos ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+
+UPDATE todos SET
+    parent_id = (SELECT ancestor_id FROM todo_closure WHERE descendant_id = todos.id AND depth = 1),
+    depth = COALESCE((SELECT MAX(depth) FROM todo_closure WHERE descendant_id = todos.id), 0);
+
+-- Loading a workspace reads its active todos; without this index the
+-- planner scans every active todo through idx_todos_search
+CREATE INDEX IF NOT EXISTS idx_todos_workspace_active ON todos(workspace_id, deleted_at, is_archived);
+
+-- Sibling groups for ordering
+CREATE INDEX IF NOT EXISTS idx_todos_parent ON todos(workspace_id, parent_id);
+
+-- A new ancestor can only deepen a todo
+CREATE TRIGGER IF NOT EXISTS todo_closure_tree_insert AFTER INSERT ON todo_closure
+WHEN new.depth > 0 BEGIN
+    UPDATE todos SET
+        parent_id = CASE WHEN new.depth = 1 THEN new.ancestor_id ELSE parent_id END,
+        depth = MAX(depth, new.depth)
+    WHERE id = new.descendant_id;
+END;
+
+-- A removed ancestor may have been the parent or the deepest one
+CREATE TRIGGER IF NOT EXISTS todo_closure_tree_delete AFTER DELETE ON todo_closure
+WHEN old.depth > 0 BEGIN
+    UPDATE todos SET
+        parent_id = (SELECT ancestor_id FROM todo_closure WHERE descendant_id = old.descendant_id AND depth = 1),
+        depth = COALESCE((SELECT MAX(depth) FROM todo_closure WHERE descendant_id = old.descendant_id), 0)
+    WHERE id = old.descendant_id;
+END;
@@ -0,0 +1,3 @@
+-- Revert the tags table; tags stay in the descriptions
+
+DROP TABLE IF EXISTS todo_tags;
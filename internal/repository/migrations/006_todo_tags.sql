@@ -0,0 +1,14 @@
+-- Tags of each todo
+-- Tags are parsed from descriptions in Go, which knows every script's
+-- letters. The applier rewrites a todo's tags whenever it writes the todo;
+-- existing descriptions are parsed once, right after this script.
+
+CREATE TABLE IF NOT EXISTS todo_tags (
+    todo_id TEXT NOT NULL,
+    tag TEXT NOT NULL,  -- Without the @, e.g. "work/backend"
+
+    PRIMARY KEY (todo_id, tag),
+    FOREIGN KEY (todo_id) REFERENCES todos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_tags_tag ON todo_tags(tag);
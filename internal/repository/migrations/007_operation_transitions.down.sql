@@ -0,0 +1,6 @@
+-- Revert the undo and redo history; discarded operations are dropped
+
+DROP TABLE IF EXISTS operation_transitions;
+
+DELETE FROM operation_log WHERE is_discarded = 1;
+ALTER TABLE operation_log DROP COLUMN is_discarded;
@@ -0,0 +1,24 @@
+-- Undo and redo history
+-- Time travel rebuilds the state at a past time by stepping back through
+-- every change since, so each apply, undo and redo of an operation is
+-- recorded in order. Undone operations dropped from the redo branch by a
+-- later change stay in the log, marked discarded, for the same reason.
+-- Operations logged before this script get their apply at their creation
+-- time, and those undone already an undo right after it.
+
+ALTER TABLE operation_log ADD COLUMN is_discarded INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS operation_transitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    operation_id INTEGER NOT NULL,
+    is_undone INTEGER NOT NULL,    -- 1 for an undo, 0 for an apply or redo
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_operation_transitions_created ON operation_transitions(created_at);
+
+INSERT INTO operation_transitions (operation_id, is_undone, created_at)
+SELECT id, 0, created_at FROM operation_log WHERE applied = 1 ORDER BY id;
+
+INSERT INTO operation_transitions (operation_id, is_undone, created_at)
+SELECT id, 1, created_at FROM operation_log WHERE applied = 1 AND is_undone = 1 ORDER BY id DESC;
@@ -0,0 +1,4 @@
+-- Revert the deletion batches; the trash groups by deletion time again
+
+ALTER TABLE todos DROP COLUMN deleted_batch;
+ALTER TABLE workspaces DROP COLUMN deleted_batch;
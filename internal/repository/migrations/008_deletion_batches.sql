@@ -0,0 +1,11 @@
+-- Deletion batches
+-- Every delete gives the rows it sends to the trash one batch id, so the
+-- trash lists and restores what one delete removed as one entry even when
+-- another delete ran in the same second. Rows deleted before this script
+-- take their deletion time as their batch, which is how they were grouped.
+
+ALTER TABLE todos ADD COLUMN deleted_batch TEXT;
+ALTER TABLE workspaces ADD COLUMN deleted_batch TEXT;
+
+UPDATE todos SET deleted_batch = deleted_at WHERE deleted_at IS NOT NULL;
+UPDATE workspaces SET deleted_batch = deleted_at WHERE deleted_at IS NOT NULL;
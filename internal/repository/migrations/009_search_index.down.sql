@@ -0,0 +1,6 @@
+-- Revert the search index; search falls back to LIKE matching
+
+DROP TRIGGER IF EXISTS todos_fts_insert;
+DROP TRIGGER IF EXISTS todos_fts_delete;
+DROP TRIGGER IF EXISTS todos_fts_update;
+DROP TABLE IF EXISTS todos_fts;
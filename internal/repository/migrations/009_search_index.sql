@@ -0,0 +1,32 @@
+-- Search index
+-- Todo descriptions are indexed in an FTS5 table, which needs SQLite built
+-- with FTS5 (go build -tags sqlite_fts5, as make does). Without it this
+-- migration stays pending and search falls back to LIKE matching. The
+-- index reads its text from todos by rowid, and the triggers keep it in
+-- step with every write to todos. A build without FTS5 drops the triggers
+-- of an indexed database and marks this migration pending again, so the
+-- script recreates them and rebuilds the stale index.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(
+    description,
+    content = 'todos',
+    content_rowid = 'rowid',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+DROP TRIGGER IF EXISTS todos_fts_insert;
+DROP TRIGGER IF EXISTS todos_fts_delete;
+DROP TRIGGER IF EXISTS todos_fts_update;
+
+CREATE TRIGGER todos_fts_insert AFTER INSERT ON todos BEGIN
+    INSERT INTO todos_fts (rowid, description) VALUES (new.rowid, new.description);
+END;
+CREATE TRIGGER todos_fts_delete AFTER DELETE ON todos BEGIN
+    INSERT INTO todos_fts (todos_fts, rowid, description) VALUES ('delete', old.rowid, old.description);
+END;
+CREATE TRIGGER todos_fts_update AFTER UPDATE OF description ON todos BEGIN
+    INSERT INTO todos_fts (todos_fts, rowid, description) VALUES ('delete', old.rowid, old.description);
+    INSERT INTO todos_fts (rowid, description) VALUES (new.rowid, new.description);
+END;
+
+INSERT INTO todos_fts (todos_fts) VALUES ('rebuild');
@@ -0,0 +1,529 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Moving todos and workspaces must keep both closure tables consistent,
+// along with the parent and depth stored on each todo. A table of moves
+// checks which moves are accepted and which are rejected. Random
+// sequences of moves and undos then run against a model of the tree, and
+// after every step the stored parent of each node must match the model
+// and the integrity checker must find nothing.
+
+// tree is the expected shape of both trees
+type tree struct {
+	wsParent   map[string]string
+	todoParent map[string]string
+	todoWs     map[string]string
+}
+
+func newTree() *tree {
+	return &tree{
+		wsParent:   make(map[string]string),
+		todoParent: make(map[string]string),
+		todoWs:     make(map[string]string),
+	}
+}
+
+func (m *tree) clone() *tree {
+	c := newTree()
+	for k, v := range m.wsParent {
+		c.wsParent[k] = v
+	}
+	for k, v := range m.todoParent {
+		c.todoParent[k] = v
+	}
+	for k, v := range m.todoWs {
+		c.todoWs[k] = v
+	}
+	return c
+}
+
+// within reports whether id is root or one of its descendants
+func within(parent map[string]string, root, id string) bool {
+	for n := id; n != ""; n = parent[n] {
+		if n == root {
+			return true
+		}
+	}
+	return false
+}
+
+// expectMove returns the error a todo move should fail with, or nil
+func (m *tree) expectMove(id, parentID, workspaceID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if within(m.todoParent, id, parentID) {
+		return domain.ErrCircularReference
+	}
+	if workspaceID == "" {
+		workspaceID = m.todoWs[id]
+	}
+	if m.todoWs[parentID] != workspaceID {
+		return domain.ErrInvalidOperation
+	}
+	return nil
+}
+
+// move applies a todo move that succeeded to the model
+func (m *tree) move(id, parentID, workspaceID string) {
+	m.todoParent[id] = parentID
+	if workspaceID == "" {
+		return
+	}
+	for n := range m.todoWs {
+		if within(m.todoParent, id, n) {
+			m.todoWs[n] = workspaceID
+		}
+	}
+}
+
+// expectWorkspaceMove returns the error a workspace move should fail with
+func (m *tree) expectWorkspaceMove(id, parentID string) error {
+	if parentID != "" && within(m.wsParent, id, parentID) {
+		return domain.ErrCircularReference
+	}
+	return nil
+}
+
+// create stores the workspaces and todos of m, parents first
+func (s *testStore) create(t *testing.T, m *tree, wsOrder, todoOrder []string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, id := range wsOrder {
+		ws := &domain.Workspace{ID: id, Name: id, ParentID: m.wsParent[id]}
+		if err := s.workspaces.Create(ctx, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range todoOrder {
+		todo := &domain.Todo{
+			ID:          id,
+			WorkspaceID: m.todoWs[id],
+			ParentID:    m.todoParent[id],
+			Description: id,
+			Status:      domain.StatusPending,
+			Urgency:     domain.UrgencyMedium,
+		}
+		if err := s.todos.Create(ctx, todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// verify compares the stored parents and depths with m and runs the
+// integrity checker
+func (s *testStore) verify(m *tree) error {
+	ctx := context.Background()
+	workspaces, err := s.workspaces.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(workspaces) != len(m.wsParent) {
+		return fmt.Errorf("%d workspaces stored, want %d", len(workspaces), len(m.wsParent))
+	}
+	for _, ws := range workspaces {
+		if ws.ParentID != m.wsParent[ws.ID] {
+			return fmt.Errorf("workspace %s is under %q, want %q", ws.ID, ws.ParentID, m.wsParent[ws.ID])
+		}
+
+		todos, err := s.todos.GetByWorkspace(ctx, ws.ID, true)
+		if err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			if m.todoWs[todo.ID] != ws.ID {
+				return fmt.Errorf("todo %s is in %s, want %s", todo.ID, ws.ID, m.todoWs[todo.ID])
+			}
+			if todo.ParentID != m.todoParent[todo.ID] {
+				return fmt.Errorf("todo %s is under %q, want %q", todo.ID, todo.ParentID, m.todoParent[todo.ID])
+			}
+			depth := 0
+			for n := m.todoParent[todo.ID]; n != ""; n = m.todoParent[n] {
+				depth++
+			}
+			if todo.Depth != depth {
+				return fmt.Errorf("todo %s is at depth %d, want %d", todo.ID, todo.Depth, depth)
+			}
+		}
+	}
+
+	issues, err := CheckIntegrity(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		return issues[0]
+	}
+	return nil
+}
+
+// checkResult compares the error a move returned with the expected one
+func checkResult(err, want error) error {
+	switch {
+	case want == nil && err != nil:
+		return fmt.Errorf("unexpected error: %w", err)
+	case want != nil && err == nil:
+		return fmt.Errorf("succeeded, want %v", want)
+	case want != nil && !errors.Is(err, want):
+		return fmt.Errorf("failed with %v, want %v", err, want)
+	}
+	return nil
+}
+
+// moveFixture returns the tree every move case starts from:
+//
+//	home            work
+//	├─ plan         └─ report
+//	│  └─ buy
+//	│     └─ seeds
+//	├─ clean
+//	└─ garden (workspace)
+func moveFixture() (m *tree, wsOrder, todoOrder []string) {
+	m = newTree()
+	m.wsParent["home"], m.wsParent["garden"], m.wsParent["work"] = "", "home", ""
+	m.todoParent["buy"], m.todoParent["seeds"] = "plan", "buy"
+	for _, id := range []string{"plan", "buy", "seeds", "clean"} {
+		m.todoWs[id] = "home"
+	}
+	m.todoWs["report"] = "work"
+
+	return m, []string{"home", "garden", "work"}, []string{"plan", "buy", "seeds", "clean", "report"}
+}
+
+func TestMove(t *testing.T) {
+	tests := []struct {
+		name        string
+		workspace   bool   // Move a workspace rather than a todo
+		deleteFirst string // Todo or workspace deleted before the move
+		id          string
+		parentID    string
+		workspaceID string // Target workspace of a todo; empty keeps it
+		want        error
+	}{
+		{name: "todo to the top level", id: "buy"},
+		{name: "todo under a sibling", id: "clean", parentID: "plan"},
+		{name: "todo under its grandparent", id: "seeds", parentID: "plan"},
+		{name: "todo under itself", id: "plan", parentID: "plan", want: domain.ErrCircularReference},
+		{name: "todo under its child", id: "plan", parentID: "buy", want: domain.ErrCircularReference},
+		{name: "todo under its grandchild", id: "plan", parentID: "seeds", want: domain.ErrCircularReference},
+		{name: "todo under a todo in another workspace", id: "buy", parentID: "report", want: domain.ErrInvalidOperation},
+		{name: "todo to another workspace under a todo there", id: "buy", parentID: "report", workspaceID: "work"},
+		{name: "todo to another workspace under a todo left behind", id: "buy", parentID: "clean", workspaceID: "work", want: domain.ErrInvalidOperation},
+		{name: "todo to the top level of another workspace", id: "plan", workspaceID: "work"},
+		{name: "todo under a deleted todo", deleteFirst: "clean", id: "buy", parentID: "clean", want: domain.ErrNotFound},
+		{name: "todo to a deleted workspace", deleteFirst: "garden", id: "plan", workspaceID: "garden", want: domain.ErrNotFound},
+		{name: "workspace under itself", workspace: true, id: "home", parentID: "home", want: domain.ErrCircularReference},
+		{name: "workspace under its child", workspace: true, id: "home", parentID: "garden", want: domain.ErrCircularReference},
+		{name: "workspace under another tree", workspace: true, id: "work", parentID: "garden"},
+		{name: "workspace to the top level", workspace: true, id: "garden"},
+		{name: "workspace under a deleted workspace", workspace: true, deleteFirst: "garden", id: "work", parentID: "garden", want: domain.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			ctx := context.Background()
+			m, wsOrder, todoOrder := moveFixture()
+			s.create(t, m, wsOrder, todoOrder)
+
+			if _, ok := m.wsParent[tt.deleteFirst]; ok {
+				if err := s.workspaces.Delete(ctx, tt.deleteFirst); err != nil {
+					t.Fatal(err)
+				}
+				delete(m.wsParent, tt.deleteFirst)
+			} else if tt.deleteFirst != "" {
+				if err := s.todos.Delete(ctx, tt.deleteFirst); err != nil {
+					t.Fatal(err)
+				}
+				delete(m.todoParent, tt.deleteFirst)
+				delete(m.todoWs, tt.deleteFirst)
+			}
+
+			var err error
+			if tt.workspace {
+				err = s.workspaces.Move(ctx, tt.id, tt.parentID)
+			} else {
+				err = s.todos.Move(ctx, tt.id, tt.parentID, tt.workspaceID)
+			}
+			if err := checkResult(err, tt.want); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == nil {
+				if tt.workspace {
+					m.wsParent[tt.id] = tt.parentID
+				} else {
+					m.move(tt.id, tt.parentID, tt.workspaceID)
+				}
+			}
+			if err := s.verify(m); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRandomMovesKeepTheTreesConsistent(t *testing.T) {
+	runs, steps := 20, 60
+	if testing.Short() {
+		runs = 4
+	}
+	seed := time.Now().UnixNano()
+	for i := 0; i < runs; i++ {
+		runSeed := seed + int64(i)
+		t.Run(fmt.Sprintf("seed %d", runSeed), func(t *testing.T) {
+			t.Parallel()
+			checkRandomMoves(t, runSeed, steps)
+		})
+	}
+}
+
+// checkRandomMoves runs random moves and undos, checking the trees after
+// each
+func checkRandomMoves(t *testing.T, seed int64, steps int) {
+	rng := rand.New(rand.NewSource(seed))
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	// Two workspace trees with todos scattered over them
+	m := newTree()
+	wsIDs := []string{"ws-0", "ws-1", "ws-2", "ws-3", "ws-4"}
+	m.wsParent["ws-0"], m.wsParent["ws-1"], m.wsParent["ws-2"] = "", "ws-0", "ws-1"
+	m.wsParent["ws-3"], m.wsParent["ws-4"] = "", "ws-3"
+
+	var todoIDs []string
+	for i := 0; i < 16; i++ {
+		id := fmt.Sprintf("t-%02d", i)
+		ws := wsIDs[rng.Intn(len(wsIDs))]
+		m.todoWs[id] = ws
+
+		var candidates []string
+		for _, p := range todoIDs {
+			if m.todoWs[p] == ws {
+				candidates = append(candidates, p)
+			}
+		}
+		if len(candidates) > 0 && rng.Intn(3) > 0 {
+			m.todoParent[id] = candidates[rng.Intn(len(candidates))]
+		}
+		todoIDs = append(todoIDs, id)
+	}
+
+	s.create(t, m, wsIDs, todoIDs)
+	if err := s.verify(m); err != nil {
+		t.Fatalf("fixture: %v", err)
+	}
+
+	// Trees before each move that can still be undone
+	var history []*tree
+	pick := func(ids []string) string {
+		if rng.Intn(5) == 0 {
+			return ""
+		}
+		return ids[rng.Intn(len(ids))]
+	}
+
+	for step := 0; step < steps; step++ {
+		var desc string
+		var err error
+
+		switch r := rng.Intn(10); {
+		case r < 2 && len(history) > 0:
+			desc = "undo"
+			s.undo(t)
+			m = history[len(history)-1]
+			history = history[:len(history)-1]
+
+		case r < 4:
+			id, parentID := wsIDs[rng.Intn(len(wsIDs))], pick(wsIDs)
+			desc = fmt.Sprintf("move workspace %s under %q", id, parentID)
+			want := m.expectWorkspaceMove(id, parentID)
+			err = checkResult(s.workspaces.Move(wal.WithUndoGroup(ctx), id, parentID), want)
+			if err == nil && want == nil {
+				history = append(history, m.clone())
+				m.wsParent[id] = parentID
+			}
+
+		default:
+			id, parentID := todoIDs[rng.Intn(len(todoIDs))], pick(todoIDs)
+			workspaceID := ""
+			if rng.Intn(4) == 0 {
+				workspaceID = wsIDs[rng.Intn(len(wsIDs))]
+			}
+			desc = fmt.Sprintf("move todo %s under %q in %q", id, parentID, workspaceID)
+			want := m.expectMove(id, parentID, workspaceID)
+			err = checkResult(s.todos.Move(wal.WithUndoGroup(ctx), id, parentID, workspaceID), want)
+			if err == nil && want == nil {
+				history = append(history, m.clone())
+				m.move(id, parentID, workspaceID)
+			}
+		}
+
+		if err != nil {
+			t.Fatalf("step %d (%s): %v", step, desc, err)
+		}
+		if err := s.verify(m); err != nil {
+			t.Fatalf("after step %d (%s): %v", step, desc, err)
+		}
+	}
+}
+
+// The moves below are planned, then the tree changes before they are
+// written, the way it can when another process shares the database
+
+func TestStaleTodoMoveUnderItsOwnSubtreeIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	// Clean under plan's subtree is checked before clean moves into it
+	before, after, err := s.todos.planMove(ctx, "plan", "clean", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.todos.Move(ctx, "clean", "seeds", ""); err != nil {
+		t.Fatal(err)
+	}
+	m.move("clean", "seeds", "")
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpMove, "plan", before, after)
+	if !errors.Is(err, domain.ErrConflict) || !errors.Is(err, domain.ErrCircularReference) {
+		t.Fatalf("stale move: got %v, want a conflict on a circular reference", err)
+	}
+	if err := s.verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleTodoMoveUnderAParentInTheTrashIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	before, after, err := s.todos.planMove(ctx, "buy", "clean", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.todos.Delete(ctx, "clean"); err != nil {
+		t.Fatal(err)
+	}
+	delete(m.todoParent, "clean")
+	delete(m.todoWs, "clean")
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpMove, "buy", before, after)
+	if !errors.Is(err, domain.ErrConflict) || !errors.Is(err, domain.ErrInvalidOperation) {
+		t.Fatalf("stale move: got %v, want a conflict on an invalid operation", err)
+	}
+	if err := s.verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleTodoMoveUnderAParentInAnotherWorkspaceIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	before, after, err := s.todos.planMove(ctx, "buy", "clean", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.todos.Move(ctx, "clean", "", "work"); err != nil {
+		t.Fatal(err)
+	}
+	m.move("clean", "", "work")
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpMove, "buy", before, after)
+	if !errors.Is(err, domain.ErrConflict) || !errors.Is(err, domain.ErrInvalidOperation) {
+		t.Fatalf("stale move: got %v, want a conflict on an invalid operation", err)
+	}
+	if err := s.verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleTodoMoveOfASubtreeThatGrewIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	before, after, err := s.todos.planMove(ctx, "plan", "clean", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sprout := s.todo(t, "home", "seeds", "sprout")
+	m.todoParent[sprout.ID], m.todoWs[sprout.ID] = "seeds", "home"
+
+	err = recordOperation(ctx, s.wal, wal.EntityTodo, wal.OpMove, "plan", before, after)
+	if !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("stale move: got %v, want %v", err, domain.ErrConflict)
+	}
+	if err := s.verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleWorkspaceMoveUnderItsOwnSubtreeIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	before, after, err := s.workspaces.planMove(ctx, "home", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.workspaces.Move(ctx, "work", "garden"); err != nil {
+		t.Fatal(err)
+	}
+	m.wsParent["work"] = "garden"
+
+	err = recordOperation(ctx, s.wal, wal.EntityWorkspace, wal.OpMove, "home", before, after)
+	if !errors.Is(err, domain.ErrConflict) || !errors.Is(err, domain.ErrCircularReference) {
+		t.Fatalf("stale move: got %v, want a conflict on a circular reference", err)
+	}
+	if err := s.verify(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUndoOfAMoveUnderAParentInTheTrashFails(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	m, wsOrder, todoOrder := moveFixture()
+	s.create(t, m, wsOrder, todoOrder)
+
+	if err := s.todos.Move(ctx, "seeds", "clean", ""); err != nil {
+		t.Fatal(err)
+	}
+	m.move("seeds", "clean", "")
+
+	// Buy goes to the trash without the log, as another process would
+	// do it; undoing the move would put seeds back under it
+	if _, err := s.db.Exec(`UPDATE todos SET deleted_at = '2024-01-01T00:00:00Z', deleted_batch = 'b' WHERE id = 'buy'`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.wal.Undo(ctx, s.applier.RevertIn)
+	if !errors.Is(err, domain.ErrConflict) || !errors.Is(err, domain.ErrInvalidOperation) {
+		t.Fatalf("undo: got %v, want a conflict on an invalid operation", err)
+	}
+	if got := s.get(t, "seeds"); got.ParentID != "clean" {
+		t.Errorf("seeds is under %q, want it left under clean", got.ParentID)
+	}
+}
@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// Siblings are ordered by position, then by the same tie-breakers the
+// read queries use. Reordering and inserting renumber the whole sibling
+// group 0..n-1, which also clears the duplicate positions older versions
+// left behind.
+
+// sibling is one row of a sibling group
+type sibling struct {
+	id       string
+	position int
+	group    string // Rows only trade places with rows of the same group
+}
+
+// loadTodoSiblings returns the todos under parentID in a workspace, in
+// order. Todos only trade places with todos shown next to them, that is
+// with the same status and archived state.
+func loadTodoSiblings(ctx context.Context, q querier, workspaceID, parentID string) ([]sibling, error) {
+	query := `
+		SELECT t.id, t.position, t.status || ':' || t.is_archived
+		FROM todos t
+		WHERE t.workspace_id = ? AND t.deleted_at IS NULL AND `
+	args := []interface{}{workspaceID}
+	if parentID == "" {
+		query += `t.parent_id IS NULL`
+	} else {
+		query += `t.parent_id = ?`
+		args = append(args, parentID)
+	}
+	query += ` ORDER BY t.position, t.created_at, t.id`
+
+	return querySiblings(ctx, q, query, args...)
+}
+
+// todoGroup returns the group of a todo as loadTodoSiblings reads it
+func todoGroup(t *domain.Todo) string {
+	archived := "0"
+	if t.IsArchived {
+		archived = "1"
+	}
+	return string(t.Status) + ":" + archived
+}
+
+// loadWorkspaceSiblings returns the workspaces under parentID, in order
+func loadWorkspaceSiblings(ctx context.Context, q querier, parentID string) ([]sibling, error) {
+	query := `
+		SELECT w.id, w.position, ''
+		FROM workspaces w
+		LEFT JOIN workspace_closure p ON p.descendant_id = w.id AND p.depth = 1
+		WHERE w.deleted_at IS NULL AND `
+	var args []interface{}
+	if parentID == "" {
+		query += `p.ancestor_id IS NULL`
+	} else {
+		query += `p.ancestor_id = ?`
+		args = append(args, parentID)
+	}
+	query += ` ORDER BY w.position, w.name, w.id`
+
+	return querySiblings(ctx, q, query, args...)
+}
+
+func querySiblings(ctx context.Context, q querier, query string, args ...interface{}) ([]sibling, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load siblings: %w", err)
+	}
+	defer rows.Close()
+
+	var siblings []sibling
+	for rows.Next() {
+		var s sibling
+		if err := rows.Scan(&s.id, &s.position, &s.group); err != nil {
+			return nil, fmt.Errorf("failed to scan sibling: %w", err)
+		}
+		siblings = append(siblings, s)
+	}
+
+	return siblings, rows.Err()
+}
+
+// shiftSibling returns the order of siblings after id moves offset places
+// among the siblings of its group, or nil if it cannot move that way
+func shiftSibling(siblings []sibling, id string, offset int) []string {
+	self := -1
+	for i, s := range siblings {
+		if s.id == id {
+			self = i
+		}
+	}
+	if self < 0 {
+		return nil
+	}
+
+	var peers []int // Indexes of the siblings in the same group
+	at := 0
+	for i, s := range siblings {
+		if s.group != siblings[self].group {
+			continue
+		}
+		if i == self {
+			at = len(peers)
+		}
+		peers = append(peers, i)
+	}
+
+	target := at + offset
+	if target < 0 {
+		target = 0
+	}
+	if target > len(peers)-1 {
+		target = len(peers) - 1
+	}
+	if target == at {
+		return nil
+	}
+
+	// Take id out and put it next to the peer it passes
+	anchor := siblings[peers[target]].id
+	var order []string
+	for _, s := range siblings {
+		if s.id == id {
+			continue
+		}
+		if s.id == anchor && offset < 0 {
+			order = append(order, id)
+		}
+		order = append(order, s.id)
+		if s.id == anchor && offset > 0 {
+			order = append(order, id)
+		}
+	}
+	return order
+}
+
+// insertSibling returns the order of siblings with newID right after
+// afterID, or first when afterID is empty. An afterID that is not a
+// sibling puts newID last.
+func insertSibling(siblings []sibling, newID, afterID string) []string {
+	order := make([]string, 0, len(siblings)+1)
+	placed := false
+	if afterID == "" {
+		order = append(order, newID)
+		placed = true
+	}
+	for _, s := range siblings {
+		order = append(order, s.id)
+		if s.id == afterID && !placed {
+			order = append(order, newID)
+			placed = true
+		}
+	}
+	if !placed {
+		order = append(order, newID)
+	}
+	return order
+}
+
+// groupAnchor returns the sibling a new row of group goes after when it
+// is inserted after afterID. Groups are shown apart, so after a row of
+// another group it goes after the last row of its own group instead, if
+// there is one.
+func groupAnchor(siblings []sibling, group, afterID string) string {
+	if afterID == "" {
+		return ""
+	}
+	last := ""
+	for _, s := range siblings {
+		if s.id == afterID && s.group == group {
+			return afterID
+		}
+		if s.group == group {
+			last = s.id
+		}
+	}
+	if last == "" {
+		return afterID
+	}
+	return last
+}
+
+// nextPosition returns the position after the last sibling
+func nextPosition(siblings []sibling) int {
+	next := 0
+	for _, s := range siblings {
+		if s.position >= next {
+			next = s.position + 1
+		}
+	}
+	return next
+}
+
+// renumber returns the new position of every row whose position changes
+// when the group is numbered in order. Rows not among siblings are new.
+func renumber(siblings []sibling, order []string) map[string]int {
+	current := make(map[string]int, len(siblings))
+	for _, s := range siblings {
+		current[s.id] = s.position
+	}
+
+	changes := make(map[string]int)
+	for i, id := range order {
+		if pos, ok := current[id]; !ok || pos != i {
+			changes[id] = i
+		}
+	}
+	return changes
+}
+
+// changedIDs returns the IDs in changes except skip, sorted
+func changedIDs(changes map[string]int, skip string) []string {
+	var ids []string
+	for id := range changes {
+		if id != skip {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// preorder returns the indexes of n rows in depth-first order: each row
+// is followed by its children, in the order the rows came in. Rows whose
+// parent is not among them are treated as roots.
+func preorder(n int, id, parent func(i int) string) []int {
+	index := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		index[id(i)] = i
+	}
+
+	children := make(map[int][]int, n)
+	var roots []int
+	for i := 0; i < n; i++ {
+		if p, ok := index[parent(i)]; ok && p != i {
+			children[p] = append(children[p], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	order := make([]int, 0, n)
+	var visit func(i int)
+	visit = func(i int) {
+		order = append(order, i)
+		for _, c := range children[i] {
+			visit(c)
+		}
+	}
+	for _, i := range roots {
+		visit(i)
+	}
+	return order
+}
+
+// todosInTreeOrder puts each todo right after its parent, keeping the
+// order the query gave to siblings
+func todosInTreeOrder(todos []*domain.Todo) []*domain.Todo {
+	order := preorder(len(todos),
+		func(i int) string { return todos[i].ID },
+		func(i int) string { return todos[i].ParentID })
+
+	sorted := make([]*domain.Todo, len(order))
+	for i, j := range order {
+		sorted[i] = todos[j]
+	}
+	return sorted
+}
+
+// workspacesInTreeOrder puts each workspace right after its parent,
+// keeping the order the query gave to siblings
+func workspacesInTreeOrder(workspaces []*domain.Workspace) []*domain.Workspace {
+	order := preorder(len(workspaces),
+		func(i int) string { return workspaces[i].ID },
+		func(i int) string { return workspaces[i].ParentID })
+
+	sorted := make([]*domain.Workspace, len(order))
+	for i, j := range order {
+		sorted[i] = workspaces[j]
+	}
+	return sorted
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/query"
+)
+
+// compileFilters turns query filters into SQL conditions on todos t, each
+// starting with AND. Todos of deleted workspaces are always left out, and
+// archived todos unless includeArchived is set or an archived: filter says
+// otherwise.
+func compileFilters(filters []query.Filter, includeArchived bool) (string, []interface{}) {
+	var b strings.Builder
+	var args []interface{}
+
+	b.WriteString(` AND EXISTS (
+		SELECT 1 FROM workspaces tw WHERE tw.id = t.workspace_id AND tw.deleted_at IS NULL
+	)`)
+
+	archived := query.ArchivedNo
+	if includeArchived {
+		archived = query.ArchivedYes
+	}
+
+	for _, f := range filters {
+		switch f.Field {
+		case query.FieldTag:
+			// The tag and every tag nested under it
+			b.WriteString(` AND EXISTS (
+				SELECT 1 FROM todo_tags tt
+				WHERE tt.todo_id = t.id AND (tt.tag = ? OR tt.tag GLOB ?)
+			)`)
+			args = append(args, f.Value, escapeGlob(f.Value+domain.TagSeparator)+"*")
+
+		case query.FieldStatus:
+			b.WriteString(" AND t.status = ?")
+			args = append(args, f.Value)
+
+		case query.FieldUrgency:
+			b.WriteString(" AND t.urgency " + sqlOp(f.Op) + " ?")
+			args = append(args, f.Level)
+
+		case query.FieldDue:
+			// Due dates are stored in UTC, so days become ranges of instants
+			start := domain.FormatTime(f.Day)
+			end := domain.FormatTime(f.Day.AddDate(0, 0, 1))
+			switch {
+			case f.Value == query.DueNone:
+				b.WriteString(" AND t.due_date IS NULL")
+			case f.Value == query.DueAny:
+				b.WriteString(" AND t.due_date IS NOT NULL")
+			case f.Op == query.OpEq:
+				b.WriteString(" AND t.due_date >= ? AND t.due_date < ?")
+				args = append(args, start, end)
+			case f.Op == query.OpLt:
+				b.WriteString(" AND t.due_date < ?")
+				args = append(args, start)
+			case f.Op == query.OpLe:
+				b.WriteString(" AND t.due_date < ?")
+				args = append(args, end)
+			case f.Op == query.OpGt:
+				b.WriteString(" AND t.due_date >= ?")
+				args = append(args, end)
+			case f.Op == query.OpGe:
+				b.WriteString(" AND t.due_date >= ?")
+				args = append(args, start)
+			}
+
+		case query.FieldWorkspace:
+			// The named workspace and every workspace under it
+			b.WriteString(` AND t.workspace_id IN (
+				SELECT wc.descendant_id
+				FROM workspace_closure wc
+				JOIN workspaces w ON w.id = wc.ancestor_id
+				WHERE w.name = ? COLLATE NOCASE AND w.deleted_at IS NULL
+			)`)
+			args = append(args, f.Value)
+
+		case query.FieldArchived:
+			archived = f.Value
+		}
+	}
+
+	switch archived {
+	case query.ArchivedNo:
+		b.WriteString(" AND t.is_archived = 0")
+	case query.ArchivedOnly:
+		b.WriteString(" AND t.is_archived = 1")
+	}
+
+	return b.String(), args
+}
+
+// sqlOp returns the SQL comparison for a query operator
+func sqlOp(op query.Op) string {
+	if op == query.OpEq {
+		return "="
+	}
+	return string(op)
+}
+
+// escapeGlob escapes the GLOB wildcards in s
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`).Replace(s)
+}
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/query"
+)
+
+// Todo descriptions are indexed in an FTS5 table when SQLite is built with
+// FTS5 (go build -tags sqlite_fts5, as make does). Migration 009 creates
+// it with triggers that keep it in step with every write to todos, so the
+// applier, undo and repairs need no special handling. Without FTS5 that
+// migration stays pending and search falls back to LIKE matching.
+
+// searchLimit caps the number of search results
+const searchLimit = 200
+
+// searchLikeCandidates caps the matches LIKE search reads and ranks. It
+// scans every todo, so only the newest matches are ranked.
+const searchLikeCandidates = 5 * searchLimit
+
+// searchIndexVersion is the migration that creates todos_fts
+const searchIndexVersion = 9
+
+// dropSearchTriggers suspends the search index in a build without FTS5,
+// where the triggers could not run and todos_fts cannot be dropped
+const dropSearchTriggers = `
+	DROP TRIGGER IF EXISTS todos_fts_insert;
+	DROP TRIGGER IF EXISTS todos_fts_delete;
+	DROP TRIGGER IF EXISTS todos_fts_update;
+`
+
+// HasSearchIndex reports whether search uses the FTS5 index rather than
+// LIKE matching
+func (db *DB) HasSearchIndex() bool {
+	return db.searchIndex
+}
+
+// Vacuum rebuilds the database file, then the search index, whose rowids
+// VACUUM may renumber
+func (db *DB) Vacuum(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if !db.searchIndex {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO todos_fts (todos_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
+}
+
+// Search finds todos matching a query in the language of package query.
+// Free text matches todos whose description contains a word starting with
+// each word of it, best match first; each result has a snippet of the
+// description with the matches marked. A malformed query returns a
+// *query.SyntaxError.
+func (r *TodoRepository) Search(ctx context.Context, input string, includeArchived bool) ([]*domain.SearchResult, error) {
+	q, err := query.Parse(input, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if q.IsEmpty() {
+		return nil, nil
+	}
+
+	where, args := compileFilters(q.Filters, includeArchived)
+	terms := searchTerms(strings.Join(q.Text, " "))
+	switch {
+	case len(terms) == 0:
+		return r.searchFilters(ctx, where, args)
+	case r.db.searchIndex:
+		return r.searchIndex(ctx, terms, where, args)
+	default:
+		return r.searchLike(ctx, terms, where, args)
+	}
+}
+
+// searchFilters finds the todos matching filters alone, soonest due first
+func (r *TodoRepository) searchFilters(ctx context.Context, where string, args []interface{}) ([]*domain.SearchResult, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
+			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
+			   t.depth, t.parent_id
+		FROM todos t
+		WHERE t.deleted_at IS NULL`+where+`
+		ORDER BY t.due_date IS NULL, t.due_date, t.urgency DESC, t.created_at DESC
+		LIMIT ?
+	`, append(args, searchLimit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	defer rows.Close()
+
+	todos, err := scanTodos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*domain.SearchResult, len(todos))
+	for i, todo := range todos {
+		results[i] = &domain.SearchResult{Todo: todo, Snippet: todo.Description}
+	}
+	return results, nil
+}
+
+// searchIndex ranks matches with the FTS5 index
+func (r *TodoRepository) searchIndex(ctx context.Context, terms []string, where string, args []interface{}) ([]*domain.SearchResult, error) {
+	// Every term is a quoted prefix query, so nothing typed is FTS5 syntax
+	match := make([]string, len(terms))
+	for i, term := range terms {
+		match[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+
+	// CROSS JOIN keeps the index as the outer loop. Left to itself the
+	// planner may scan todos and run the match once per row.
+	args = append([]interface{}{domain.MatchStart, domain.MatchEnd, strings.Join(match, " ")}, args...)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, snippet(todos_fts, 0, ?, ?, '…', 12)
+		FROM todos_fts
+		CROSS JOIN todos t ON t.rowid = todos_fts.rowid
+		WHERE todos_fts MATCH ? AND t.deleted_at IS NULL`+where+`
+		ORDER BY bm25(todos_fts), t.created_at DESC
+		LIMIT ?
+	`, append(args, searchLimit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	snippets := make(map[string]string)
+	for rows.Next() {
+		var id, snippet string
+		if err := rows.Scan(&id, &snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		ids = append(ids, id)
+		snippets[id] = snippet
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+
+	todos, err := r.getByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*domain.SearchResult, 0, len(ids))
+	for _, id := range ids {
+		if todo, ok := todos[id]; ok {
+			results = append(results, &domain.SearchResult{Todo: todo, Snippet: snippets[id]})
+		}
+	}
+	return results, nil
+}
+
+// searchLike finds matches with LIKE when there is no index, ranking
+// todos where more terms start a word first among the newest
+// searchLikeCandidates
+func (r *TodoRepository) searchLike(ctx context.Context, terms []string, where string, args []interface{}) ([]*domain.SearchResult, error) {
+	query := `
+		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
+			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
+			   t.depth, t.parent_id
+		FROM todos t
+		WHERE t.deleted_at IS NULL
+	`
+	var likes []interface{}
+	for _, term := range terms {
+		query += ` AND t.description LIKE ? ESCAPE '\'`
+		likes = append(likes, "%"+escapeLike(term)+"%")
+	}
+	query += where + " ORDER BY t.created_at DESC LIMIT ?"
+
+	args = append(append(likes, args...), searchLikeCandidates)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search todos: %w", err)
+	}
+	defer rows.Close()
+
+	todos, err := scanTodos(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*domain.SearchResult, len(todos))
+	scores := make(map[*domain.SearchResult]int, len(todos))
+	for i, todo := range todos {
+		snippet, score := markMatches(todo.Description, terms)
+		results[i] = &domain.SearchResult{Todo: todo, Snippet: snippet}
+		scores[results[i]] = score
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return scores[results[i]] > scores[results[j]]
+	})
+	if len(results) > searchLimit {
+		results = results[:searchLimit]
+	}
+	return results, nil
+}
+
+// getByIDs loads active todos by ID
+func (r *TodoRepository) getByIDs(ctx context.Context, ids []string) (map[string]*domain.Todo, error) {
+	todos := make(map[string]*domain.Todo, len(ids))
+	if len(ids) == 0 {
+		return todos, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
+			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
+			   t.depth, t.parent_id
+		FROM todos t
+		WHERE t.id IN (`+placeholders(len(ids))+`)
+	`, stringArgs(ids)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get todos: %w", err)
+	}
+	defer rows.Close()
+
+	list, err := scanTodos(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, todo := range list {
+		todos[todo.ID] = todo
+	}
+	return todos, nil
+}
+
+// searchTerms splits a query into words the way the index tokenizes text
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// markMatches marks every occurrence of the terms in text, ignoring case.
+// The score counts the terms found at the start of a word.
+func markMatches(text string, terms []string) (string, int) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	marked := make([]bool, len(runes))
+	score := 0
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		atWordStart := false
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) != string(t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if i == 0 || !unicode.IsLetter(lower[i-1]) && !unicode.IsDigit(lower[i-1]) {
+				atWordStart = true
+			}
+		}
+		if atWordStart {
+			score++
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(domain.MatchStart)
+		}
+		b.WriteRune(r)
+		if marked[i] && (i == len(runes)-1 || !marked[i+1]) {
+			b.WriteString(domain.MatchEnd)
+		}
+	}
+	return b.String(), score
+}
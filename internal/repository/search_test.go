@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+// searchModes runs check with the full-text index, when this build has
+// one, and with LIKE matching
+func searchModes(t *testing.T, check func(t *testing.T, s *testStore)) {
+	t.Run("like", func(t *testing.T) {
+		s := newTestStore(t)
+		s.db.searchIndex = false
+		check(t, s)
+	})
+	t.Run("index", func(t *testing.T) {
+		s := newTestStore(t)
+		if !s.db.HasSearchIndex() {
+			t.Skip("built without -tags sqlite_fts5")
+		}
+		check(t, s)
+	})
+}
+
+// search returns the descriptions of the todos matching input
+func (s *testStore) search(t *testing.T, input string) []string {
+	t.Helper()
+	results, err := s.todos.Search(context.Background(), input, false)
+	if err != nil {
+		t.Fatalf("search %q: %v", input, err)
+	}
+	var found []string
+	for _, r := range results {
+		found = append(found, r.Todo.Description)
+	}
+	return found
+}
+
+func TestSearchRanksWordStartsFirst(t *testing.T) {
+	searchModes(t, func(t *testing.T, s *testStore) {
+		ws := s.workspace(t, "Home", "")
+		s.todo(t, ws.ID, "", "Buttermilk pancakes")
+		s.todo(t, ws.ID, "", "Milkshake recipe")
+		s.todo(t, ws.ID, "", "Call the plumber")
+
+		found := s.search(t, "milk")
+		if len(found) == 0 || found[0] != "Milkshake recipe" {
+			t.Errorf("search found %q, want the word starting with milk first", found)
+		}
+		for _, d := range found {
+			if d == "Call the plumber" {
+				t.Errorf("search found %q, which does not match", d)
+			}
+		}
+	})
+}
+
+func TestSearchSkipsTheTrash(t *testing.T) {
+	searchModes(t, func(t *testing.T, s *testStore) {
+		ws := s.workspace(t, "Home", "")
+		milk := s.todo(t, ws.ID, "", "Buy milk")
+		s.todo(t, ws.ID, "", "Milk the goat")
+		if err := s.todos.Delete(context.Background(), milk.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := s.search(t, "milk"); len(found) != 1 || found[0] != "Milk the goat" {
+			t.Errorf("search found %q, want only the active todo", found)
+		}
+	})
+}
+
+func TestSearchTreatsUnknownKeysAsText(t *testing.T) {
+	searchModes(t, func(t *testing.T, s *testStore) {
+		ws := s.workspace(t, "Home", "")
+		s.todo(t, ws.ID, "", "Note: call Bob about the lease")
+		s.todo(t, ws.ID, "", "Read https://example.com/lease")
+
+		if found := s.search(t, "note: call bob"); len(found) != 1 || found[0] != "Note: call Bob about the lease" {
+			t.Errorf("search found %q, want the note", found)
+		}
+		if found := s.search(t, "https://example.com"); len(found) != 1 || found[0] != "Read https://example.com/lease" {
+			t.Errorf("search found %q, want the link", found)
+		}
+	})
+}
@@ -0,0 +1,558 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// querier is satisfied by *sql.DB, *sql.Tx and *DB
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// ClosureRecord is a single row of a closure table
+type ClosureRecord struct {
+	AncestorID   string `json:"ancestor_id"`
+	DescendantID string `json:"descendant_id"`
+	Depth        int    `json:"depth"`
+}
+
+// TodoRecord is a todos row exactly as stored
+type TodoRecord struct {
+	ID          string  `json:"id"`
+	WorkspaceID string  `json:"workspace_id"`
+	Description string  `json:"description"`
+	Position    int     `json:"position"`
+	Status      string  `json:"status"`
+	Urgency     int     `json:"urgency"`
+	DueDate     *string `json:"due_date,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	CompletedAt *string `json:"completed_at,omitempty"`
+	DeletedAt   *string `json:"deleted_at,omitempty"`
+	// DeletedBatch is shared by every row one delete sent to the trash
+	DeletedBatch *string `json:"deleted_batch,omitempty"`
+	IsArchived   bool    `json:"is_archived"`
+}
+
+// TodoSnapshot holds todo rows and every closure row describing them.
+// It is stored in the WAL payload so an operation can be replayed or reverted.
+type TodoSnapshot struct {
+	Todos   []TodoRecord    `json:"todos"`
+	Closure []ClosureRecord `json:"closure"`
+}
+
+// WorkspaceRecord is a workspaces row exactly as stored
+type WorkspaceRecord struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Position   int     `json:"position"`
+	IsExpanded bool    `json:"is_expanded"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+	DeletedAt  *string `json:"deleted_at,omitempty"`
+	// DeletedBatch is shared by every row one delete sent to the trash
+	DeletedBatch *string `json:"deleted_batch,omitempty"`
+}
+
+// WorkspaceSnapshot holds workspace rows and every closure row describing
+// them. Deleting or restoring workspaces also carries the todos that go
+// to or come back from the trash with them, so the whole change is one
+// operation applied in one transaction.
+type WorkspaceSnapshot struct {
+	Workspaces []WorkspaceRecord `json:"workspaces"`
+	Closure    []ClosureRecord   `json:"closure"`
+	Todos      *TodoSnapshot     `json:"todos,omitempty"`
+}
+
+// IDs returns the IDs of the todos in the snapshot
+func (s *TodoSnapshot) IDs() []string {
+	if s == nil {
+		return nil
+	}
+	ids := make([]string, len(s.Todos))
+	for i, t := range s.Todos {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// clone returns a copy whose slices can be modified independently
+func (s *TodoSnapshot) clone() *TodoSnapshot {
+	c := &TodoSnapshot{
+		Todos:   make([]TodoRecord, len(s.Todos)),
+		Closure: make([]ClosureRecord, len(s.Closure)),
+	}
+	copy(c.Todos, s.Todos)
+	copy(c.Closure, s.Closure)
+	return c
+}
+
+// IDs returns the IDs of the workspaces in the snapshot
+func (s *WorkspaceSnapshot) IDs() []string {
+	if s == nil {
+		return nil
+	}
+	ids := make([]string, len(s.Workspaces))
+	for i, w := range s.Workspaces {
+		ids[i] = w.ID
+	}
+	return ids
+}
+
+// clone returns a copy whose slices can be modified independently
+func (s *WorkspaceSnapshot) clone() *WorkspaceSnapshot {
+	c := &WorkspaceSnapshot{
+		Workspaces: make([]WorkspaceRecord, len(s.Workspaces)),
+		Closure:    make([]ClosureRecord, len(s.Closure)),
+	}
+	copy(c.Workspaces, s.Workspaces)
+	copy(c.Closure, s.Closure)
+	if s.Todos != nil {
+		c.Todos = s.Todos.clone()
+	}
+	return c
+}
+
+// todos returns the todos carried by the snapshot, if any
+func (s *WorkspaceSnapshot) todos() *TodoSnapshot {
+	if s == nil {
+		return nil
+	}
+	return s.Todos
+}
+
+// Snapshot loading
+
+func loadTodoSnapshot(ctx context.Context, q querier, ids []string) (*TodoSnapshot, error) {
+	snap := &TodoSnapshot{}
+	if len(ids) == 0 {
+		return snap, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, workspace_id, description, position, status, urgency,
+			   due_date, created_at, updated_at, completed_at, deleted_at, deleted_batch, is_archived
+		FROM todos
+		WHERE id IN (`+placeholders(len(ids))+`)
+		ORDER BY position, created_at
+	`, stringArgs(ids)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load todo snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TodoRecord
+		var dueDate, completedAt, deletedAt, deletedBatch sql.NullString
+
+		err := rows.Scan(&t.ID, &t.WorkspaceID, &t.Description, &t.Position, &t.Status, &t.Urgency,
+			&dueDate, &t.CreatedAt, &t.UpdatedAt, &completedAt, &deletedAt, &deletedBatch, &t.IsArchived)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
+
+		t.DueDate = nullStringPtr(dueDate)
+		t.CompletedAt = nullStringPtr(completedAt)
+		t.DeletedAt = nullStringPtr(deletedAt)
+		t.DeletedBatch = nullStringPtr(deletedBatch)
+		snap.Todos = append(snap.Todos, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load todo snapshot: %w", err)
+	}
+
+	snap.Closure, err = loadClosure(ctx, q, "todo_closure", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+func loadWorkspaceSnapshot(ctx context.Context, q querier, ids []string) (*WorkspaceSnapshot, error) {
+	snap := &WorkspaceSnapshot{}
+	if len(ids) == 0 {
+		return snap, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, name, position, is_expanded, created_at, updated_at, deleted_at, deleted_batch
+		FROM workspaces
+		WHERE id IN (`+placeholders(len(ids))+`)
+		ORDER BY position, name
+	`, stringArgs(ids)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace snapshot: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w WorkspaceRecord
+		var deletedAt, deletedBatch sql.NullString
+
+		err := rows.Scan(&w.ID, &w.Name, &w.Position, &w.IsExpanded, &w.CreatedAt, &w.UpdatedAt, &deletedAt, &deletedBatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+
+		w.DeletedAt = nullStringPtr(deletedAt)
+		w.DeletedBatch = nullStringPtr(deletedBatch)
+		snap.Workspaces = append(snap.Workspaces, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load workspace snapshot: %w", err)
+	}
+
+	snap.Closure, err = loadClosure(ctx, q, "workspace_closure", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// loadClosure returns every closure row whose descendant is one of ids
+func loadClosure(ctx context.Context, q querier, table string, ids []string) ([]ClosureRecord, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT ancestor_id, descendant_id, depth
+		FROM `+table+`
+		WHERE descendant_id IN (`+placeholders(len(ids))+`)
+		ORDER BY descendant_id, depth
+	`, stringArgs(ids)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s rows: %w", table, err)
+	}
+	defer rows.Close()
+
+	var closure []ClosureRecord
+	for rows.Next() {
+		var c ClosureRecord
+		if err := rows.Scan(&c.AncestorID, &c.DescendantID, &c.Depth); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		closure = append(closure, c)
+	}
+
+	return closure, rows.Err()
+}
+
+// loadSubtreeIDs returns the IDs of a node and all its descendants
+func loadSubtreeIDs(ctx context.Context, q querier, table string, rootID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT descendant_id FROM `+table+` WHERE ancestor_id = ? ORDER BY depth
+	`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subtree: %w", err)
+	}
+	defer rows.Close()
+
+	return scanIDs(rows)
+}
+
+// loadActiveSubtreeIDs returns the IDs of a node and its descendants
+// that are not in the trash, root first
+func loadActiveSubtreeIDs(ctx context.Context, q querier, table, closure, rootID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT t.id
+		FROM `+table+` t
+		JOIN `+closure+` c ON t.id = c.descendant_id
+		WHERE c.ancestor_id = ? AND t.deleted_at IS NULL
+		ORDER BY c.depth
+	`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subtree: %w", err)
+	}
+	defer rows.Close()
+
+	return scanIDs(rows)
+}
+
+// Snapshot application
+
+// applyTodoSnapshot moves the stored rows from state `from` to state `to`.
+// Todos present in `from` but missing in `to` are removed, todos in `to`
+// are written as-is and their closure rows replaced by the snapshot's.
+func applyTodoSnapshot(ctx context.Context, q querier, from, to *TodoSnapshot) error {
+	if err := deleteMissing(ctx, q, "todos", from.IDs(), to.IDs()); err != nil {
+		return err
+	}
+	if to == nil || len(to.Todos) == 0 {
+		return nil
+	}
+
+	for _, t := range to.Todos {
+		t, err := t.canonical()
+		if err != nil {
+			return fmt.Errorf("failed to write todo %s: %w", t.ID, err)
+		}
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO todos (id, workspace_id, description, position, status, urgency, due_date,
+				created_at, updated_at, completed_at, deleted_at, deleted_batch, is_archived)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				workspace_id = excluded.workspace_id,
+				description = excluded.description,
+				position = excluded.position,
+				status = excluded.status,
+				urgency = excluded.urgency,
+				due_date = excluded.due_date,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at,
+				completed_at = excluded.completed_at,
+				deleted_at = excluded.deleted_at,
+				deleted_batch = excluded.deleted_batch,
+				is_archived = excluded.is_archived
+		`, t.ID, t.WorkspaceID, t.Description, t.Position, t.Status, t.Urgency, t.DueDate,
+			t.CreatedAt, t.UpdatedAt, t.CompletedAt, t.DeletedAt, t.DeletedBatch, t.IsArchived)
+		if err != nil {
+			return fmt.Errorf("failed to write todo %s: %w", t.ID, err)
+		}
+	}
+
+	if err := writeTodoTags(ctx, q, to.Todos); err != nil {
+		return err
+	}
+	return replaceClosure(ctx, q, "todo_closure", to.IDs(), to.Closure)
+}
+
+// applyWorkspaceSnapshot moves the stored rows from state `from` to state
+// `to`, along with the todos they carry
+func applyWorkspaceSnapshot(ctx context.Context, q querier, from, to *WorkspaceSnapshot) error {
+	if err := deleteMissing(ctx, q, "workspaces", from.IDs(), to.IDs()); err != nil {
+		return err
+	}
+	if from.todos() != nil || to.todos() != nil {
+		if err := applyTodoSnapshot(ctx, q, from.todos(), to.todos()); err != nil {
+			return err
+		}
+	}
+	if to == nil || len(to.Workspaces) == 0 {
+		return nil
+	}
+
+	// is_expanded is view state set by SetExpanded; only a new row takes
+	// it from the snapshot
+	for _, w := range to.Workspaces {
+		w, err := w.canonical()
+		if err != nil {
+			return fmt.Errorf("failed to write workspace %s: %w", w.ID, err)
+		}
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO workspaces (id, name, position, is_expanded, created_at, updated_at, deleted_at, deleted_batch)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				name = excluded.name,
+				position = excluded.position,
+				created_at = excluded.created_at,
+				updated_at = excluded.updated_at,
+				deleted_at = excluded.deleted_at,
+				deleted_batch = excluded.deleted_batch
+		`, w.ID, w.Name, w.Position, w.IsExpanded, w.CreatedAt, w.UpdatedAt, w.DeletedAt, w.DeletedBatch)
+		if err != nil {
+			return fmt.Errorf("failed to write workspace %s: %w", w.ID, err)
+		}
+	}
+
+	return replaceClosure(ctx, q, "workspace_closure", to.IDs(), to.Closure)
+}
+
+// canonical returns the record with its timestamps in the stored format.
+// Payloads logged by older versions carry local offsets, and no deletion
+// batch.
+func (t TodoRecord) canonical() (TodoRecord, error) {
+	var err error
+	if t.CreatedAt, err = canonicalTime(t.CreatedAt); err != nil {
+		return t, err
+	}
+	if t.UpdatedAt, err = canonicalTime(t.UpdatedAt); err != nil {
+		return t, err
+	}
+	if t.DueDate, err = canonicalNullableTime(t.DueDate); err != nil {
+		return t, err
+	}
+	if t.CompletedAt, err = canonicalNullableTime(t.CompletedAt); err != nil {
+		return t, err
+	}
+	if t.DeletedAt, err = canonicalNullableTime(t.DeletedAt); err != nil {
+		return t, err
+	}
+	t.DeletedBatch = canonicalBatch(t.DeletedAt, t.DeletedBatch)
+	return t, nil
+}
+
+// canonical returns the record with its timestamps in the stored format
+// and its deletion batch set
+func (w WorkspaceRecord) canonical() (WorkspaceRecord, error) {
+	var err error
+	if w.CreatedAt, err = canonicalTime(w.CreatedAt); err != nil {
+		return w, err
+	}
+	if w.UpdatedAt, err = canonicalTime(w.UpdatedAt); err != nil {
+		return w, err
+	}
+	if w.DeletedAt, err = canonicalNullableTime(w.DeletedAt); err != nil {
+		return w, err
+	}
+	w.DeletedBatch = canonicalBatch(w.DeletedAt, w.DeletedBatch)
+	return w, nil
+}
+
+// canonicalBatch returns the deletion batch of a row deleted at deletedAt.
+// Rows deleted before batches were recorded are batched by their deletion
+// time, as migration 008 does for stored rows.
+func canonicalBatch(deletedAt, batch *string) *string {
+	if deletedAt == nil {
+		return nil
+	}
+	if batch == nil {
+		return deletedAt
+	}
+	return batch
+}
+
+func canonicalTime(s string) (string, error) {
+	t, err := domain.ParseTime(s)
+	if err != nil {
+		return "", err
+	}
+	return domain.FormatTime(t), nil
+}
+
+func canonicalNullableTime(s *string) (*string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	c, err := canonicalTime(*s)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// deleteMissing hard-deletes rows whose ID is in from but not in to
+func deleteMissing(ctx context.Context, q querier, table string, from, to []string) error {
+	keep := make(map[string]bool, len(to))
+	for _, id := range to {
+		keep[id] = true
+	}
+
+	var gone []string
+	for _, id := range from {
+		if !keep[id] {
+			gone = append(gone, id)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+
+	_, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE id IN (`+placeholders(len(gone))+`)`, stringArgs(gone)...)
+	if err != nil {
+		return fmt.Errorf("failed to remove rows from %s: %w", table, err)
+	}
+	return nil
+}
+
+// replaceClosure swaps the closure rows of the given descendants for rows
+func replaceClosure(ctx context.Context, q querier, table string, ids []string, rows []ClosureRecord) error {
+	_, err := q.ExecContext(ctx, `
+		DELETE FROM `+table+` WHERE descendant_id IN (`+placeholders(len(ids))+`)
+	`, stringArgs(ids)...)
+	if err != nil {
+		return fmt.Errorf("failed to clear %s rows: %w", table, err)
+	}
+
+	for _, c := range rows {
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO `+table+` (ancestor_id, descendant_id, depth) VALUES (?, ?, ?)
+		`, c.AncestorID, c.DescendantID, c.Depth)
+		if err != nil {
+			return fmt.Errorf("failed to insert %s row: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// rebaseClosure computes the closure rows of a subtree after its root is
+// moved under newParent. parentRows are the closure rows of newParent
+// (empty when moving to the top level).
+func rebaseClosure(rootID string, subtree []ClosureRecord, parentRows []ClosureRecord) []ClosureRecord {
+	members := make(map[string]bool)
+	for _, c := range subtree {
+		if c.AncestorID == rootID {
+			members[c.DescendantID] = true
+		}
+	}
+
+	var out []ClosureRecord
+	var fromRoot []ClosureRecord
+	for _, c := range subtree {
+		if !members[c.AncestorID] {
+			continue // link to the old ancestors
+		}
+		out = append(out, c)
+		if c.AncestorID == rootID {
+			fromRoot = append(fromRoot, c)
+		}
+	}
+
+	for _, p := range parentRows {
+		for _, c := range fromRoot {
+			out = append(out, ClosureRecord{
+				AncestorID:   p.AncestorID,
+				DescendantID: c.DescendantID,
+				Depth:        p.Depth + c.Depth + 1,
+			})
+		}
+	}
+
+	return out
+}
+
+// Helper functions
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return "NULL"
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(ids []string) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+func scanIDs(rows *sql.Rows) ([]string, error) {
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func nullStringPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	s := ns.String
+	return &s
+}
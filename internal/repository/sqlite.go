@@ -10,12 +10,17 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Migrations are numbered files "NNN_name.sql", each with an optional
+// "NNN_name.down.sql" that reverts it
+//
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
+
+	searchIndex bool // todos_fts exists and is kept in sync
 }
 
 // NewDB creates a new database connection
@@ -40,29 +45,19 @@ func NewDB(dbPath string) (*DB, error) {
 	return &DB{DB: db}, nil
 }
 
-// Migrate runs database migrations
-func (db *DB) Migrate() error {
-	// Get current version
-	var currentVersion int
-	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&currentVersion)
+// NewReadOnlyDB opens an existing database that it cannot write to
+func NewReadOnlyDB(dbPath string) (*DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_foreign_keys=on")
 	if err != nil {
-		// Table doesn't exist yet, start from 0
-		currentVersion = 0
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Run migration 001 if not applied
-	if currentVersion < 1 {
-		migration, err := migrationsFS.ReadFile("migrations/001_initial.sql")
-		if err != nil {
-			return fmt.Errorf("failed to read migration file: %w", err)
-		}
-
-		if _, err := db.Exec(string(migration)); err != nil {
-			return fmt.Errorf("failed to run migration 001: %w", err)
-		}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	return nil
+	return &DB{DB: db}, nil
 }
 
 // Close closes the database connection
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// testStore is a migrated database in a temporary directory, with the
+// repositories sharing one WAL the way the app wires them
+type testStore struct {
+	db         *DB
+	wal        *wal.WAL
+	applier    *Applier
+	workspaces *WorkspaceRepository
+	todos      *TodoRepository
+	trash      *TrashRepository
+	tags       *TagRepository
+	views      *SavedViewRepository
+	history    *HistoryRepository
+}
+
+func newTestStore(t testing.TB) *testStore {
+	t.Helper()
+	return openTestStore(t, filepath.Join(t.TempDir(), "lazytodo.db"))
+}
+
+// openTestStore opens the database at path, migrating it if needed
+func openTestStore(t testing.TB, path string) *testStore {
+	t.Helper()
+	return openWrappedTestStore(t, path, nil)
+}
+
+// openWrappedTestStore is openTestStore with the function the WAL applies
+// operations with wrapped by wrap, if set
+func openWrappedTestStore(t testing.TB, path string, wrap func(func([]*wal.Operation) error) func([]*wal.Operation) error) *testStore {
+	t.Helper()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	s := &testStore{db: db, applier: NewApplier(db)}
+	apply := s.applier.Apply
+	if wrap != nil {
+		apply = wrap(apply)
+	}
+	s.wal = wal.New(db.DB, wal.Config{ApplyFunc: apply})
+	s.workspaces = NewWorkspaceRepository(db, s.wal)
+	s.todos = NewTodoRepository(db, s.wal)
+	s.trash = NewTrashRepository(db, s.wal)
+	s.tags = NewTagRepository(db, s.wal)
+	s.views = NewSavedViewRepository(db, s.wal)
+	s.history = NewHistoryRepository(db, s.wal)
+
+	t.Cleanup(func() {
+		s.wal.Close()
+		db.Close()
+	})
+	return s
+}
+
+// workspace creates a workspace under parentID
+func (s *testStore) workspace(t testing.TB, name, parentID string) *domain.Workspace {
+	t.Helper()
+	ws := &domain.Workspace{Name: name, ParentID: parentID, IsExpanded: true}
+	if err := s.workspaces.CreateAfter(context.Background(), ws, lastWorkspace(t, s, parentID)); err != nil {
+		t.Fatalf("create workspace %q: %v", name, err)
+	}
+	return ws
+}
+
+// todo creates a pending todo last among the children of parentID
+func (s *testStore) todo(t testing.TB, workspaceID, parentID, description string) *domain.Todo {
+	t.Helper()
+	todo := &domain.Todo{
+		WorkspaceID: workspaceID,
+		ParentID:    parentID,
+		Description: description,
+		Status:      domain.StatusPending,
+		Urgency:     domain.UrgencyLow,
+	}
+	ctx := context.Background()
+	siblings, err := loadTodoSiblings(ctx, s.db, workspaceID, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo.Position = nextPosition(siblings)
+	if err := s.todos.Create(ctx, todo); err != nil {
+		t.Fatalf("create todo %q: %v", description, err)
+	}
+	return todo
+}
+
+// undo reverts the latest undo group the way the app does
+func (s *testStore) undo(t testing.TB) {
+	t.Helper()
+	ops, err := s.wal.Undo(context.Background(), s.applier.RevertIn)
+	if err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if len(ops) == 0 {
+		t.Fatal("nothing to undo")
+	}
+}
+
+// redo re-applies the oldest undone group the way the app does
+func (s *testStore) redo(t testing.TB) {
+	t.Helper()
+	ops, err := s.wal.Redo(context.Background(), s.applier.ApplyIn)
+	if err != nil {
+		t.Fatalf("redo: %v", err)
+	}
+	if len(ops) == 0 {
+		t.Fatal("nothing to redo")
+	}
+}
+
+// get returns a todo as stored
+func (s *testStore) get(t testing.TB, id string) *domain.Todo {
+	t.Helper()
+	todo, err := s.todos.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get todo %s: %v", id, err)
+	}
+	return todo
+}
+
+// logSize returns the number of operations in the log
+func (s *testStore) logSize(t testing.TB) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM operation_log`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// checkIntegrity fails the test if either tree has an integrity problem
+func (s *testStore) checkIntegrity(t testing.TB) {
+	t.Helper()
+	issues, err := CheckIntegrity(context.Background(), s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		t.Errorf("integrity: %v", issue)
+	}
+}
+
+func lastWorkspace(t testing.TB, s *testStore, parentID string) string {
+	t.Helper()
+	siblings, err := loadWorkspaceSiblings(context.Background(), s.db, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(siblings) == 0 {
+		return ""
+	}
+	return siblings[len(siblings)-1].id
+}
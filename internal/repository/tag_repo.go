@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// Tags live in the descriptions; todo_tags indexes them. The applier
+// rewrites a todo's rows every time it writes the todo, so undo, redo and
+// crash recovery keep the index current like any other table.
+
+// TagRepository implements domain.TagRepository
+type TagRepository struct {
+	db  *DB
+	wal *wal.WAL
+}
+
+// NewTagRepository creates a new tag repository
+func NewTagRepository(db *DB, w *wal.WAL) *TagRepository {
+	return &TagRepository{db: db, wal: w}
+}
+
+// GetAll returns every tag of an active todo, with the tags they are
+// nested under, in name order. Each counts the todos that have it or a
+// tag under it.
+func (r *TagRepository) GetAll(ctx context.Context) ([]*domain.Tag, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tt.todo_id, tt.tag, t.status
+		FROM todo_tags tt
+		JOIN todos t ON t.id = tt.todo_id
+		JOIN workspaces w ON w.id = t.workspace_id
+		WHERE t.deleted_at IS NULL AND t.is_archived = 0 AND w.deleted_at IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string]*domain.Tag)
+	counted := make(map[string]bool) // tag + todo ID, so a todo counts once per tag
+	for rows.Next() {
+		var todoID, name string
+		var status domain.Status
+		if err := rows.Scan(&todoID, &name, &status); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+
+		for _, name := range domain.TagAncestors(name) {
+			if counted[name+"\x00"+todoID] {
+				continue
+			}
+			counted[name+"\x00"+todoID] = true
+
+			tag := tags[name]
+			if tag == nil {
+				tag = &domain.Tag{Name: name}
+				tags[name] = tag
+			}
+			if status == domain.StatusCompleted {
+				tag.Completed++
+			} else {
+				tag.Pending++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+
+	list := make([]*domain.Tag, 0, len(tags))
+	for _, tag := range tags {
+		list = append(list, tag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Rename renames a tag, and the tags nested under it, in the description
+// of every todo that has it, trashed and archived ones included. Renaming
+// to a tag that exists merges the two. The todos are updated as one undo
+// group; Rename returns how many changed.
+func (r *TagRepository) Rename(ctx context.Context, from, to string) (int, error) {
+	if !domain.ValidTag(from) || !domain.ValidTag(to) {
+		return 0, fmt.Errorf("%w: tags use letters, digits and _, with / between levels", domain.ErrInvalidOperation)
+	}
+	if from == to {
+		return 0, nil
+	}
+	ctx, unlock := r.wal.Lock(wal.WithUndoGroup(ctx))
+	defer unlock()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT todo_id FROM todo_tags WHERE tag = ? OR tag GLOB ? ORDER BY todo_id
+	`, from, escapeGlob(from+domain.TagSeparator)+"*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to rename tag: %w", err)
+	}
+	ids, err := scanIDs(rows)
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to rename tag: %w", err)
+	}
+
+	renamed := 0
+	for _, id := range ids {
+		before, err := loadTodoSnapshot(ctx, r.db, []string{id})
+		if err != nil {
+			return renamed, err
+		}
+		if len(before.Todos) == 0 {
+			continue
+		}
+
+		after := before.clone()
+		desc, changed := domain.RenameTag(after.Todos[0].Description, from, to)
+		if !changed {
+			continue
+		}
+		after.Todos[0].Description = desc
+		after.Todos[0].UpdatedAt = domain.FormatTime(time.Now())
+
+		if err := recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpUpdate, id, before, after); err != nil {
+			return renamed, fmt.Errorf("failed to rename tag: %w", err)
+		}
+		renamed++
+	}
+
+	return renamed, nil
+}
+
+// writeTodoTags replaces the tags stored for each todo with those of its
+// description
+func writeTodoTags(ctx context.Context, q querier, todos []TodoRecord) error {
+	for _, t := range todos {
+		if _, err := q.ExecContext(ctx, `DELETE FROM todo_tags WHERE todo_id = ?`, t.ID); err != nil {
+			return fmt.Errorf("failed to clear tags of todo %s: %w", t.ID, err)
+		}
+		for _, tag := range domain.ParseTags(t.Description) {
+			_, err := q.ExecContext(ctx, `INSERT INTO todo_tags (todo_id, tag) VALUES (?, ?)`, t.ID, tag)
+			if err != nil {
+				return fmt.Errorf("failed to write tags of todo %s: %w", t.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fillTodoTags indexes the tags of every todo. It runs once, when the
+// tags table is created.
+func fillTodoTags(ctx context.Context, q querier) error {
+	rows, err := q.QueryContext(ctx, `SELECT id, description FROM todos WHERE description LIKE '%@%'`)
+	if err != nil {
+		return fmt.Errorf("failed to load todos: %w", err)
+	}
+	var todos []TodoRecord
+	for rows.Next() {
+		var t TodoRecord
+		if err := rows.Scan(&t.ID, &t.Description); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan todo: %w", err)
+		}
+		todos = append(todos, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load todos: %w", err)
+	}
+
+	return writeTodoTags(ctx, q, todos)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// tagNames returns the names of the tags of active todos
+func (s *testStore) tagNames(t *testing.T) []string {
+	t.Helper()
+	tags, err := s.tags.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func TestRenameTagRenamesNestedTagsAsOneUndo(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	weed := s.todo(t, ws.ID, "", "Weed the beds @garden")
+	mow := s.todo(t, ws.ID, "", "Mow @garden/lawn @yard")
+	paint := s.todo(t, ws.ID, "", "Paint the fence @gardening")
+	tea := s.todo(t, ws.ID, "", "Buy tea @café")
+
+	n, err := s.tags.Rename(ctx, "garden", "yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("renamed %d todos, want 2", n)
+	}
+	want := map[string]string{
+		weed.ID:  "Weed the beds @yard",
+		mow.ID:   "Mow @yard/lawn @yard",
+		paint.ID: "Paint the fence @gardening",
+	}
+	for id, desc := range want {
+		if got := s.get(t, id).Description; got != desc {
+			t.Errorf("todo is %q, want %q", got, desc)
+		}
+	}
+	if got, want := s.tagNames(t), []string{"café", "gardening", "yard", "yard/lawn"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags are %q, want %q", got, want)
+	}
+
+	if _, err := s.tags.Rename(ctx, "café", "thé"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.get(t, tea.ID).Description; got != "Buy tea @thé" {
+		t.Errorf("todo is %q, want %q", got, "Buy tea @thé")
+	}
+
+	// Each rename is undone as a whole
+	s.undo(t)
+	s.undo(t)
+	if got, want := s.tagNames(t), []string{"café", "garden", "garden/lawn", "gardening", "yard"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tags are %q after undo, want %q", got, want)
+	}
+	if got := s.get(t, mow.ID).Description; got != "Mow @garden/lawn @yard" {
+		t.Errorf("todo is %q after undo, want %q", got, "Mow @garden/lawn @yard")
+	}
+}
+
+func TestTagsCountEachTodoOncePerTag(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Work", "")
+	s.todo(t, ws.ID, "", "Deploy @work/api @work/web")
+	s.todo(t, ws.ID, "", "Standup @work")
+	done := s.todo(t, ws.ID, "", "Fix the login @work/api @work/api")
+	done.Status = domain.StatusCompleted
+	if err := s.todos.Update(ctx, done); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := s.tags.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][2]int)
+	for _, tag := range tags {
+		got[tag.Name] = [2]int{tag.Pending, tag.Completed}
+	}
+	want := map[string][2]int{
+		"work":     {2, 1},
+		"work/api": {1, 1},
+		"work/web": {1, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pending and completed counts are %v, want %v", got, want)
+	}
+}
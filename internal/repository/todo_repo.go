@@ -4,107 +4,128 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
 )
 
-// TodoRepository implements domain.TodoRepository
+// TodoRepository implements domain.TodoRepository.
+// Every mutation is recorded in the WAL before it reaches the todos table.
 type TodoRepository struct {
-	db *DB
+	db  *DB
+	wal *wal.WAL
 }
 
 // NewTodoRepository creates a new todo repository
-func NewTodoRepository(db *DB) *TodoRepository {
-	return &TodoRepository{db: db}
+func NewTodoRepository(db *DB, w *wal.WAL) *TodoRepository {
+	return &TodoRepository{db: db, wal: w}
 }
 
 // Create creates a new todo
 func (r *TodoRepository) Create(ctx context.Context, todo *domain.Todo) error {
-	if todo.ID == "" {
-		todo.ID = uuid.New().String()
-	}
-	todo.CreatedAt = time.Now()
-	todo.UpdatedAt = todo.CreatedAt
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
 
-	tx, err := r.db.BeginTx(ctx, nil)
+	after, err := newTodoSnapshot(ctx, r.db, todo)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
-	defer tx.Rollback()
 
-	// Insert todo
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO todos (id, workspace_id, description, position, status, urgency, due_date, created_at, updated_at, is_archived)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, todo.ID, todo.WorkspaceID, todo.Description, todo.Position, todo.Status, todo.Urgency,
-		formatNullableTime(todo.DueDate), todo.CreatedAt.Format(time.RFC3339), todo.UpdatedAt.Format(time.RFC3339), todo.IsArchived)
-	if err != nil {
-		return fmt.Errorf("failed to insert todo: %w", err)
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpCreate, todo.ID, nil, after)
+}
+
+// newTodoSnapshot fills in the ID and timestamps of a new todo and
+// returns its row with the closure rows under its parent
+func newTodoSnapshot(ctx context.Context, q querier, todo *domain.Todo) (*TodoSnapshot, error) {
+	if todo.ID == "" {
+		todo.ID = uuid.New().String()
 	}
+	todo.CreatedAt = time.Now()
+	todo.UpdatedAt = todo.CreatedAt
 
-	// Insert self-reference in closure table
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO todo_closure (ancestor_id, descendant_id, depth)
-		VALUES (?, ?, 0)
-	`, todo.ID, todo.ID)
-	if err != nil {
-		return fmt.Errorf("failed to insert self-reference: %w", err)
+	snap := &TodoSnapshot{
+		Todos:   []TodoRecord{newTodoRecord(todo)},
+		Closure: []ClosureRecord{{AncestorID: todo.ID, DescendantID: todo.ID, Depth: 0}},
 	}
 
-	// If has parent, insert closure relationships
+	// If has parent, add closure relationships
 	if todo.ParentID != "" {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO todo_closure (ancestor_id, descendant_id, depth)
-			SELECT ancestor_id, ?, depth + 1
-			FROM todo_closure
-			WHERE descendant_id = ?
-		`, todo.ID, todo.ParentID)
+		parentRows, err := loadClosure(ctx, q, "todo_closure", []string{todo.ParentID})
 		if err != nil {
-			return fmt.Errorf("failed to insert closure relationships: %w", err)
+			return nil, err
+		}
+		for _, p := range parentRows {
+			snap.Closure = append(snap.Closure, ClosureRecord{
+				AncestorID:   p.AncestorID,
+				DescendantID: todo.ID,
+				Depth:        p.Depth + 1,
+			})
 		}
 	}
 
-	return tx.Commit()
+	return snap, nil
 }
 
 // Update updates an existing todo
 func (r *TodoRepository) Update(ctx context.Context, todo *domain.Todo) error {
-	todo.UpdatedAt = time.Now()
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
 
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE todos
-		SET description = ?, position = ?, status = ?, urgency = ?, due_date = ?,
-			updated_at = ?, completed_at = ?, is_archived = ?
-		WHERE id = ? AND deleted_at IS NULL
-	`, todo.Description, todo.Position, todo.Status, todo.Urgency,
-		formatNullableTime(todo.DueDate), todo.UpdatedAt.Format(time.RFC3339),
-		formatNullableTime(todo.CompletedAt), todo.IsArchived, todo.ID)
+	before, err := r.loadActive(ctx, todo.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update todo: %w", err)
 	}
 
-	return nil
+	todo.UpdatedAt = time.Now()
+
+	after := before.clone()
+	rec := &after.Todos[0]
+	rec.Description = todo.Description
+	rec.Position = todo.Position
+	rec.Status = string(todo.Status)
+	rec.Urgency = todo.Urgency
+	rec.DueDate = formatNullableTime(todo.DueDate)
+	rec.UpdatedAt = domain.FormatTime(todo.UpdatedAt)
+	rec.CompletedAt = formatNullableTime(todo.CompletedAt)
+	rec.IsArchived = todo.IsArchived
+
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpUpdate, todo.ID, before, after)
 }
 
 // Delete soft-deletes a todo
 func (r *TodoRepository) Delete(ctx context.Context, id string) error {
-	now := time.Now().Format(time.RFC3339)
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
 
-	// Soft delete todo and all descendants
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE todos
-		SET deleted_at = ?, updated_at = ?
-		WHERE id IN (
-			SELECT descendant_id FROM todo_closure WHERE ancestor_id = ?
-		) AND deleted_at IS NULL
-	`, now, now, id)
+	now := domain.FormatTime(time.Now())
+
+	// Soft delete todo and all active descendants
+	ids, err := loadActiveSubtreeIDs(ctx, r.db, "todos", "todo_closure", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete todo: %w", err)
 	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	before, err := loadTodoSnapshot(ctx, r.db, ids)
+	if err != nil {
+		return err
+	}
+
+	// The subtree is one entry in the trash
+	batch := uuid.New().String()
+	after := before.clone()
+	for i := range after.Todos {
+		after.Todos[i].DeletedAt = &now
+		after.Todos[i].DeletedBatch = &batch
+		after.Todos[i].UpdatedAt = now
+	}
 
-	return nil
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpDelete, id, before, after)
 }
 
 // GetByID retrieves a todo by ID
@@ -117,8 +138,7 @@ func (r *TodoRepository) GetByID(ctx context.Context, id string) (*domain.Todo,
 	err := r.db.QueryRowContext(ctx, `
 		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
 			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.deleted_at, t.is_archived,
-			   (SELECT MAX(depth) FROM todo_closure WHERE descendant_id = t.id) as depth,
-			   (SELECT ancestor_id FROM todo_closure WHERE descendant_id = t.id AND depth = 1) as parent_id
+			   t.depth, t.parent_id
 		FROM todos t
 		WHERE t.id = ?
 	`, id).Scan(&t.ID, &t.WorkspaceID, &t.Description, &t.Position, &t.Status, &t.Urgency,
@@ -130,11 +150,9 @@ func (r *TodoRepository) GetByID(ctx context.Context, id string) (*domain.Todo,
 		return nil, fmt.Errorf("failed to get todo: %w", err)
 	}
 
-	t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-	t.DueDate = parseNullableTime(dueDate)
-	t.CompletedAt = parseNullableTime(completedAt)
-	t.DeletedAt = parseNullableTime(deletedAt)
+	if err := parseTodoTimes(&t, createdAt, updatedAt, dueDate, completedAt, deletedAt); err != nil {
+		return nil, fmt.Errorf("failed to get todo: %w", err)
+	}
 	if parentID.Valid {
 		t.ParentID = parentID.String
 	}
@@ -142,28 +160,41 @@ func (r *TodoRepository) GetByID(ctx context.Context, id string) (*domain.Todo,
 	return &t, nil
 }
 
-// GetByWorkspace retrieves all active todos in a workspace
+// siblingOrder orders the todos of a sibling group: pending first, then
+// completed, then archived, each by position
+const siblingOrder = "t.status = 'completed', t.is_archived, t.position, t.created_at, t.id"
+
+// GetByWorkspace retrieves all active todos in a workspace in tree order:
+// each todo is followed by its subtree, and siblings come in siblingOrder
 func (r *TodoRepository) GetByWorkspace(ctx context.Context, workspaceID string, includeArchived bool) ([]*domain.Todo, error) {
+	return queryWorkspaceTodos(ctx, r.db, workspaceID, includeArchived)
+}
+
+// queryWorkspaceTodos runs the GetByWorkspace query on q
+func queryWorkspaceTodos(ctx context.Context, q querier, workspaceID string, includeArchived bool) ([]*domain.Todo, error) {
 	query := `
 		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
 			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
-			   COALESCE((SELECT MAX(depth) FROM todo_closure WHERE descendant_id = t.id), 0) as depth,
-			   (SELECT ancestor_id FROM todo_closure WHERE descendant_id = t.id AND depth = 1) as parent_id
+			   t.depth, t.parent_id
 		FROM todos t
 		WHERE t.workspace_id = ? AND t.deleted_at IS NULL
 	`
 	if !includeArchived {
 		query += " AND t.is_archived = 0"
 	}
-	query += " ORDER BY t.status, t.position, t.created_at"
+	query += " ORDER BY " + siblingOrder
 
-	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	rows, err := q.QueryContext(ctx, query, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get todos: %w", err)
 	}
 	defer rows.Close()
 
-	return scanTodos(rows)
+	todos, err := scanTodos(rows)
+	if err != nil {
+		return nil, err
+	}
+	return todosInTreeOrder(todos), nil
 }
 
 // GetChildren retrieves direct children of a todo
@@ -174,7 +205,7 @@ func (r *TodoRepository) GetChildren(ctx context.Context, parentID string) ([]*d
 		FROM todos t
 		JOIN todo_closure tc ON t.id = tc.descendant_id
 		WHERE tc.ancestor_id = ? AND tc.depth = 1 AND t.deleted_at IS NULL
-		ORDER BY t.status, t.position, t.created_at
+		ORDER BY `+siblingOrder+`
 	`, parentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get children: %w", err)
@@ -211,10 +242,9 @@ func (r *TodoRepository) GetDescendants(ctx context.Context, ancestorID string)
 			return nil, fmt.Errorf("failed to scan todo: %w", err)
 		}
 
-		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-		t.DueDate = parseNullableTime(dueDate)
-		t.CompletedAt = parseNullableTime(completedAt)
+		if err := parseTodoTimes(&t, createdAt, updatedAt, dueDate, completedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
 
 		todos = append(todos, &t)
 	}
@@ -222,90 +252,242 @@ func (r *TodoRepository) GetDescendants(ctx context.Context, ancestorID string)
 	return todos, nil
 }
 
-// Move moves a todo to a new parent or workspace
+// Move moves a todo and its subtree to a new parent or workspace. The new
+// parent must be outside the subtree and in the todo's target workspace.
 func (r *TodoRepository) Move(ctx context.Context, id string, newParentID string, newWorkspaceID string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planMove(ctx, id, newParentID, newWorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to move todo: %w", err)
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpMove, id, before, after)
+}
+
+// planMove validates a move and builds its snapshots in one transaction,
+// so the checks see the same tree the snapshots are taken from. The
+// applier checks the move again when it writes it.
+func (r *TodoRepository) planMove(ctx context.Context, id, newParentID, newWorkspaceID string) (*TodoSnapshot, *TodoSnapshot, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Remove old closure relationships (except self-reference)
-	_, err = tx.ExecContext(ctx, `
-		DELETE FROM todo_closure
-		WHERE descendant_id IN (SELECT descendant_id FROM todo_closure WHERE ancestor_id = ?)
-		  AND ancestor_id IN (SELECT ancestor_id FROM todo_closure WHERE descendant_id = ? AND depth > 0)
-	`, id, id)
+	ids, err := loadSubtreeIDs(ctx, tx, "todo_closure", id)
 	if err != nil {
-		return fmt.Errorf("failed to remove old closure relationships: %w", err)
+		return nil, nil, err
+	}
+	before, err := loadTodoSnapshot(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := findTodoRecord(before, id)
+	if root == nil || root.DeletedAt != nil {
+		return nil, nil, domain.ErrNotFound
 	}
 
-	// Add new closure relationships
+	workspaceID := root.WorkspaceID
+	if newWorkspaceID != "" {
+		ws, err := loadWorkspaceSnapshot(ctx, tx, []string{newWorkspaceID})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ws.Workspaces) == 0 || ws.Workspaces[0].DeletedAt != nil {
+			return nil, nil, fmt.Errorf("workspace %w", domain.ErrNotFound)
+		}
+		workspaceID = newWorkspaceID
+	}
+
+	var parentRows []ClosureRecord
 	if newParentID != "" {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO todo_closure (ancestor_id, descendant_id, depth)
-			SELECT p.ancestor_id, c.descendant_id, p.depth + c.depth + 1
-			FROM todo_closure p
-			CROSS JOIN todo_closure c
-			WHERE p.descendant_id = ? AND c.ancestor_id = ?
-		`, newParentID, id)
+		if slices.Contains(ids, newParentID) {
+			return nil, nil, fmt.Errorf("%w: %s cannot be moved under itself or its own subtree",
+				domain.ErrCircularReference, quote(root.Description))
+		}
+
+		parent, err := loadTodoSnapshot(ctx, tx, []string{newParentID})
 		if err != nil {
-			return fmt.Errorf("failed to add new closure relationships: %w", err)
+			return nil, nil, err
+		}
+		if len(parent.Todos) == 0 || parent.Todos[0].DeletedAt != nil {
+			return nil, nil, fmt.Errorf("parent %w", domain.ErrNotFound)
+		}
+		if parent.Todos[0].WorkspaceID != workspaceID {
+			return nil, nil, fmt.Errorf("%w: the new parent %s is in another workspace",
+				domain.ErrInvalidOperation, quote(parent.Todos[0].Description))
 		}
+		parentRows = parent.Closure
 	}
 
+	after := before.clone()
+	after.Closure = rebaseClosure(id, before.Closure, parentRows)
+
 	// Update workspace_id if changed
+	now := domain.FormatTime(time.Now())
 	if newWorkspaceID != "" {
-		_, err = tx.ExecContext(ctx, `
-			UPDATE todos SET workspace_id = ?, updated_at = ?
-			WHERE id IN (SELECT descendant_id FROM todo_closure WHERE ancestor_id = ?)
-		`, newWorkspaceID, time.Now().Format(time.RFC3339), id)
+		for i := range after.Todos {
+			after.Todos[i].WorkspaceID = newWorkspaceID
+			after.Todos[i].UpdatedAt = now
+		}
+	}
+
+	// A todo that changes sibling group goes last in the new one
+	if newParentID != parentOf(before.Closure, id) || workspaceID != root.WorkspaceID {
+		siblings, err := loadTodoSiblings(ctx, tx, workspaceID, newParentID)
 		if err != nil {
-			return fmt.Errorf("failed to update workspace_id: %w", err)
+			return nil, nil, err
 		}
+		moved := findTodoRecord(after, id)
+		moved.Position = nextPosition(siblings)
+		moved.UpdatedAt = now
 	}
 
-	return tx.Commit()
+	return before, after, nil
 }
 
-// Reorder changes the position of a todo among siblings
-func (r *TodoRepository) Reorder(ctx context.Context, id string, newPosition int) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE todos SET position = ?, updated_at = ? WHERE id = ?
-	`, newPosition, time.Now().Format(time.RFC3339), id)
-	return err
+// Reorder moves a todo offset places among the siblings shown next to it
+// (negative moves it up) and renumbers the sibling group. It reports
+// false when the todo is already first or last.
+func (r *TodoRepository) Reorder(ctx context.Context, id string, offset int) (bool, error) {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planReorder(ctx, id, offset)
+	if err != nil {
+		return false, fmt.Errorf("failed to reorder todo: %w", err)
+	}
+	if before == nil {
+		return false, nil
+	}
+
+	return true, recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpUpdate, id, before, after)
 }
 
-// Search searches todos by description
-func (r *TodoRepository) Search(ctx context.Context, query string, includeArchived bool) ([]*domain.Todo, error) {
-	sqlQuery := `
-		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
-			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
-			   COALESCE((SELECT MAX(depth) FROM todo_closure WHERE descendant_id = t.id), 0) as depth,
-			   (SELECT ancestor_id FROM todo_closure WHERE descendant_id = t.id AND depth = 1) as parent_id
-		FROM todos t
-		WHERE t.deleted_at IS NULL AND t.description LIKE ?
-	`
-	if !includeArchived {
-		sqlQuery += " AND t.is_archived = 0"
+// planReorder reads the sibling group and builds the snapshots in one
+// transaction
+func (r *TodoRepository) planReorder(ctx context.Context, id string, offset int) (*TodoSnapshot, *TodoSnapshot, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	sqlQuery += " ORDER BY t.created_at DESC"
+	defer tx.Rollback()
 
-	rows, err := r.db.QueryContext(ctx, sqlQuery, "%"+query+"%")
+	snap, err := loadTodoSnapshot(ctx, tx, []string{id})
 	if err != nil {
-		return nil, fmt.Errorf("failed to search todos: %w", err)
+		return nil, nil, err
+	}
+	if len(snap.Todos) == 0 || snap.Todos[0].DeletedAt != nil {
+		return nil, nil, domain.ErrNotFound
 	}
-	defer rows.Close()
 
-	return scanTodos(rows)
+	siblings, err := loadTodoSiblings(ctx, tx, snap.Todos[0].WorkspaceID, parentOf(snap.Closure, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	order := shiftSibling(siblings, id, offset)
+	if order == nil {
+		return nil, nil, nil
+	}
+
+	changes := renumber(siblings, order)
+	return renumberTodos(ctx, tx, changes, changedIDs(changes, ""))
+}
+
+// CreateAfter creates a todo right after afterID among its siblings, or
+// first among them when afterID is empty. After a sibling shown apart,
+// such as a completed todo, it goes after the last sibling shown with it.
+// The siblings that make room are renumbered in the same operation.
+func (r *TodoRepository) CreateAfter(ctx context.Context, todo *domain.Todo, afterID string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planInsert(ctx, todo, afterID)
+	if err != nil {
+		return fmt.Errorf("failed to create todo: %w", err)
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpCreate, todo.ID, before, after)
+}
+
+// planInsert positions a new todo among its siblings and builds the
+// snapshots in one transaction. Before holds only the siblings that move.
+func (r *TodoRepository) planInsert(ctx context.Context, todo *domain.Todo, afterID string) (*TodoSnapshot, *TodoSnapshot, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	siblings, err := loadTodoSiblings(ctx, tx, todo.WorkspaceID, todo.ParentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if todo.ID == "" {
+		todo.ID = uuid.New().String()
+	}
+	afterID = groupAnchor(siblings, todoGroup(todo), afterID)
+	changes := renumber(siblings, insertSibling(siblings, todo.ID, afterID))
+	todo.Position = changes[todo.ID]
+
+	created, err := newTodoSnapshot(ctx, tx, todo)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := changedIDs(changes, todo.ID)
+	if len(ids) == 0 {
+		return nil, created, nil
+	}
+
+	before, after, err := renumberTodos(ctx, tx, changes, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	after.Todos = append(after.Todos, created.Todos...)
+	after.Closure = append(after.Closure, created.Closure...)
+
+	return before, after, nil
+}
+
+// renumberTodos builds the snapshots that give the todos in ids their new
+// positions
+func renumberTodos(ctx context.Context, q querier, changes map[string]int, ids []string) (*TodoSnapshot, *TodoSnapshot, error) {
+	before, err := loadTodoSnapshot(ctx, q, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := before.clone()
+	now := domain.FormatTime(time.Now())
+	for i := range after.Todos {
+		after.Todos[i].Position = changes[after.Todos[i].ID]
+		after.Todos[i].UpdatedAt = now
+	}
+
+	return before, after, nil
 }
 
 // Archive marks a todo as archived
 func (r *TodoRepository) Archive(ctx context.Context, id string) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE todos SET is_archived = 1, updated_at = ? WHERE id = ?
-	`, time.Now().Format(time.RFC3339), id)
-	return err
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, err := loadTodoSnapshot(ctx, r.db, []string{id})
+	if err != nil {
+		return err
+	}
+	if len(before.Todos) == 0 {
+		return domain.ErrNotFound
+	}
+
+	after := before.clone()
+	after.Todos[0].IsArchived = true
+	after.Todos[0].UpdatedAt = domain.FormatTime(time.Now())
+
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpUpdate, id, before, after)
 }
 
 // GetCompletedBefore retrieves todos completed before a given time
@@ -313,14 +495,13 @@ func (r *TodoRepository) GetCompletedBefore(ctx context.Context, before time.Tim
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT t.id, t.workspace_id, t.description, t.position, t.status, t.urgency,
 			   t.due_date, t.created_at, t.updated_at, t.completed_at, t.is_archived,
-			   COALESCE((SELECT MAX(depth) FROM todo_closure WHERE descendant_id = t.id), 0) as depth,
-			   (SELECT ancestor_id FROM todo_closure WHERE descendant_id = t.id AND depth = 1) as parent_id
+			   t.depth, t.parent_id
 		FROM todos t
 		WHERE t.deleted_at IS NULL AND t.status = 'completed'
 			  AND t.completed_at IS NOT NULL AND t.completed_at < ?
 			  AND t.is_archived = 0
 		ORDER BY t.completed_at
-	`, before.Format(time.RFC3339))
+	`, domain.FormatTime(before))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get completed todos: %w", err)
 	}
@@ -331,73 +512,150 @@ func (r *TodoRepository) GetCompletedBefore(ctx context.Context, before time.Tim
 
 // AutoArchive marks completed todos older than the specified duration as archived
 func (r *TodoRepository) AutoArchive(ctx context.Context, olderThan time.Duration) (int, error) {
-	cutoff := time.Now().Add(-olderThan).Format(time.RFC3339)
+	// One auto-archive run is undone as a whole, and runs at startup
+	// without dropping what the user can still redo
+	ctx, unlock := r.wal.Lock(wal.WithSystem(wal.WithUndoGroup(ctx)))
+	defer unlock()
 
-	result, err := r.db.ExecContext(ctx, `
-		UPDATE todos
-		SET is_archived = 1, updated_at = ?
+	cutoff := domain.FormatTime(time.Now().Add(-olderThan))
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM todos
 		WHERE status = 'completed'
 			AND completed_at IS NOT NULL
 			AND completed_at < ?
 			AND is_archived = 0
 			AND deleted_at IS NULL
-	`, time.Now().Format(time.RFC3339), cutoff)
+	`, cutoff)
 	if err != nil {
 		return 0, fmt.Errorf("failed to auto-archive todos: %w", err)
 	}
+	ids, err := scanIDs(rows)
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to auto-archive todos: %w", err)
+	}
+
+	for i, id := range ids {
+		if err := r.Archive(ctx, id); err != nil {
+			return i, fmt.Errorf("failed to auto-archive todos: %w", err)
+		}
+	}
 
-	affected, _ := result.RowsAffected()
-	return int(affected), nil
+	return len(ids), nil
 }
 
-// CheckAndRepairIntegrity verifies and repairs closure table integrity
-func (r *TodoRepository) CheckAndRepairIntegrity(ctx context.Context) error {
+// CheckAndRepairIntegrity repairs missing self-references and dangling
+// closure rows, then returns the problems that need 'lazytodo fsck'
+func (r *TodoRepository) CheckAndRepairIntegrity(ctx context.Context) ([]*domain.IntegrityError, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Fix missing self-references
+	// Fix missing self-references, deleted todos included
 	_, err = tx.ExecContext(ctx, `
 		INSERT OR IGNORE INTO todo_closure (ancestor_id, descendant_id, depth)
-		SELECT id, id, 0 FROM todos WHERE deleted_at IS NULL
+		SELECT id, id, 0 FROM todos
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to fix missing self-references: %w", err)
+		return nil, fmt.Errorf("failed to fix missing self-references: %w", err)
 	}
 
-	// Remove orphaned closure entries (entries referencing deleted todos)
+	// Remove orphaned closure entries (entries referencing purged todos).
+	// Deleted todos keep their rows so the trash can restore them in place.
 	_, err = tx.ExecContext(ctx, `
 		DELETE FROM todo_closure
-		WHERE ancestor_id NOT IN (SELECT id FROM todos WHERE deleted_at IS NULL)
-		   OR descendant_id NOT IN (SELECT id FROM todos WHERE deleted_at IS NULL)
+		WHERE ancestor_id NOT IN (SELECT id FROM todos)
+		   OR descendant_id NOT IN (SELECT id FROM todos)
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to remove orphaned closure entries: %w", err)
+		return nil, fmt.Errorf("failed to remove orphaned closure entries: %w", err)
+	}
+
+	workspaces, err := checkTree(ctx, tx, workspaceTables)
+	if err != nil {
+		return nil, err
+	}
+	c, err := checkTodoTree(ctx, tx, workspaces)
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit integrity repairs: %w", err)
+	}
+	return c.visible(), nil
 }
 
 // Helper functions
 
-func formatNullableTime(t *time.Time) interface{} {
+func formatNullableTime(t *time.Time) *string {
 	if t == nil {
 		return nil
 	}
-	return t.Format(time.RFC3339)
+	s := domain.FormatTime(*t)
+	return &s
+}
+
+// loadActive returns the snapshot of a single non-deleted todo
+func (r *TodoRepository) loadActive(ctx context.Context, id string) (*TodoSnapshot, error) {
+	snap, err := loadTodoSnapshot(ctx, r.db, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.Todos) == 0 || snap.Todos[0].DeletedAt != nil {
+		return nil, domain.ErrNotFound
+	}
+	return snap, nil
+}
+
+func newTodoRecord(t *domain.Todo) TodoRecord {
+	return TodoRecord{
+		ID:          t.ID,
+		WorkspaceID: t.WorkspaceID,
+		Description: t.Description,
+		Position:    t.Position,
+		Status:      string(t.Status),
+		Urgency:     t.Urgency,
+		DueDate:     formatNullableTime(t.DueDate),
+		CreatedAt:   domain.FormatTime(t.CreatedAt),
+		UpdatedAt:   domain.FormatTime(t.UpdatedAt),
+		CompletedAt: formatNullableTime(t.CompletedAt),
+		DeletedAt:   formatNullableTime(t.DeletedAt),
+		IsArchived:  t.IsArchived,
+	}
 }
 
-func parseNullableTime(ns sql.NullString) *time.Time {
+func parseNullableTime(ns sql.NullString) (*time.Time, error) {
 	if !ns.Valid {
-		return nil
+		return nil, nil
 	}
-	t, err := time.Parse(time.RFC3339, ns.String)
+	t, err := domain.ParseTime(ns.String)
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseTodoTimes parses the stored timestamps of a scanned todo
+func parseTodoTimes(t *domain.Todo, createdAt, updatedAt string, dueDate, completedAt, deletedAt sql.NullString) error {
+	var err error
+	if t.CreatedAt, err = domain.ParseTime(createdAt); err != nil {
+		return err
+	}
+	if t.UpdatedAt, err = domain.ParseTime(updatedAt); err != nil {
+		return err
+	}
+	if t.DueDate, err = parseNullableTime(dueDate); err != nil {
+		return err
+	}
+	if t.CompletedAt, err = parseNullableTime(completedAt); err != nil {
+		return err
 	}
-	return &t
+	t.DeletedAt, err = parseNullableTime(deletedAt)
+	return err
 }
 
 func scanTodos(rows *sql.Rows) ([]*domain.Todo, error) {
@@ -414,10 +672,9 @@ func scanTodos(rows *sql.Rows) ([]*domain.Todo, error) {
 			return nil, fmt.Errorf("failed to scan todo: %w", err)
 		}
 
-		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-		t.DueDate = parseNullableTime(dueDate)
-		t.CompletedAt = parseNullableTime(completedAt)
+		if err := parseTodoTimes(&t, createdAt, updatedAt, dueDate, completedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
 		if parentID.Valid {
 			t.ParentID = parentID.String
 		}
@@ -441,10 +698,9 @@ func scanTodosSimple(rows *sql.Rows, parentID string) ([]*domain.Todo, error) {
 			return nil, fmt.Errorf("failed to scan todo: %w", err)
 		}
 
-		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-		t.DueDate = parseNullableTime(dueDate)
-		t.CompletedAt = parseNullableTime(completedAt)
+		if err := parseTodoTimes(&t, createdAt, updatedAt, dueDate, completedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan todo: %w", err)
+		}
 		t.ParentID = parentID
 		t.Depth = 1
 
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+func TestAutoArchiveKeepsTheRedoBranch(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	done := s.todo(t, ws.ID, "", "Buy milk")
+	other := s.todo(t, ws.ID, "", "Call the plumber")
+
+	old := time.Now().AddDate(0, 0, -30)
+	done.Status = domain.StatusCompleted
+	done.CompletedAt = &old
+	if err := s.todos.Update(ctx, done); err != nil {
+		t.Fatal(err)
+	}
+	other.Description = "Call the electrician"
+	if err := s.todos.Update(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	s.undo(t)
+
+	n, err := s.todos.AutoArchive(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("archived %d todos, want 1", n)
+	}
+
+	ops, err := s.wal.Redo(ctx, s.applier.ApplyIn)
+	if err != nil {
+		t.Fatalf("redo: %v", err)
+	}
+	if len(ops) == 0 {
+		t.Fatal("auto-archive dropped the redo branch")
+	}
+	if got := s.get(t, other.ID); got.Description != "Call the electrician" {
+		t.Errorf("after redo the todo is %q", got.Description)
+	}
+	if !s.get(t, done.ID).IsArchived {
+		t.Error("redo undid the archive")
+	}
+}
+
+func TestInsertAfterACompletedTodoGoesAfterTheLastPendingOne(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	s.todo(t, ws.ID, "", "Buy milk")
+	done := s.todo(t, ws.ID, "", "Post the letter")
+	s.todo(t, ws.ID, "", "Call the plumber")
+	s.todo(t, ws.ID, "", "Water the plants")
+
+	now := time.Now()
+	done.Status = domain.StatusCompleted
+	done.CompletedAt = &now
+	if err := s.todos.Update(ctx, done); err != nil {
+		t.Fatal(err)
+	}
+
+	added := &domain.Todo{WorkspaceID: ws.ID, Description: "Pay rent", Status: domain.StatusPending, Urgency: domain.UrgencyLow}
+	if err := s.todos.CreateAfter(ctx, added, done.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err := s.todos.GetByWorkspace(ctx, ws.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, todo := range todos {
+		got = append(got, todo.Description)
+	}
+	want := []string{"Buy milk", "Call the plumber", "Water the plants", "Pay rent", "Post the letter"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("todos are %q, want %q", got, want)
+	}
+}
+
+func TestTodosComeInPreOrderWithPendingFirst(t *testing.T) {
+	// Each todo is "description", under "parent", completed if done. They
+	// are created in this order, so it is also their position order.
+	type row struct {
+		description, parent string
+		done                bool
+	}
+	tests := []struct {
+		name string
+		rows []row
+		want []string // "depth description" in the order GetByWorkspace returns
+	}{
+		{
+			name: "completed todos between pending siblings",
+			rows: []row{
+				{"Plan the trip", "", false},
+				{"Renew passport", "Plan the trip", true},
+				{"Book flights", "Plan the trip", false},
+				{"Pack", "Plan the trip", false},
+				{"Socks", "Pack", true},
+				{"Charger", "Pack", false},
+				{"Old errand", "", true},
+				{"Water the plants", "", false},
+			},
+			want: []string{
+				"0 Plan the trip",
+				"1 Book flights",
+				"1 Pack",
+				"2 Charger",
+				"2 Socks",
+				"1 Renew passport",
+				"0 Water the plants",
+				"0 Old errand",
+			},
+		},
+		{
+			name: "a completed todo keeps its subtree",
+			rows: []row{
+				{"Move house", "", true},
+				{"Hand in the keys", "Move house", false},
+				{"Clean", "Move house", true},
+				{"Buy milk", "", false},
+			},
+			want: []string{
+				"0 Buy milk",
+				"0 Move house",
+				"1 Hand in the keys",
+				"1 Clean",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			ctx := context.Background()
+			ws := s.workspace(t, "Home", "")
+
+			ids := make(map[string]string)
+			for _, r := range tt.rows {
+				todo := s.todo(t, ws.ID, ids[r.parent], r.description)
+				ids[r.description] = todo.ID
+				if r.done {
+					now := time.Now()
+					todo.Status = domain.StatusCompleted
+					todo.CompletedAt = &now
+					if err := s.todos.Update(ctx, todo); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			todos, err := s.todos.GetByWorkspace(ctx, ws.ID, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, todo := range todos {
+				got = append(got, fmt.Sprintf("%d %s", todo.Depth, todo.Description))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("todos are\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// DefaultTrashRetention is how long deleted items stay in the trash
+// before a purge removes them for good
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashEntry is a deleted todo or workspace. Descendants deleted together
+// with it, and the todos of a workspace, belong to the entry and are
+// restored with it.
+type TrashEntry struct {
+	EntityType wal.EntityType
+	ID         string
+	Name       string
+	Location   []string // Names of the workspace and parents it was under, outermost first
+	DeletedAt  time.Time
+	Items      int // Rows restored with the entry, itself included
+}
+
+// PurgeResult counts the rows removed by a purge
+type PurgeResult struct {
+	Todos      int
+	Workspaces int
+}
+
+// TrashRepository lists, restores and purges soft-deleted rows
+type TrashRepository struct {
+	db  *DB
+	wal *wal.WAL
+}
+
+// NewTrashRepository creates a new trash repository
+func NewTrashRepository(db *DB, w *wal.WAL) *TrashRepository {
+	return &TrashRepository{db: db, wal: w}
+}
+
+// List returns every trash entry, most recently deleted first
+func (r *TrashRepository) List(ctx context.Context) ([]*TrashEntry, error) {
+	workspaces, err := r.listRoots(ctx, wal.EntityWorkspace, "workspaces", "workspace_closure", "name")
+	if err != nil {
+		return nil, err
+	}
+	todos, err := r.listRoots(ctx, wal.EntityTodo, "todos", "todo_closure", "description")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append(workspaces, todos...)
+	for _, e := range entries {
+		if e.Location, err = r.location(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+
+	sortTrash(entries)
+	return entries, nil
+}
+
+// listRoots returns the deleted rows of table that were not deleted
+// together with their parent, or for todos, with their workspace. Rows
+// deleted together share a deletion batch.
+func (r *TrashRepository) listRoots(ctx context.Context, entity wal.EntityType, table, closure, nameColumn string) ([]*TrashEntry, error) {
+	todos, withWorkspace := "0", ""
+	switch entity {
+	case wal.EntityWorkspace:
+		todos = `(SELECT COUNT(*) FROM ` + closure + ` c JOIN todos d ON d.workspace_id = c.descendant_id
+			WHERE c.ancestor_id = t.id AND d.deleted_batch = t.deleted_batch)`
+	case wal.EntityTodo:
+		withWorkspace = `AND NOT EXISTS (
+			SELECT 1 FROM workspaces w WHERE w.id = t.workspace_id AND w.deleted_batch = t.deleted_batch
+		)`
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, t.`+nameColumn+`, t.deleted_at,
+			MAX(1, (SELECT COUNT(*) FROM `+closure+` c JOIN `+table+` d ON d.id = c.descendant_id
+				WHERE c.ancestor_id = t.id AND d.deleted_batch = t.deleted_batch)) + `+todos+`
+		FROM `+table+` t
+		WHERE t.deleted_at IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM `+closure+` c JOIN `+table+` p ON p.id = c.ancestor_id
+				WHERE c.descendant_id = t.id AND c.depth = 1 AND p.deleted_batch = t.deleted_batch
+			)
+			`+withWorkspace+`
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*TrashEntry
+	for rows.Next() {
+		e := &TrashEntry{EntityType: entity}
+		var deletedAt string
+		if err := rows.Scan(&e.ID, &e.Name, &deletedAt, &e.Items); err != nil {
+			return nil, fmt.Errorf("failed to scan trash entry: %w", err)
+		}
+		if e.DeletedAt, err = domain.ParseTime(deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trash entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// location returns the names of the workspace and parents an entry was under
+func (r *TrashRepository) location(ctx context.Context, e *TrashEntry) ([]string, error) {
+	if e.EntityType == wal.EntityWorkspace {
+		return ancestorNames(ctx, r.db, "workspaces", "workspace_closure", "name", e.ID)
+	}
+
+	var wsID string
+	if err := r.db.QueryRowContext(ctx, `SELECT workspace_id FROM todos WHERE id = ?`, e.ID).Scan(&wsID); err != nil {
+		return nil, fmt.Errorf("failed to load trash entry location: %w", err)
+	}
+
+	wsPath, err := ancestorNames(ctx, r.db, "workspaces", "workspace_closure", "name", wsID)
+	if err != nil {
+		return nil, err
+	}
+	var wsName string
+	if err := r.db.QueryRowContext(ctx, `SELECT name FROM workspaces WHERE id = ?`, wsID).Scan(&wsName); err != nil {
+		return nil, fmt.Errorf("failed to load trash entry location: %w", err)
+	}
+
+	parents, err := ancestorNames(ctx, r.db, "todos", "todo_closure", "description", e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(wsPath, wsName), parents...), nil
+}
+
+// Restore brings an entry and the descendants deleted with it back to
+// where they were. It fails if the parent or workspace of the entry is
+// still in the trash.
+func (r *TrashRepository) Restore(ctx context.Context, e *TrashEntry) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	switch e.EntityType {
+	case wal.EntityTodo:
+		return r.restoreTodo(ctx, e.ID)
+	case wal.EntityWorkspace:
+		return r.restoreWorkspace(ctx, e.ID)
+	}
+	return fmt.Errorf("%w: unknown entity type %q", domain.ErrInvalidOperation, e.EntityType)
+}
+
+func (r *TrashRepository) restoreTodo(ctx context.Context, id string) error {
+	ids, err := deletedSubtreeIDs(ctx, r.db, "todos", "todo_closure", id)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("failed to restore todo: %w", domain.ErrNotFound)
+	}
+
+	before, err := loadTodoSnapshot(ctx, r.db, ids)
+	if err != nil {
+		return err
+	}
+
+	if parentID := parentOf(before.Closure, id); parentID != "" {
+		if err := r.checkNotDeleted(ctx, "todos", "description", parentID); err != nil {
+			return err
+		}
+	}
+	if err := r.checkNotDeleted(ctx, "workspaces", "name", findTodoRecord(before, id).WorkspaceID); err != nil {
+		return err
+	}
+
+	now := domain.FormatTime(time.Now())
+	after := before.clone()
+	for i := range after.Todos {
+		after.Todos[i].DeletedAt = nil
+		after.Todos[i].DeletedBatch = nil
+		after.Todos[i].UpdatedAt = now
+	}
+	after.Closure = withSelfRows(after.Closure, ids)
+
+	return recordOperation(ctx, r.wal, wal.EntityTodo, wal.OpUpdate, id, before, after)
+}
+
+func (r *TrashRepository) restoreWorkspace(ctx context.Context, id string) error {
+	ids, err := deletedSubtreeIDs(ctx, r.db, "workspaces", "workspace_closure", id)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("failed to restore workspace: %w", domain.ErrNotFound)
+	}
+
+	before, err := loadWorkspaceSnapshot(ctx, r.db, ids)
+	if err != nil {
+		return err
+	}
+
+	if parentID := parentOf(before.Closure, id); parentID != "" {
+		if err := r.checkNotDeleted(ctx, "workspaces", "name", parentID); err != nil {
+			return err
+		}
+	}
+
+	// The todos deleted with the workspaces come back too
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM todos
+		WHERE workspace_id IN (`+placeholders(len(ids))+`)
+			AND deleted_batch = (SELECT deleted_batch FROM workspaces WHERE id = ?)
+	`, append(stringArgs(ids), id)...)
+	if err != nil {
+		return fmt.Errorf("failed to restore workspace: %w", err)
+	}
+	todoIDs, err := scanIDs(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to restore workspace: %w", err)
+	}
+	if before.Todos, err = loadTodoSnapshot(ctx, r.db, todoIDs); err != nil {
+		return err
+	}
+
+	now := domain.FormatTime(time.Now())
+	after := before.clone()
+	for i := range after.Workspaces {
+		after.Workspaces[i].DeletedAt = nil
+		after.Workspaces[i].DeletedBatch = nil
+		after.Workspaces[i].UpdatedAt = now
+	}
+	after.Closure = withSelfRows(after.Closure, ids)
+	for i := range after.Todos.Todos {
+		after.Todos.Todos[i].DeletedAt = nil
+		after.Todos.Todos[i].DeletedBatch = nil
+		after.Todos.Todos[i].UpdatedAt = now
+	}
+	after.Todos.Closure = withSelfRows(after.Todos.Closure, todoIDs)
+
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpUpdate, id, before, after)
+}
+
+// checkNotDeleted fails if the row is in the trash
+func (r *TrashRepository) checkNotDeleted(ctx context.Context, table, nameColumn, id string) error {
+	var name string
+	var deleted bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT `+nameColumn+`, deleted_at IS NOT NULL FROM `+table+` WHERE id = ?
+	`, id).Scan(&name, &deleted)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", table, err)
+	}
+	if deleted {
+		return fmt.Errorf("%w: %s is in the trash, restore it first", domain.ErrInvalidOperation, quote(name))
+	}
+	return nil
+}
+
+// Purge permanently deletes rows that have been in the trash longer than
+// retention, then vacuums the database. The undo history is left to the
+// retention policy: undoing or redoing an operation on purged rows fails
+// with domain.ErrConflict rather than bring them back.
+func (r *TrashRepository) Purge(ctx context.Context, retention time.Duration) (*PurgeResult, error) {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	cutoff := domain.FormatTime(time.Now().Add(-retention))
+
+	// Todos go with their workspace
+	const purgedTodos = `
+		FROM todos
+		WHERE deleted_at < ?
+			OR workspace_id IN (SELECT id FROM workspaces WHERE deleted_at < ?)
+	`
+	const purgedWorkspaces = `FROM workspaces WHERE deleted_at < ?`
+
+	var result PurgeResult
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) `+purgedTodos, cutoff, cutoff).Scan(&result.Todos); err != nil {
+		return nil, fmt.Errorf("failed to count purged todos: %w", err)
+	}
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) `+purgedWorkspaces, cutoff).Scan(&result.Workspaces); err != nil {
+		return nil, fmt.Errorf("failed to count purged workspaces: %w", err)
+	}
+	if result.Todos == 0 && result.Workspaces == 0 {
+		return &result, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Closure rows are removed by ON DELETE CASCADE
+	if _, err := tx.ExecContext(ctx, `DELETE `+purgedTodos, cutoff, cutoff); err != nil {
+		return nil, fmt.Errorf("failed to purge todos: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE `+purgedWorkspaces, cutoff); err != nil {
+		return nil, fmt.Errorf("failed to purge workspaces: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit purge: %w", err)
+	}
+
+	if err := r.db.Vacuum(ctx); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Helper functions
+
+// deletedSubtreeIDs returns a deleted row and the descendants deleted
+// together with it, root first
+func deletedSubtreeIDs(ctx context.Context, q querier, table, closure, rootID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT c.descendant_id
+		FROM `+closure+` c
+		JOIN `+table+` root ON root.id = c.ancestor_id
+		JOIN `+table+` d ON d.id = c.descendant_id
+		WHERE c.ancestor_id = ? AND root.deleted_at IS NOT NULL AND d.deleted_batch = root.deleted_batch
+		ORDER BY c.depth
+	`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deleted subtree: %w", err)
+	}
+	ids, err := scanIDs(rows)
+	rows.Close()
+	if err != nil || len(ids) > 0 {
+		return ids, err
+	}
+
+	// Rows deleted before closure rows were kept have none left
+	rows, err = q.QueryContext(ctx, `SELECT id FROM `+table+` WHERE id = ? AND deleted_at IS NOT NULL`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deleted subtree: %w", err)
+	}
+	defer rows.Close()
+
+	return scanIDs(rows)
+}
+
+// ancestorNames returns the names of a row's ancestors, outermost first
+func ancestorNames(ctx context.Context, q querier, table, closure, nameColumn, id string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT a.`+nameColumn+`
+		FROM `+closure+` c
+		JOIN `+table+` a ON a.id = c.ancestor_id
+		WHERE c.descendant_id = ? AND c.depth > 0
+		ORDER BY c.depth DESC
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	return scanIDs(rows)
+}
+
+// withSelfRows adds the depth 0 closure row of every ID that lacks one
+func withSelfRows(closure []ClosureRecord, ids []string) []ClosureRecord {
+	has := make(map[string]bool)
+	for _, c := range closure {
+		if c.Depth == 0 {
+			has[c.DescendantID] = true
+		}
+	}
+	for _, id := range ids {
+		if !has[id] {
+			closure = append(closure, ClosureRecord{AncestorID: id, DescendantID: id, Depth: 0})
+		}
+	}
+	return closure
+}
+
+// sortTrash orders entries most recently deleted first
+func sortTrash(entries []*TrashEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].DeletedAt.Equal(entries[j].DeletedAt) {
+			return entries[i].DeletedAt.After(entries[j].DeletedAt)
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+}
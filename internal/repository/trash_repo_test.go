@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// trashEntries returns the trash listed by name
+func (s *testStore) trashEntries(t *testing.T) map[string]*TrashEntry {
+	t.Helper()
+	entries, err := s.trash.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*TrashEntry, len(entries))
+	for _, e := range entries {
+		byName[e.Name] = e
+	}
+	return byName
+}
+
+func TestDeletesInTheSameSecondAreSeparateEntries(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	milk := s.todo(t, ws.ID, "", "Buy milk")
+	s.todo(t, ws.ID, milk.ID, "Oat milk")
+	bread := s.todo(t, ws.ID, "", "Buy bread")
+
+	for _, id := range []string{milk.ID, bread.ID} {
+		if err := s.todos.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Both deletes land on the same timestamp
+	if _, err := s.db.Exec(`UPDATE todos SET deleted_at = '2024-01-01T00:00:00Z' WHERE deleted_at IS NOT NULL`); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := s.trashEntries(t)
+	if len(entries) != 2 || entries["Buy milk"] == nil || entries["Buy bread"] == nil {
+		t.Fatalf("trash lists %v, want one entry per delete", entries)
+	}
+	if n := entries["Buy milk"].Items; n != 2 {
+		t.Errorf("the milk entry holds %d items, want it with its subtask", n)
+	}
+
+	if err := s.trash.Restore(ctx, entries["Buy milk"]); err != nil {
+		t.Fatal(err)
+	}
+	if !s.get(t, bread.ID).IsDeleted() {
+		t.Error("restoring one delete restored the other")
+	}
+	if entries := s.trashEntries(t); len(entries) != 1 || entries["Buy bread"] == nil {
+		t.Errorf("trash lists %v after the restore, want only the bread", entries)
+	}
+	s.checkIntegrity(t)
+}
+
+func TestWorkspaceDeleteIsOneEntry(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	home := s.workspace(t, "Home", "")
+	garden := s.workspace(t, "Garden", home.ID)
+	s.todo(t, garden.ID, "", "Weed the beds")
+	s.todo(t, home.ID, "", "Mop")
+
+	if err := s.workspaces.Delete(ctx, home.ID); err != nil {
+		t.Fatal(err)
+	}
+	entries := s.trashEntries(t)
+	if len(entries) != 1 || entries["Home"] == nil || entries["Home"].Items != 4 {
+		t.Fatalf("trash lists %v, want Home with its workspace and todos", entries)
+	}
+
+	if err := s.trash.Restore(ctx, &TrashEntry{EntityType: wal.EntityWorkspace, ID: home.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if entries := s.trashEntries(t); len(entries) != 0 {
+		t.Errorf("trash lists %v after the restore, want it empty", entries)
+	}
+	s.checkIntegrity(t)
+}
+
+func TestPurgeKeepsTheUndoHistory(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ws := s.workspace(t, "Home", "")
+	milk := s.todo(t, ws.ID, "", "Buy milk")
+	bread := s.todo(t, ws.ID, "", "Buy bread")
+
+	if err := s.todos.Delete(ctx, milk.ID); err != nil {
+		t.Fatal(err)
+	}
+	renamed := s.get(t, bread.ID)
+	renamed.Description = "Buy rye bread"
+	if err := s.todos.Update(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`UPDATE todos SET deleted_at = '2024-01-01T00:00:00Z' WHERE id = ?`, milk.ID); err != nil {
+		t.Fatal(err)
+	}
+	logged := s.logSize(t)
+
+	result, err := s.trash.Purge(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Todos != 1 || result.Workspaces != 0 {
+		t.Errorf("purged %+v, want the milk only", result)
+	}
+	if n := s.logSize(t); n != logged {
+		t.Fatalf("log has %d operations after the purge, want %d", n, logged)
+	}
+
+	// The rename is still undone; the delete of the purged todo is not
+	s.undo(t)
+	if got := s.get(t, bread.ID); got.Description != "Buy bread" {
+		t.Errorf("after undo the todo is %q, want %q", got.Description, "Buy bread")
+	}
+	if _, err := s.wal.Undo(ctx, s.applier.RevertIn); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("undoing the delete of a purged todo: got %v, want %v", err, domain.ErrConflict)
+	}
+	if _, err := s.todos.GetByID(ctx, milk.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("purged todo: got %v, want %v", err, domain.ErrNotFound)
+	}
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// SavedViewRecord is a saved_views row exactly as stored. It is the whole
+// snapshot of a view operation; nil means the view does not exist.
+type SavedViewRecord struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Position  int    `json:"position"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// SavedViewRepository implements domain.SavedViewRepository.
+// Every mutation is recorded in the WAL, so saving and deleting views can
+// be undone like any other change.
+type SavedViewRepository struct {
+	db  *DB
+	wal *wal.WAL
+}
+
+// NewSavedViewRepository creates a new saved view repository
+func NewSavedViewRepository(db *DB, w *wal.WAL) *SavedViewRepository {
+	return &SavedViewRepository{db: db, wal: w}
+}
+
+// Create saves a new view after the existing ones
+func (r *SavedViewRepository) Create(ctx context.Context, view *domain.SavedView) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	if view.ID == "" {
+		view.ID = uuid.New().String()
+	}
+	view.CreatedAt = time.Now()
+	view.UpdatedAt = view.CreatedAt
+
+	var last sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, `SELECT MAX(position) FROM saved_views`).Scan(&last); err != nil {
+		return fmt.Errorf("failed to create view: %w", err)
+	}
+	if last.Valid {
+		view.Position = int(last.Int64) + 1
+	}
+
+	after := &SavedViewRecord{
+		ID:        view.ID,
+		Name:      view.Name,
+		Query:     view.Query,
+		Position:  view.Position,
+		CreatedAt: domain.FormatTime(view.CreatedAt),
+		UpdatedAt: domain.FormatTime(view.UpdatedAt),
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntitySavedView, wal.OpCreate, view.ID, nil, after)
+}
+
+// Rename renames a view
+func (r *SavedViewRepository) Rename(ctx context.Context, id string, name string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, err := loadSavedView(ctx, r.db, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return fmt.Errorf("failed to rename view: %w", domain.ErrNotFound)
+	}
+
+	after := *before
+	after.Name = name
+	after.UpdatedAt = domain.FormatTime(time.Now())
+
+	return recordOperation(ctx, r.wal, wal.EntitySavedView, wal.OpUpdate, id, before, &after)
+}
+
+// Delete removes a view
+func (r *SavedViewRepository) Delete(ctx context.Context, id string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, err := loadSavedView(ctx, r.db, id)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return nil
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntitySavedView, wal.OpDelete, id, before, nil)
+}
+
+// GetAll retrieves every view in order
+func (r *SavedViewRepository) GetAll(ctx context.Context) ([]*domain.SavedView, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, query, position, created_at, updated_at
+		FROM saved_views
+		ORDER BY position, created_at, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get views: %w", err)
+	}
+	defer rows.Close()
+
+	var views []*domain.SavedView
+	for rows.Next() {
+		var v domain.SavedView
+		var createdAt, updatedAt string
+		if err := rows.Scan(&v.ID, &v.Name, &v.Query, &v.Position, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan view: %w", err)
+		}
+		if v.CreatedAt, err = domain.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+		if v.UpdatedAt, err = domain.ParseTime(updatedAt); err != nil {
+			return nil, err
+		}
+		views = append(views, &v)
+	}
+
+	return views, rows.Err()
+}
+
+// loadSavedView reads a view row, or nil when there is none
+func loadSavedView(ctx context.Context, q querier, id string) (*SavedViewRecord, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, name, query, position, created_at, updated_at
+		FROM saved_views
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load view: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var v SavedViewRecord
+	if err := rows.Scan(&v.ID, &v.Name, &v.Query, &v.Position, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan view: %w", err)
+	}
+	return &v, nil
+}
+
+// applySavedViewSnapshot moves a view row from state `from` to state `to`
+func applySavedViewSnapshot(ctx context.Context, q querier, from, to *SavedViewRecord) error {
+	if to == nil {
+		if from == nil {
+			return fmt.Errorf("%w: view operation has neither side", domain.ErrInvalidOperation)
+		}
+		if _, err := q.ExecContext(ctx, `DELETE FROM saved_views WHERE id = ?`, from.ID); err != nil {
+			return fmt.Errorf("failed to delete view %s: %w", from.ID, err)
+		}
+		return nil
+	}
+
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO saved_views (id, name, query, position, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			query = excluded.query,
+			position = excluded.position,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at
+	`, to.ID, to.Name, to.Query, to.Position, to.CreatedAt, to.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to write view %s: %w", to.ID, err)
+	}
+	return nil
+}
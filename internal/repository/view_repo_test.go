@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// savedViews returns the views in order as "name=query"
+func (s *testStore) savedViews(t *testing.T) []string {
+	t.Helper()
+	views, err := s.views.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range views {
+		got = append(got, v.Name+"="+v.Query)
+	}
+	return got
+}
+
+func TestSavedViewChangesUndoAndRedo(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	work := &domain.SavedView{Name: "Work", Query: "tag:work status:pending"}
+	milk := &domain.SavedView{Name: "Milk", Query: `"buy milk" ws:"Side projects"`}
+
+	steps := []struct {
+		name string
+		do   func() error
+		want []string
+	}{
+		{"create", func() error { return s.views.Create(ctx, work) },
+			[]string{"Work=tag:work status:pending"}},
+		{"create another", func() error { return s.views.Create(ctx, milk) },
+			[]string{"Work=tag:work status:pending", `Milk="buy milk" ws:"Side projects"`}},
+		{"rename", func() error { return s.views.Rename(ctx, work.ID, "Office") },
+			[]string{"Office=tag:work status:pending", `Milk="buy milk" ws:"Side projects"`}},
+		{"delete", func() error { return s.views.Delete(ctx, work.ID) },
+			[]string{`Milk="buy milk" ws:"Side projects"`}},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := s.savedViews(t); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("after %s views are %q, want %q", step.name, got, step.want)
+		}
+	}
+	if n := s.logSize(t); n != len(steps) {
+		t.Errorf("log has %d operations, want %d", n, len(steps))
+	}
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		s.undo(t)
+		var want []string
+		if i > 0 {
+			want = steps[i-1].want
+		}
+		if got := s.savedViews(t); !reflect.DeepEqual(got, want) {
+			t.Errorf("after undoing %s views are %q, want %q", steps[i].name, got, want)
+		}
+	}
+	for _, step := range steps {
+		s.redo(t)
+		if got := s.savedViews(t); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after redoing %s views are %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestSavedViewFindsWhatSearchFinds(t *testing.T) {
+	searchModes(t, func(t *testing.T, s *testStore) {
+		ctx := context.Background()
+		home := s.workspace(t, "Home", "")
+		side := s.workspace(t, "Side projects", "")
+		s.todo(t, home.ID, "", "Buy milk @home")
+		s.todo(t, side.ID, "", "Buy milk for the demo @work")
+		s.todo(t, side.ID, "", "Deploy the api @work/api")
+		s.todo(t, home.ID, "", "Call the plumber")
+
+		queries := []string{
+			"milk",
+			"tag:work",
+			`"buy milk" ws:"Side projects"`,
+			"deploy status:pending urgency>=low",
+		}
+		for i, q := range queries {
+			if err := s.views.Create(ctx, &domain.SavedView{Name: q, Query: q}); err != nil {
+				t.Fatal(err)
+			}
+			// Searches run on the views as stored, so reopen them
+			views, err := s.views.GetAll(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := s.search(t, q)
+			if len(want) == 0 {
+				t.Fatalf("search %q found nothing", q)
+			}
+			if got := s.search(t, views[i].Query); !reflect.DeepEqual(got, want) {
+				t.Errorf("view %q found %q, search found %q", q, got, want)
+			}
+		}
+	})
+}
@@ -4,105 +4,191 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/wal"
 )
 
-// WorkspaceRepository implements domain.WorkspaceRepository
+// WorkspaceRepository implements domain.WorkspaceRepository.
+// Every mutation is recorded in the WAL before it reaches the workspaces table.
 type WorkspaceRepository struct {
-	db *DB
+	db  *DB
+	wal *wal.WAL
 }
 
 // NewWorkspaceRepository creates a new workspace repository
-func NewWorkspaceRepository(db *DB) *WorkspaceRepository {
-	return &WorkspaceRepository{db: db}
+func NewWorkspaceRepository(db *DB, w *wal.WAL) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db, wal: w}
 }
 
 // Create creates a new workspace
 func (r *WorkspaceRepository) Create(ctx context.Context, workspace *domain.Workspace) error {
-	if workspace.ID == "" {
-		workspace.ID = uuid.New().String()
-	}
-	workspace.CreatedAt = time.Now()
-	workspace.UpdatedAt = workspace.CreatedAt
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
 
-	tx, err := r.db.BeginTx(ctx, nil)
+	after, err := newWorkspaceSnapshot(ctx, r.db, workspace)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
-	defer tx.Rollback()
 
-	// Insert workspace
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO workspaces (id, name, position, is_expanded, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, workspace.ID, workspace.Name, workspace.Position, workspace.IsExpanded,
-		workspace.CreatedAt.Format(time.RFC3339), workspace.UpdatedAt.Format(time.RFC3339))
-	if err != nil {
-		return fmt.Errorf("failed to insert workspace: %w", err)
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpCreate, workspace.ID, nil, after)
+}
+
+// newWorkspaceSnapshot fills in the ID and timestamps of a new workspace
+// and returns its row with the closure rows under its parent
+func newWorkspaceSnapshot(ctx context.Context, q querier, workspace *domain.Workspace) (*WorkspaceSnapshot, error) {
+	if workspace.ID == "" {
+		workspace.ID = uuid.New().String()
 	}
+	workspace.CreatedAt = time.Now()
+	workspace.UpdatedAt = workspace.CreatedAt
 
-	// Insert self-reference in closure table
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO workspace_closure (ancestor_id, descendant_id, depth)
-		VALUES (?, ?, 0)
-	`, workspace.ID, workspace.ID)
-	if err != nil {
-		return fmt.Errorf("failed to insert self-reference: %w", err)
+	snap := &WorkspaceSnapshot{
+		Workspaces: []WorkspaceRecord{newWorkspaceRecord(workspace)},
+		Closure:    []ClosureRecord{{AncestorID: workspace.ID, DescendantID: workspace.ID, Depth: 0}},
 	}
 
-	// If has parent, insert closure relationships
+	// If has parent, add closure relationships
 	if workspace.ParentID != "" {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO workspace_closure (ancestor_id, descendant_id, depth)
-			SELECT ancestor_id, ?, depth + 1
-			FROM workspace_closure
-			WHERE descendant_id = ?
-		`, workspace.ID, workspace.ParentID)
+		parentRows, err := loadClosure(ctx, q, "workspace_closure", []string{workspace.ParentID})
 		if err != nil {
-			return fmt.Errorf("failed to insert closure relationships: %w", err)
+			return nil, err
+		}
+		for _, p := range parentRows {
+			snap.Closure = append(snap.Closure, ClosureRecord{
+				AncestorID:   p.AncestorID,
+				DescendantID: workspace.ID,
+				Depth:        p.Depth + 1,
+			})
 		}
 	}
 
-	return tx.Commit()
+	return snap, nil
 }
 
-// Update updates an existing workspace
+// Update updates an existing workspace. Whether it is expanded is left
+// as stored; that is set with SetExpanded.
 func (r *WorkspaceRepository) Update(ctx context.Context, workspace *domain.Workspace) error {
-	workspace.UpdatedAt = time.Now()
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
 
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE workspaces
-		SET name = ?, position = ?, is_expanded = ?, updated_at = ?
-		WHERE id = ? AND deleted_at IS NULL
-	`, workspace.Name, workspace.Position, workspace.IsExpanded,
-		workspace.UpdatedAt.Format(time.RFC3339), workspace.ID)
+	before, err := loadWorkspaceSnapshot(ctx, r.db, []string{workspace.ID})
 	if err != nil {
-		return fmt.Errorf("failed to update workspace: %w", err)
+		return err
 	}
+	if len(before.Workspaces) == 0 || before.Workspaces[0].DeletedAt != nil {
+		return fmt.Errorf("failed to update workspace: %w", domain.ErrNotFound)
+	}
+
+	workspace.UpdatedAt = time.Now()
+
+	after := before.clone()
+	rec := &after.Workspaces[0]
+	rec.Name = workspace.Name
+	rec.Position = workspace.Position
+	rec.UpdatedAt = domain.FormatTime(workspace.UpdatedAt)
+
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpUpdate, workspace.ID, before, after)
+}
 
+// SetExpanded expands or collapses a workspace. It is view state, not an
+// edit: it is written directly, is not logged and cannot be undone, and
+// leaves updated_at alone so logged operations on the workspace still
+// match its row.
+func (r *WorkspaceRepository) SetExpanded(ctx context.Context, id string, expanded bool) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE workspaces SET is_expanded = ? WHERE id = ? AND deleted_at IS NULL
+	`, expanded, id)
+	if err != nil {
+		return fmt.Errorf("failed to expand workspace: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to expand workspace: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("failed to expand workspace: %w", domain.ErrNotFound)
+	}
 	return nil
 }
 
-// Delete soft-deletes a workspace
+// Delete soft-deletes a workspace, its active descendants and every
+// active todo in them as one operation. They share one deletion batch, so
+// the trash lists them as one entry and restores them together.
 func (r *WorkspaceRepository) Delete(ctx context.Context, id string) error {
-	now := time.Now().Format(time.RFC3339)
-
-	// Soft delete workspace and all descendants
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE workspaces
-		SET deleted_at = ?, updated_at = ?
-		WHERE id IN (
-			SELECT descendant_id FROM workspace_closure WHERE ancestor_id = ?
-		) AND deleted_at IS NULL
-	`, now, now, id)
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	ids, todoIDs, err := loadDeletionIDs(ctx, r.db, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete workspace: %w", err)
 	}
+	if len(ids) == 0 {
+		return nil
+	}
 
-	return nil
+	before, err := loadWorkspaceSnapshot(ctx, r.db, ids)
+	if err != nil {
+		return err
+	}
+	if before.Todos, err = loadTodoSnapshot(ctx, r.db, todoIDs); err != nil {
+		return err
+	}
+
+	now := domain.FormatTime(time.Now())
+	batch := uuid.New().String()
+	after := before.clone()
+	for i := range after.Workspaces {
+		after.Workspaces[i].DeletedAt = &now
+		after.Workspaces[i].DeletedBatch = &batch
+		after.Workspaces[i].UpdatedAt = now
+	}
+	for i := range after.Todos.Todos {
+		after.Todos.Todos[i].DeletedAt = &now
+		after.Todos.Todos[i].DeletedBatch = &batch
+		after.Todos.Todos[i].UpdatedAt = now
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpDelete, id, before, after)
+}
+
+// DeleteImpact returns how many descendant workspaces and todos Delete
+// would move to the trash along with a workspace
+func (r *WorkspaceRepository) DeleteImpact(ctx context.Context, id string) (workspaces, todos int, err error) {
+	ids, todoIDs, err := loadDeletionIDs(ctx, r.db, id)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count workspace contents: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, 0, domain.ErrNotFound
+	}
+	return len(ids) - 1, len(todoIDs), nil
+}
+
+// loadDeletionIDs returns the active workspaces of a subtree, root first,
+// and the active todos in them. Todos already in the trash keep their own
+// entries.
+func loadDeletionIDs(ctx context.Context, q querier, id string) (ids, todoIDs []string, err error) {
+	ids, err = loadActiveSubtreeIDs(ctx, q, "workspaces", "workspace_closure", id)
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT id FROM todos
+		WHERE workspace_id IN (`+placeholders(len(ids))+`) AND deleted_at IS NULL
+	`, stringArgs(ids)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	todoIDs, err = scanIDs(rows)
+	rows.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ids, todoIDs, nil
 }
 
 // GetByID retrieves a workspace by ID
@@ -126,11 +212,8 @@ func (r *WorkspaceRepository) GetByID(ctx context.Context, id string) (*domain.W
 		return nil, fmt.Errorf("failed to get workspace: %w", err)
 	}
 
-	w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-	if deletedAt.Valid {
-		t, _ := time.Parse(time.RFC3339, deletedAt.String)
-		w.DeletedAt = &t
+	if err := parseWorkspaceTimes(&w, createdAt, updatedAt, deletedAt); err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
 	}
 	if parentID.Valid {
 		w.ParentID = parentID.String
@@ -147,7 +230,7 @@ func (r *WorkspaceRepository) GetAll(ctx context.Context) ([]*domain.Workspace,
 			   (SELECT ancestor_id FROM workspace_closure WHERE descendant_id = w.id AND depth = 1) as parent_id
 		FROM workspaces w
 		WHERE w.deleted_at IS NULL
-		ORDER BY w.position, w.name
+		ORDER BY w.position, w.name, w.id
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workspaces: %w", err)
@@ -165,8 +248,9 @@ func (r *WorkspaceRepository) GetAll(ctx context.Context) ([]*domain.Workspace,
 			return nil, fmt.Errorf("failed to scan workspace: %w", err)
 		}
 
-		w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		if err := parseWorkspaceTimes(&w, createdAt, updatedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
 		if parentID.Valid {
 			w.ParentID = parentID.String
 		}
@@ -174,7 +258,7 @@ func (r *WorkspaceRepository) GetAll(ctx context.Context) ([]*domain.Workspace,
 		workspaces = append(workspaces, &w)
 	}
 
-	return workspaces, nil
+	return workspacesInTreeOrder(workspaces), nil
 }
 
 // GetChildren retrieves direct children of a workspace
@@ -184,7 +268,7 @@ func (r *WorkspaceRepository) GetChildren(ctx context.Context, parentID string)
 		FROM workspaces w
 		JOIN workspace_closure wc ON w.id = wc.descendant_id
 		WHERE wc.ancestor_id = ? AND wc.depth = 1 AND w.deleted_at IS NULL
-		ORDER BY w.position, w.name
+		ORDER BY w.position, w.name, w.id
 	`, parentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get children: %w", err)
@@ -201,8 +285,9 @@ func (r *WorkspaceRepository) GetChildren(ctx context.Context, parentID string)
 			return nil, fmt.Errorf("failed to scan workspace: %w", err)
 		}
 
-		w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		if err := parseWorkspaceTimes(&w, createdAt, updatedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
 		w.ParentID = parentID
 		w.Depth = 1
 
@@ -236,8 +321,9 @@ func (r *WorkspaceRepository) GetDescendants(ctx context.Context, ancestorID str
 			return nil, fmt.Errorf("failed to scan workspace: %w", err)
 		}
 
-		w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		if err := parseWorkspaceTimes(&w, createdAt, updatedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
 
 		workspaces = append(workspaces, &w)
 	}
@@ -269,8 +355,9 @@ func (r *WorkspaceRepository) GetAncestors(ctx context.Context, descendantID str
 			return nil, fmt.Errorf("failed to scan workspace: %w", err)
 		}
 
-		w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		if err := parseWorkspaceTimes(&w, createdAt, updatedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
 
 		workspaces = append(workspaces, &w)
 	}
@@ -278,89 +365,244 @@ func (r *WorkspaceRepository) GetAncestors(ctx context.Context, descendantID str
 	return workspaces, nil
 }
 
-// Move moves a workspace to a new parent
+// Move moves a workspace and its subtree to a new parent, which must be
+// outside the subtree
 func (r *WorkspaceRepository) Move(ctx context.Context, id string, newParentID string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planMove(ctx, id, newParentID)
+	if err != nil {
+		return fmt.Errorf("failed to move workspace: %w", err)
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpMove, id, before, after)
+}
+
+// planMove validates a move and builds its snapshots in one transaction,
+// so the checks see the same tree the snapshots are taken from. The
+// applier checks the move again when it writes it.
+func (r *WorkspaceRepository) planMove(ctx context.Context, id, newParentID string) (*WorkspaceSnapshot, *WorkspaceSnapshot, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Remove old closure relationships (except self-reference)
-	_, err = tx.ExecContext(ctx, `
-		DELETE FROM workspace_closure
-		WHERE descendant_id IN (SELECT descendant_id FROM workspace_closure WHERE ancestor_id = ?)
-		  AND ancestor_id IN (SELECT ancestor_id FROM workspace_closure WHERE descendant_id = ? AND depth > 0)
-	`, id, id)
+	ids, err := loadSubtreeIDs(ctx, tx, "workspace_closure", id)
 	if err != nil {
-		return fmt.Errorf("failed to remove old closure relationships: %w", err)
+		return nil, nil, err
+	}
+	before, err := loadWorkspaceSnapshot(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := findWorkspaceRecord(before, id)
+	if root == nil || root.DeletedAt != nil {
+		return nil, nil, domain.ErrNotFound
 	}
 
-	// Add new closure relationships
+	var parentRows []ClosureRecord
 	if newParentID != "" {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO workspace_closure (ancestor_id, descendant_id, depth)
-			SELECT p.ancestor_id, c.descendant_id, p.depth + c.depth + 1
-			FROM workspace_closure p
-			CROSS JOIN workspace_closure c
-			WHERE p.descendant_id = ? AND c.ancestor_id = ?
-		`, newParentID, id)
+		if slices.Contains(ids, newParentID) {
+			return nil, nil, fmt.Errorf("%w: %s cannot be moved under itself or its own subtree",
+				domain.ErrCircularReference, quote(root.Name))
+		}
+
+		parent, err := loadWorkspaceSnapshot(ctx, tx, []string{newParentID})
 		if err != nil {
-			return fmt.Errorf("failed to add new closure relationships: %w", err)
+			return nil, nil, err
 		}
+		if len(parent.Workspaces) == 0 || parent.Workspaces[0].DeletedAt != nil {
+			return nil, nil, fmt.Errorf("parent %w", domain.ErrNotFound)
+		}
+		parentRows = parent.Closure
 	}
 
+	after := before.clone()
+	after.Closure = rebaseClosure(id, before.Closure, parentRows)
+
 	// Update timestamp
-	_, err = tx.ExecContext(ctx, `
-		UPDATE workspaces SET updated_at = ? WHERE id = ?
-	`, time.Now().Format(time.RFC3339), id)
+	moved := findWorkspaceRecord(after, id)
+	moved.UpdatedAt = domain.FormatTime(time.Now())
+
+	// A workspace that changes parent goes last among its new siblings
+	if newParentID != parentOf(before.Closure, id) {
+		siblings, err := loadWorkspaceSiblings(ctx, tx, newParentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		moved.Position = nextPosition(siblings)
+	}
+
+	return before, after, nil
+}
+
+// Reorder moves a workspace offset places among its siblings (negative
+// moves it up) and renumbers the sibling group. It reports false when the
+// workspace is already first or last.
+func (r *WorkspaceRepository) Reorder(ctx context.Context, id string, offset int) (bool, error) {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planReorder(ctx, id, offset)
 	if err != nil {
-		return fmt.Errorf("failed to update timestamp: %w", err)
+		return false, fmt.Errorf("failed to reorder workspace: %w", err)
+	}
+	if before == nil {
+		return false, nil
 	}
 
-	return tx.Commit()
+	return true, recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpUpdate, id, before, after)
 }
 
-// Reorder changes the position of a workspace among siblings
-func (r *WorkspaceRepository) Reorder(ctx context.Context, id string, newPosition int) error {
-	_, err := r.db.ExecContext(ctx, `
-		UPDATE workspaces SET position = ?, updated_at = ? WHERE id = ?
-	`, newPosition, time.Now().Format(time.RFC3339), id)
-	return err
+// planReorder reads the sibling group and builds the snapshots in one
+// transaction
+func (r *WorkspaceRepository) planReorder(ctx context.Context, id string, offset int) (*WorkspaceSnapshot, *WorkspaceSnapshot, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	snap, err := loadWorkspaceSnapshot(ctx, tx, []string{id})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(snap.Workspaces) == 0 || snap.Workspaces[0].DeletedAt != nil {
+		return nil, nil, domain.ErrNotFound
+	}
+
+	siblings, err := loadWorkspaceSiblings(ctx, tx, parentOf(snap.Closure, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	order := shiftSibling(siblings, id, offset)
+	if order == nil {
+		return nil, nil, nil
+	}
+
+	changes := renumber(siblings, order)
+	return renumberWorkspaces(ctx, tx, changes, changedIDs(changes, ""))
+}
+
+// CreateAfter creates a workspace right after afterID among its siblings,
+// or first among them when afterID is empty. The siblings that make room
+// are renumbered in the same operation.
+func (r *WorkspaceRepository) CreateAfter(ctx context.Context, workspace *domain.Workspace, afterID string) error {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
+	before, after, err := r.planInsert(ctx, workspace, afterID)
+	if err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	return recordOperation(ctx, r.wal, wal.EntityWorkspace, wal.OpCreate, workspace.ID, before, after)
+}
+
+// planInsert positions a new workspace among its siblings and builds the
+// snapshots in one transaction. Before holds only the siblings that move.
+func (r *WorkspaceRepository) planInsert(ctx context.Context, workspace *domain.Workspace, afterID string) (*WorkspaceSnapshot, *WorkspaceSnapshot, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	siblings, err := loadWorkspaceSiblings(ctx, tx, workspace.ParentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if workspace.ID == "" {
+		workspace.ID = uuid.New().String()
+	}
+	changes := renumber(siblings, insertSibling(siblings, workspace.ID, afterID))
+	workspace.Position = changes[workspace.ID]
+
+	created, err := newWorkspaceSnapshot(ctx, tx, workspace)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := changedIDs(changes, workspace.ID)
+	if len(ids) == 0 {
+		return nil, created, nil
+	}
+
+	before, after, err := renumberWorkspaces(ctx, tx, changes, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	after.Workspaces = append(after.Workspaces, created.Workspaces...)
+	after.Closure = append(after.Closure, created.Closure...)
+
+	return before, after, nil
 }
 
-// CheckAndRepairIntegrity verifies and repairs closure table integrity
-func (r *WorkspaceRepository) CheckAndRepairIntegrity(ctx context.Context) error {
+// renumberWorkspaces builds the snapshots that give the workspaces in ids
+// their new positions
+func renumberWorkspaces(ctx context.Context, q querier, changes map[string]int, ids []string) (*WorkspaceSnapshot, *WorkspaceSnapshot, error) {
+	before, err := loadWorkspaceSnapshot(ctx, q, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := before.clone()
+	now := domain.FormatTime(time.Now())
+	for i := range after.Workspaces {
+		after.Workspaces[i].Position = changes[after.Workspaces[i].ID]
+		after.Workspaces[i].UpdatedAt = now
+	}
+
+	return before, after, nil
+}
+
+// CheckAndRepairIntegrity repairs missing self-references and dangling
+// closure rows, then returns the problems that need 'lazytodo fsck'
+func (r *WorkspaceRepository) CheckAndRepairIntegrity(ctx context.Context) ([]*domain.IntegrityError, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Fix missing self-references
+	// Fix missing self-references, deleted workspaces included
 	_, err = tx.ExecContext(ctx, `
 		INSERT OR IGNORE INTO workspace_closure (ancestor_id, descendant_id, depth)
-		SELECT id, id, 0 FROM workspaces WHERE deleted_at IS NULL
+		SELECT id, id, 0 FROM workspaces
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to fix missing self-references: %w", err)
+		return nil, fmt.Errorf("failed to fix missing self-references: %w", err)
 	}
 
-	// Remove orphaned closure entries (entries referencing deleted workspaces)
+	// Remove orphaned closure entries (entries referencing purged workspaces).
+	// Deleted workspaces keep their rows so the trash can restore them in place.
 	_, err = tx.ExecContext(ctx, `
 		DELETE FROM workspace_closure
-		WHERE ancestor_id NOT IN (SELECT id FROM workspaces WHERE deleted_at IS NULL)
-		   OR descendant_id NOT IN (SELECT id FROM workspaces WHERE deleted_at IS NULL)
+		WHERE ancestor_id NOT IN (SELECT id FROM workspaces)
+		   OR descendant_id NOT IN (SELECT id FROM workspaces)
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to remove orphaned closure entries: %w", err)
+		return nil, fmt.Errorf("failed to remove orphaned closure entries: %w", err)
 	}
 
-	return tx.Commit()
+	c, err := checkTree(ctx, tx, workspaceTables)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit integrity repairs: %w", err)
+	}
+	return c.visible(), nil
 }
 
 // GetOrCreateArchive ensures the _archive workspace exists
 func (r *WorkspaceRepository) GetOrCreateArchive(ctx context.Context) (*domain.Workspace, error) {
+	ctx, unlock := r.wal.Lock(ctx)
+	defer unlock()
+
 	// Try to get existing _archive workspace
 	var w domain.Workspace
 	var createdAt, updatedAt string
@@ -372,8 +614,9 @@ func (r *WorkspaceRepository) GetOrCreateArchive(ctx context.Context) (*domain.W
 	`).Scan(&w.ID, &w.Name, &w.Position, &w.IsExpanded, &createdAt, &updatedAt)
 
 	if err == nil {
-		w.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		w.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+		if err := parseWorkspaceTimes(&w, createdAt, updatedAt, sql.NullString{}); err != nil {
+			return nil, fmt.Errorf("failed to get _archive workspace: %w", err)
+		}
 		return &w, nil
 	}
 
@@ -394,3 +637,28 @@ func (r *WorkspaceRepository) GetOrCreateArchive(ctx context.Context) (*domain.W
 
 	return archive, nil
 }
+
+func newWorkspaceRecord(w *domain.Workspace) WorkspaceRecord {
+	return WorkspaceRecord{
+		ID:         w.ID,
+		Name:       w.Name,
+		Position:   w.Position,
+		IsExpanded: w.IsExpanded,
+		CreatedAt:  domain.FormatTime(w.CreatedAt),
+		UpdatedAt:  domain.FormatTime(w.UpdatedAt),
+		DeletedAt:  formatNullableTime(w.DeletedAt),
+	}
+}
+
+// parseWorkspaceTimes parses the stored timestamps of a scanned workspace
+func parseWorkspaceTimes(w *domain.Workspace, createdAt, updatedAt string, deletedAt sql.NullString) error {
+	var err error
+	if w.CreatedAt, err = domain.ParseTime(createdAt); err != nil {
+		return err
+	}
+	if w.UpdatedAt, err = domain.ParseTime(updatedAt); err != nil {
+		return err
+	}
+	w.DeletedAt, err = parseNullableTime(deletedAt)
+	return err
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExpandingIsNotLogged(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	home := s.workspace(t, "Home", "")
+
+	home.Name = "House"
+	if err := s.workspaces.Update(ctx, home); err != nil {
+		t.Fatal(err)
+	}
+	s.undo(t)
+	logged := s.logSize(t)
+
+	if err := s.workspaces.SetExpanded(ctx, home.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.logSize(t); n != logged {
+		t.Errorf("collapsing logged %d operations", n-logged)
+	}
+
+	// The rename is still there to redo, and redoing it keeps the
+	// workspace collapsed
+	ops, err := s.wal.Redo(ctx, s.applier.ApplyIn)
+	if err != nil {
+		t.Fatalf("redo: %v", err)
+	}
+	if len(ops) == 0 {
+		t.Fatal("collapsing dropped the redo branch")
+	}
+	got, err := s.workspaces.GetByID(ctx, home.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "House" || got.IsExpanded {
+		t.Errorf("workspace is %q, expanded %v; want %q, collapsed", got.Name, got.IsExpanded, "House")
+	}
+
+	// Undoing the rename does not expand it again either
+	s.undo(t)
+	if got, _ := s.workspaces.GetByID(ctx, home.ID); got.IsExpanded {
+		t.Error("undo expanded the workspace")
+	}
+}
@@ -0,0 +1,39 @@
+package ui
+
+import "strings"
+
+// ConfirmDialogModel holds the state for a yes/no question
+type ConfirmDialogModel struct {
+	Title   string
+	Message string
+	Action  string // What confirming does, e.g. "delete"
+	Width   int
+	Styles  Styles
+}
+
+// Render renders the dialog
+func (m ConfirmDialogModel) Render() string {
+	contentWidth := m.Width - 4 // Account for border and padding
+
+	var content strings.Builder
+
+	// Title
+	title := m.Styles.PaneTitle.Render(m.Title)
+	content.WriteString(title)
+	content.WriteString("\n\n")
+
+	content.WriteString(m.Styles.UnselectedItem.Width(contentWidth).Render(m.Message))
+	content.WriteString("\n\n")
+
+	hint := m.Styles.EmptyState.Render("y/Enter: " + m.Action + "  n/Esc: cancel")
+	content.WriteString(hint)
+
+	return m.Styles.ActivePane.
+		Width(m.Width).
+		Render(content.String())
+}
+
+// Overlay centers the dialog on a screen of the given size
+func (m ConfirmDialogModel) Overlay(screenWidth, screenHeight int) string {
+	return overlay(m.Render(), screenWidth, screenHeight)
+}
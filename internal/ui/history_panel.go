@@ -0,0 +1,132 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// HistoryEntry is a single row of the history panel
+type HistoryEntry struct {
+	Summary   string
+	CreatedAt time.Time
+	IsUndone  bool
+}
+
+// HistoryPanelModel holds the state for the undo history panel
+type HistoryPanelModel struct {
+	Entries       []HistoryEntry
+	SelectedIndex int
+	Width         int
+	Height        int
+	Styles        Styles
+}
+
+// Render renders the history panel
+func (m HistoryPanelModel) Render() string {
+	// Calculate content dimensions
+	contentWidth := m.Width - 4   // Account for border and padding
+	contentHeight := m.Height - 4 // Account for border, title and hint
+
+	var content strings.Builder
+
+	// Title
+	title := m.Styles.PaneTitle.Render("History")
+	content.WriteString(title)
+	content.WriteString("\n")
+
+	if len(m.Entries) == 0 {
+		empty := m.Styles.EmptyState.Width(contentWidth).Render("Nothing to undo yet.")
+		content.WriteString(empty)
+		content.WriteString("\n")
+	} else {
+		// Keep the selected entry visible
+		start := 0
+		if m.SelectedIndex >= contentHeight {
+			start = m.SelectedIndex - contentHeight + 1
+		}
+
+		for i := start; i < len(m.Entries) && i < start+contentHeight; i++ {
+			content.WriteString(m.renderEntry(m.Entries[i], i == m.SelectedIndex, contentWidth))
+			content.WriteString("\n")
+		}
+	}
+
+	hint := m.Styles.EmptyState.Render("j/k: select  Enter: jump here  Esc: close")
+	content.WriteString(hint)
+
+	return m.Styles.ActivePane.
+		Width(m.Width).
+		Render(content.String())
+}
+
+// renderEntry renders a single history entry
+func (m HistoryPanelModel) renderEntry(entry HistoryEntry, selected bool, width int) string {
+	prefix := " "
+	if selected {
+		prefix = ">"
+	}
+
+	marker := "●"
+	if entry.IsUndone {
+		marker = "○"
+	}
+
+	stamp := formatHistoryTime(entry.CreatedAt)
+
+	summary := entry.Summary
+	maxLen := width - len(stamp) - 6
+	if r := []rune(summary); len(r) > maxLen && maxLen > 3 {
+		summary = string(r[:maxLen-3]) + "..."
+	}
+
+	line := fmt.Sprintf("%s%s %s  %s", prefix, marker, stamp, summary)
+
+	// Apply single style at the end
+	if selected {
+		return m.Styles.SelectedItem.Render(line)
+	}
+
+	if entry.IsUndone {
+		return m.Styles.CompletedItem.Strikethrough(false).Render(line)
+	}
+
+	return m.Styles.UnselectedItem.Render(line)
+}
+
+// Overlay centers the panel on a screen of the given size
+func (m HistoryPanelModel) Overlay(screenWidth, screenHeight int) string {
+	return overlay(m.Render(), screenWidth, screenHeight)
+}
+
+// overlay centers rendered content on a screen of the given size
+func overlay(content string, screenWidth, screenHeight int) string {
+	horizontalPad := (screenWidth - lipgloss.Width(content)) / 2
+	verticalPad := (screenHeight - lipgloss.Height(content)) / 2
+
+	if horizontalPad < 0 {
+		horizontalPad = 0
+	}
+	if verticalPad < 0 {
+		verticalPad = 0
+	}
+
+	return lipgloss.NewStyle().
+		Padding(verticalPad, horizontalPad).
+		Render(content)
+}
+
+// formatHistoryTime formats an entry timestamp for display
+func formatHistoryTime(t time.Time) string {
+	if t.IsZero() {
+		return "--:--"
+	}
+	local := t.Local()
+	now := time.Now()
+	if local.Year() == now.Year() && local.YearDay() == now.YearDay() {
+		return local.Format("15:04:05")
+	}
+	return local.Format("Jan 2 15:04")
+}
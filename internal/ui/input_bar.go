@@ -4,6 +4,7 @@ package ui
 type InputBarModel struct {
 	Prompt  string
 	Value   string
+	Error   string // Problem with the value, shown after it
 	Width   int
 	Styles  Styles
 }
@@ -11,6 +12,9 @@ type InputBarModel struct {
 // Render renders the input bar
 func (m InputBarModel) Render() string {
 	content := m.Prompt + m.Value + "_"
+	if m.Error != "" {
+		content += "  " + m.Styles.ErrorNotif.Render(m.Error)
+	}
 
 	return m.Styles.InputBar.
 		Width(m.Width).
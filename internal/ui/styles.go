@@ -17,18 +17,29 @@ type Styles struct {
 	// Pane styles
 	ActivePane   lipgloss.Style
 	InactivePane lipgloss.Style
+	ReadOnlyPane lipgloss.Style
 	PaneTitle    lipgloss.Style
 
+	// Label marking a read-only view
+	ReadOnlyLabel lipgloss.Style
+
 	// List item styles
 	SelectedItem   lipgloss.Style
 	UnselectedItem lipgloss.Style
 	CompletedItem  lipgloss.Style
 	EditingItem    lipgloss.Style
+	CutItem        lipgloss.Style
+	SearchMatch    lipgloss.Style
 
 	// Workspace styles
 	WorkspaceRoot  lipgloss.Style
+	SavedView      lipgloss.Style
+	ViewHeader     lipgloss.Style
 	WorkspaceChild lipgloss.Style
 
+	// Tag browser styles
+	TagCount lipgloss.Style
+
 	// Todo styles
 	TodoPending  lipgloss.Style
 	TodoComplete lipgloss.Style
@@ -70,11 +81,22 @@ func NewStyles() Styles {
 			BorderForeground(ColorMuted).
 			Padding(0, 1),
 
+		ReadOnlyPane: lipgloss.NewStyle().
+			Border(lipgloss.DoubleBorder()).
+			BorderForeground(ColorWarning).
+			Padding(0, 1),
+
 		PaneTitle: lipgloss.NewStyle().
 			Bold(true).
 			Foreground(ColorForeground).
 			Padding(0, 1),
 
+		ReadOnlyLabel: lipgloss.NewStyle().
+			Background(ColorWarning).
+			Foreground(ColorBackground).
+			Bold(true).
+			Padding(0, 1),
+
 		SelectedItem: lipgloss.NewStyle().
 			Background(ColorSelectedBg).
 			Foreground(ColorForeground).
@@ -92,12 +114,30 @@ func NewStyles() Styles {
 			Foreground(ColorPrimary).
 			Bold(true),
 
+		CutItem: lipgloss.NewStyle().
+			Foreground(ColorMuted).
+			Italic(true),
+
+		SearchMatch: lipgloss.NewStyle().
+			Foreground(ColorPrimary).
+			Underline(true),
+
+		SavedView: lipgloss.NewStyle().
+			Foreground(ColorSecondary),
+
+		ViewHeader: lipgloss.NewStyle().
+			Foreground(ColorMuted).
+			Italic(true),
+
 		WorkspaceRoot: lipgloss.NewStyle().
 			Foreground(ColorFolderRoot),
 
 		WorkspaceChild: lipgloss.NewStyle().
 			Foreground(ColorFolderChild),
 
+		TagCount: lipgloss.NewStyle().
+			Foreground(ColorMuted),
+
 		TodoPending: lipgloss.NewStyle().
 			Foreground(ColorTodoPending),
 
@@ -167,6 +207,8 @@ func (s Styles) GetModeStyle(mode string) lipgloss.Style {
 		return s.ModeSearch
 	case "SORT":
 		return s.ModeSort
+	case "PAST":
+		return s.ModeSearch
 	default:
 		return s.ModeNormal
 	}
@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// TagPaneModel holds the state for the tag browser, shown in place of the
+// workspace pane
+type TagPaneModel struct {
+	Tags          []*domain.Tag // In name order, so nested tags follow the tag they are under
+	SelectedIndex int
+	IsActive      bool
+	Width         int
+	Height        int
+	Styles        Styles
+	// Renaming state
+	IsEditing  bool
+	EditBuffer string
+}
+
+// Render renders the tag pane
+func (m TagPaneModel) Render() string {
+	var paneStyle lipgloss.Style
+	if m.IsActive {
+		paneStyle = m.Styles.ActivePane
+	} else {
+		paneStyle = m.Styles.InactivePane
+	}
+
+	// Calculate content dimensions
+	contentWidth := m.Width - 4   // Account for border and padding
+	contentHeight := m.Height - 3 // Account for border and title
+
+	// Build content
+	var content strings.Builder
+
+	// Title
+	title := m.Styles.PaneTitle.Render("Tags")
+	content.WriteString(title)
+	content.WriteString("\n")
+
+	if len(m.Tags) == 0 {
+		empty := m.Styles.EmptyState.Width(contentWidth).Render("No tags\nWrite @tag in a todo")
+		content.WriteString(empty)
+	} else {
+		// A nested tag hangs under the tag before its last /
+		levels := TreeLevels(len(m.Tags),
+			func(i int) string { return m.Tags[i].Name },
+			func(i int) string { return tagParent(m.Tags[i].Name) })
+		guides := treeGuides(levels)
+
+		for i, tag := range m.Tags {
+			if i >= contentHeight-1 {
+				content.WriteString("...")
+				break
+			}
+
+			if m.IsEditing && i == m.SelectedIndex {
+				content.WriteString(m.Styles.EditingItem.Render(fmt.Sprintf(">%s %s_", IconTag, m.EditBuffer)))
+			} else {
+				content.WriteString(m.renderTagItem(tag, guides[i], i == m.SelectedIndex, contentWidth))
+			}
+
+			if i < len(m.Tags)-1 {
+				content.WriteString("\n")
+			}
+		}
+	}
+
+	// Apply pane style
+	return paneStyle.
+		Width(m.Width).
+		Height(m.Height).
+		Render(content.String())
+}
+
+// renderTagItem renders a single tag with its counts of pending and
+// completed todos
+func (m TagPaneModel) renderTagItem(tag *domain.Tag, treeGuide string, selected bool, width int) string {
+	prefix := " "
+	if selected && m.IsActive {
+		prefix = ">"
+	}
+
+	// Nested tags show their last level; the guides show the rest
+	name := tag.Name[strings.LastIndex(tag.Name, domain.TagSeparator)+1:]
+	counts := fmt.Sprintf(" %d", tag.Pending)
+	if tag.Completed > 0 {
+		counts += fmt.Sprintf(" %s%d", IconTodoDone, tag.Completed)
+	}
+
+	// Truncate if too long
+	maxNameLen := width - lipgloss.Width(treeGuide) - lipgloss.Width(counts) - 5
+	if r := []rune(name); len(r) > maxNameLen && maxNameLen > 3 {
+		name = string(r[:maxNameLen-3]) + "..."
+	}
+
+	line := fmt.Sprintf("%s%s%s %s", prefix, treeGuide, IconTag, name)
+
+	// Apply single style at the end
+	if selected && m.IsActive {
+		return m.Styles.SelectedItem.Render(line + counts)
+	}
+	return m.Styles.UnselectedItem.Render(line) + m.Styles.TagCount.Render(counts)
+}
+
+// tagParent returns the tag name is nested under, or "" for a top-level tag
+func tagParent(name string) string {
+	if i := strings.LastIndex(name, domain.TagSeparator); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+// paneRows returns the rows rendered inside a pane's border, below its
+// title, without trailing blanks
+func paneRows(pane string) []string {
+	lines := strings.Split(pane, "\n")
+	var rows []string
+	for _, line := range lines[2 : len(lines)-1] {
+		row := strings.TrimRight(strings.Trim(line, "│"), " ")
+		if row != "" {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func TestTagPaneShowsCountsUnderEachTag(t *testing.T) {
+	pane := TagPaneModel{
+		Tags: []*domain.Tag{
+			{Name: "errand", Pending: 2, Completed: 1},
+			{Name: "errand/office", Pending: 1},
+			{Name: "errand/shop", Completed: 4},
+			{Name: "仕事", Pending: 3},
+		},
+		SelectedIndex: 1,
+		IsActive:      true,
+		Width:         40,
+		Height:        10,
+		Styles:        NewStyles(),
+	}
+
+	want := []string{
+		"  " + IconTag + " errand 2 " + IconTodoDone + "1",
+		" > ├─" + IconTag + " office 1",
+		"   └─" + IconTag + " shop 0 " + IconTodoDone + "4",
+		"  " + IconTag + " 仕事 3",
+	}
+	if got := paneRows(pane.Render()); !reflect.DeepEqual(got, want) {
+		t.Errorf("pane shows\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// While renaming, the selected row shows what is typed
+	pane.IsEditing, pane.EditBuffer = true, "chores/office"
+	if got := paneRows(pane.Render()); got[1] != " >"+IconTag+" chores/office_" {
+		t.Errorf("renaming row is %q", got[1])
+	}
+}
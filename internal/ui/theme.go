@@ -35,6 +35,7 @@ var ModeColors = map[string]lipgloss.Color{
 	"INSERT": ColorSuccess,
 	"SEARCH": ColorWarning,
 	"SORT":   ColorSecondary,
+	"PAST":   ColorWarning,
 }
 
 // Icons (Nerd Font)
@@ -45,4 +46,6 @@ var (
 	IconTodoDone     = ""
 	IconTodoUrgent   = ""
 	IconArchive      = ""
+	IconSavedView    = ""
+	IconTag          = ""
 )
@@ -23,12 +23,26 @@ type TodoPaneModel struct {
 	EditingIndex int
 	EditBuffer   string
 	IsAdding     bool
+	AddAfter     int // Row the add input follows, -1 to put it first
+	AddDepth     int // Tree level of the item being added, as from TreeLevels
+	// Todo cut to be pasted elsewhere
+	CutID string
+	// Search snippets by todo ID, shown in place of the description
+	Snippets map[string]string
+	// Workspace paths by workspace ID, shown after each todo when the
+	// todos come from several workspaces
+	WorkspacePaths map[string]string
+	// Read-only view of the past
+	ReadOnly bool
+	AsOf     time.Time
 }
 
 // Render renders the todo pane
 func (m TodoPaneModel) Render() string {
 	var paneStyle lipgloss.Style
-	if m.IsActive {
+	if m.ReadOnly {
+		paneStyle = m.Styles.ReadOnlyPane
+	} else if m.IsActive {
 		paneStyle = m.Styles.ActivePane
 	} else {
 		paneStyle = m.Styles.InactivePane
@@ -43,23 +57,38 @@ func (m TodoPaneModel) Render() string {
 
 	// Title
 	title := m.Styles.PaneTitle.Render("Todos")
+	if m.ReadOnly {
+		title += m.Styles.ReadOnlyLabel.Render(fmt.Sprintf("READ-ONLY · as of %s", m.AsOf.Format("Mon Jan 2 15:04")))
+	}
 	content.WriteString(title)
 	content.WriteString("\n")
 
-	if len(m.Todos) == 0 && !m.IsAdding {
+	if len(m.Todos) == 0 && m.ReadOnly {
+		empty := m.Styles.EmptyState.Width(contentWidth).Render("No todos at this time.")
+		content.WriteString(empty)
+	} else if len(m.Todos) == 0 && !m.IsAdding {
 		empty := m.Styles.EmptyState.Width(contentWidth).Render("No todos yet.\nPress 'a' to add one.")
 		content.WriteString(empty)
 	} else {
 		lineCount := 0
 
-		// If no todos but adding, show add input
-		if len(m.Todos) == 0 && m.IsAdding {
-			addLine := m.renderAddInput(contentWidth)
-			content.WriteString(addLine)
+		levels := TreeLevels(len(m.Todos),
+			func(i int) string { return m.Todos[i].ID },
+			func(i int) string { return m.Todos[i].ParentID })
+		guides, addGuide := treeGuides(levels), ""
+		if m.IsAdding {
+			guides, addGuide = guidesWithInsert(levels, m.AddAfter, m.AddDepth)
+		}
+
+		// The add input shows where the new item will land
+		if m.IsAdding && m.AddAfter < 0 {
+			content.WriteString(m.renderAddInput(addGuide))
 			lineCount++
+			if len(m.Todos) > 0 {
+				content.WriteString("\n")
+			}
 		}
 
-		// Render todos with add input after selected item
 		for i, todo := range m.Todos {
 			if lineCount >= contentHeight-1 {
 				content.WriteString("...")
@@ -68,22 +97,20 @@ func (m TodoPaneModel) Render() string {
 
 			var line string
 			if m.IsEditing && i == m.EditingIndex {
-				line = m.renderEditingItem(todo, contentWidth)
+				line = m.renderEditingItem(guides[i])
 			} else {
-				line = m.renderTodoItem(todo, i == m.SelectedIndex, contentWidth)
+				line = m.renderTodoItem(todo, guides[i], i == m.SelectedIndex, contentWidth)
 			}
 			content.WriteString(line)
 			lineCount++
 
-			// Show add input after selected item
-			if m.IsAdding && i == m.SelectedIndex {
+			if m.IsAdding && i == m.AddAfter {
 				content.WriteString("\n")
-				addLine := m.renderAddInput(contentWidth)
-				content.WriteString(addLine)
+				content.WriteString(m.renderAddInput(addGuide))
 				lineCount++
 			}
 
-			if i < len(m.Todos)-1 || (m.IsAdding && i != m.SelectedIndex) {
+			if i < len(m.Todos)-1 {
 				content.WriteString("\n")
 			}
 		}
@@ -96,8 +123,8 @@ func (m TodoPaneModel) Render() string {
 		Render(content.String())
 }
 
-// renderTodoItem renders a single todo item
-func (m TodoPaneModel) renderTodoItem(todo *domain.Todo, selected bool, width int) string {
+// renderTodoItem renders a single todo item after its tree guide
+func (m TodoPaneModel) renderTodoItem(todo *domain.Todo, treeGuide string, selected bool, width int) string {
 	// Icon based on status and urgency
 	var icon string
 
@@ -109,13 +136,6 @@ func (m TodoPaneModel) renderTodoItem(todo *domain.Todo, selected bool, width in
 		icon = IconTodo
 	}
 
-	// Indentation for nested todos
-	indent := strings.Repeat("  ", todo.Depth)
-	treeGuide := ""
-	if todo.Depth > 0 {
-		treeGuide = "├─ "
-	}
-
 	// Build line without styles first
 	prefix := " "
 	if selected && m.IsActive {
@@ -123,6 +143,7 @@ func (m TodoPaneModel) renderTodoItem(todo *domain.Todo, selected bool, width in
 	}
 
 	desc := todo.Description
+	snippet, hasSnippet := m.Snippets[todo.ID]
 
 	// Due date (plain text)
 	dueDateStr := ""
@@ -143,52 +164,117 @@ func (m TodoPaneModel) renderTodoItem(todo *domain.Todo, selected bool, width in
 		tagsStr += " @" + tag
 	}
 
+	// Workspace path (plain text)
+	pathStr := ""
+	if path, ok := m.WorkspacePaths[todo.WorkspaceID]; ok {
+		pathStr = " · " + path
+	}
+
+	// Cut marker (plain text)
+	cutStr := ""
+	if todo.ID == m.CutID {
+		cutStr = " [cut]"
+	}
+
 	// Truncate if too long
-	maxDescLen := width - len(indent) - len(treeGuide) - len(dueDateStr) - len(tagsStr) - 6
-	if len(desc) > maxDescLen && maxDescLen > 3 {
-		desc = desc[:maxDescLen-3] + "..."
+	maxDescLen := width - lipgloss.Width(treeGuide) - len(dueDateStr) - len(tagsStr) - lipgloss.Width(pathStr) - len(cutStr) - 6
+	if hasSnippet {
+		desc = truncateMarked(snippet, maxDescLen)
+	} else if r := []rune(desc); len(r) > maxDescLen && maxDescLen > 3 {
+		desc = string(r[:maxDescLen-3]) + "..."
 	}
 
-	line := fmt.Sprintf("%s%s%s%s %s%s%s", prefix, indent, treeGuide, icon, desc, tagsStr, dueDateStr)
+	line := fmt.Sprintf("%s%s%s %s%s%s%s%s", prefix, treeGuide, icon, desc, tagsStr, dueDateStr, pathStr, cutStr)
 
 	// Apply single style at the end
+	style := m.Styles.UnselectedItem
 	if selected && m.IsActive {
-		return m.Styles.SelectedItem.Render(line)
+		style = m.Styles.SelectedItem
+	} else if todo.ID == m.CutID {
+		style = m.Styles.CutItem
+	} else if todo.IsCompleted() {
+		style = m.Styles.CompletedItem
 	}
 
-	if todo.IsCompleted() {
-		return m.Styles.CompletedItem.Render(line)
+	if hasSnippet {
+		return renderMarked(line, style, m.Styles.SearchMatch.Inherit(style))
+	}
+	return style.Render(line)
+}
+
+// renderMarked renders text with style, and the search matches in it with
+// match
+func renderMarked(text string, style, match lipgloss.Style) string {
+	var b strings.Builder
+	for i, part := range strings.Split(text, domain.MatchStart) {
+		if i == 0 {
+			b.WriteString(style.Render(part))
+			continue
+		}
+		matched, rest, _ := strings.Cut(part, domain.MatchEnd)
+		b.WriteString(match.Render(matched))
+		if rest != "" {
+			b.WriteString(style.Render(rest))
+		}
+	}
+	return b.String()
+}
+
+// truncateMarked shortens a snippet to max visible runes, keeping its
+// match markers balanced
+func truncateMarked(snippet string, max int) string {
+	visible := 0
+	for _, r := range snippet {
+		if s := string(r); s != domain.MatchStart && s != domain.MatchEnd {
+			visible++
+		}
+	}
+	if visible <= max || max <= 3 {
+		return snippet
 	}
 
-	return m.Styles.UnselectedItem.Render(line)
+	var b strings.Builder
+	open := false
+	visible = 0
+	for _, r := range snippet {
+		switch string(r) {
+		case domain.MatchStart:
+			open = true
+		case domain.MatchEnd:
+			open = false
+		default:
+			if visible == max-3 {
+				if open {
+					b.WriteString(domain.MatchEnd)
+				}
+				return b.String() + "..."
+			}
+			visible++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
 // renderEditingItem renders a todo item in editing mode
-func (m TodoPaneModel) renderEditingItem(todo *domain.Todo, width int) string {
+func (m TodoPaneModel) renderEditingItem(treeGuide string) string {
 	icon := IconTodo
 
-	// Indentation
-	indent := strings.Repeat("  ", todo.Depth)
-	treeGuide := ""
-	if todo.Depth > 0 {
-		treeGuide = "├─ "
-	}
-
 	// Show edit buffer with cursor
 	editText := m.EditBuffer + "_"
 
-	line := fmt.Sprintf(">%s%s%s %s", indent, treeGuide, icon, editText)
+	line := fmt.Sprintf(">%s%s %s", treeGuide, icon, editText)
 	return m.Styles.EditingItem.Render(line)
 }
 
 // renderAddInput renders the add input line
-func (m TodoPaneModel) renderAddInput(width int) string {
+func (m TodoPaneModel) renderAddInput(treeGuide string) string {
 	icon := IconTodo
 
 	// Show edit buffer with cursor
 	editText := m.EditBuffer + "_"
 
-	line := fmt.Sprintf(">%s %s", icon, editText)
+	line := fmt.Sprintf(">%s%s %s", treeGuide, icon, editText)
 	return m.Styles.EditingItem.Render(line)
 }
 
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrashEntry is a single row of the trash panel
+type TrashEntry struct {
+	Name        string
+	IsWorkspace bool
+	Location    []string // Outermost first; empty for the top level
+	DeletedAt   time.Time
+	Items       int
+}
+
+// TrashPanelModel holds the state for the trash panel
+type TrashPanelModel struct {
+	Entries       []TrashEntry
+	SelectedIndex int
+	Retention     time.Duration // Age at which a purge removes an entry
+	Width         int
+	Height        int
+	Styles        Styles
+}
+
+// Render renders the trash panel
+func (m TrashPanelModel) Render() string {
+	// Calculate content dimensions
+	contentWidth := m.Width - 4   // Account for border and padding
+	contentHeight := m.Height - 4 // Account for border, title and hint
+
+	var content strings.Builder
+
+	// Title
+	title := m.Styles.PaneTitle.Render("Trash")
+	content.WriteString(title)
+	content.WriteString("\n")
+
+	if len(m.Entries) == 0 {
+		empty := m.Styles.EmptyState.Width(contentWidth).Render("The trash is empty.")
+		content.WriteString(empty)
+		content.WriteString("\n")
+	} else {
+		// Keep the selected entry visible
+		start := 0
+		if m.SelectedIndex >= contentHeight {
+			start = m.SelectedIndex - contentHeight + 1
+		}
+
+		for i := start; i < len(m.Entries) && i < start+contentHeight; i++ {
+			content.WriteString(m.renderEntry(m.Entries[i], i == m.SelectedIndex, contentWidth))
+			content.WriteString("\n")
+		}
+	}
+
+	hint := fmt.Sprintf("j/k: select  Enter: restore  PP: purge (%s)  Esc: close", formatRetention(m.Retention))
+	content.WriteString(m.Styles.EmptyState.Render(hint))
+
+	return m.Styles.ActivePane.
+		Width(m.Width).
+		Render(content.String())
+}
+
+// renderEntry renders a single trash entry
+func (m TrashPanelModel) renderEntry(entry TrashEntry, selected bool, width int) string {
+	prefix := " "
+	if selected {
+		prefix = ">"
+	}
+
+	name := "'" + entry.Name + "'"
+	if entry.IsWorkspace {
+		name = "workspace " + name
+	}
+	if entry.Items > 1 {
+		name += fmt.Sprintf(" (+%d)", entry.Items-1)
+	}
+
+	where := "top level"
+	if len(entry.Location) > 0 {
+		where = strings.Join(entry.Location, " › ")
+	}
+
+	stamp := formatHistoryTime(entry.DeletedAt)
+	line := fmt.Sprintf("%s %s  %s  from %s", prefix, stamp, name, where)
+	if r := []rune(line); len(r) > width && width > 3 {
+		line = string(r[:width-3]) + "..."
+	}
+
+	// Apply single style at the end
+	if selected {
+		return m.Styles.SelectedItem.Render(line)
+	}
+
+	return m.Styles.UnselectedItem.Render(line)
+}
+
+// Overlay centers the panel on a screen of the given size
+func (m TrashPanelModel) Overlay(screenWidth, screenHeight int) string {
+	return overlay(m.Render(), screenWidth, screenHeight)
+}
+
+// formatRetention formats a retention window in days
+func formatRetention(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
@@ -0,0 +1,84 @@
+package ui
+
+import "strings"
+
+// Tree guides are drawn from the order of the rows alone. The rows come in
+// pre-order, every row followed by its subtree, so a row's level says
+// where it hangs: a row is the last of its siblings when no later row at
+// the same level follows before one at a lower level.
+
+// Guide pieces, each as wide as one level of nesting
+const (
+	guideBranch = " ├─"
+	guideLast   = " └─"
+	guidePipe   = " │ "
+	guideBlank  = "   "
+)
+
+// TreeLevels returns the nesting level of each of n rows in pre-order.
+// A row sits one level under its parent when the parent is the row above
+// it or one of that row's ancestors; any other row, say one whose parent
+// is archived or not among the results, is at the top level.
+func TreeLevels(n int, id, parent func(i int) string) []int {
+	levels := make([]int, n)
+	var path []string // IDs from the top level down to the row above
+	for i := 0; i < n; i++ {
+		p := parent(i)
+		for len(path) > 0 && path[len(path)-1] != p {
+			path = path[:len(path)-1]
+		}
+		levels[i] = len(path)
+		path = append(path, id(i))
+	}
+	return levels
+}
+
+// treeGuides returns the guide drawn before each row given the levels of
+// rows in pre-order: a pipe or a blank for each ancestor below the top
+// level, whichever continues its sibling list, then a branch, or a last
+// branch for the last sibling.
+func treeGuides(levels []int) []string {
+	guides := make([]string, len(levels))
+
+	// more[k] is whether a sibling at level k is still to come
+	var more []bool
+	for i := len(levels) - 1; i >= 0; i-- {
+		level := levels[i]
+		for len(more) <= level {
+			more = append(more, false)
+		}
+		more = more[:level+1]
+
+		if level > 0 {
+			var b strings.Builder
+			for k := 1; k < level; k++ {
+				if more[k] {
+					b.WriteString(guidePipe)
+				} else {
+					b.WriteString(guideBlank)
+				}
+			}
+			if more[level] {
+				b.WriteString(guideBranch)
+			} else {
+				b.WriteString(guideLast)
+			}
+			guides[i] = b.String()
+		}
+		more[level] = true
+	}
+	return guides
+}
+
+// guidesWithInsert returns the guides of rows with a row at level inserted
+// after row after (-1 puts it first), and the guide of the inserted row
+func guidesWithInsert(levels []int, after, level int) (rows []string, inserted string) {
+	all := make([]int, 0, len(levels)+1)
+	all = append(all, levels[:after+1]...)
+	all = append(all, level)
+	all = append(all, levels[after+1:]...)
+
+	guides := treeGuides(all)
+	rows = append(guides[:after+1:after+1], guides[after+2:]...)
+	return rows, guides[after+1]
+}
@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTreeGuides(t *testing.T) {
+	// Each row is "id parent", in pre-order
+	tests := []struct {
+		name   string
+		rows   [][2]string
+		levels []int
+		guides []string
+	}{
+		{
+			name:   "flat",
+			rows:   [][2]string{{"milk", ""}, {"bread", ""}},
+			levels: []int{0, 0},
+			guides: []string{"", ""},
+		},
+		{
+			name: "nested siblings",
+			rows: [][2]string{
+				{"trip", ""},
+				{"flights", "trip"},
+				{"pack", "trip"},
+				{"charger", "pack"},
+				{"socks", "pack"},
+				{"passport", "trip"},
+				{"plants", ""},
+			},
+			levels: []int{0, 1, 1, 2, 2, 1, 0},
+			guides: []string{"", " ├─", " ├─", " │  ├─", " │  └─", " └─", ""},
+		},
+		{
+			name: "last sibling leaves a blank below it",
+			rows: [][2]string{
+				{"trip", ""},
+				{"flights", "trip"},
+				{"pack", "trip"},
+				{"charger", "pack"},
+				{"cable", "charger"},
+				{"socks", "pack"},
+			},
+			levels: []int{0, 1, 1, 2, 3, 2},
+			guides: []string{"", " ├─", " └─", "    ├─", "    │  └─", "    └─"},
+		},
+		{
+			name: "back to the top level after a deep subtree",
+			rows: [][2]string{
+				{"trip", ""},
+				{"pack", "trip"},
+				{"charger", "pack"},
+				{"cable", "charger"},
+				{"plants", ""},
+				{"water", "plants"},
+			},
+			levels: []int{0, 1, 2, 3, 0, 1},
+			guides: []string{"", " └─", "    └─", "       └─", "", " └─"},
+		},
+		{
+			name: "parent not among the rows",
+			rows: [][2]string{
+				{"trip", ""},
+				{"flights", "trip"},
+				{"socks", "archived"},
+			},
+			levels: []int{0, 1, 0},
+			guides: []string{"", " └─", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := TreeLevels(len(tt.rows),
+				func(i int) string { return tt.rows[i][0] },
+				func(i int) string { return tt.rows[i][1] })
+			if !reflect.DeepEqual(levels, tt.levels) {
+				t.Fatalf("levels are %v, want %v", levels, tt.levels)
+			}
+			if guides := treeGuides(levels); !reflect.DeepEqual(guides, tt.guides) {
+				t.Errorf("guides are %q, want %q", guides, tt.guides)
+			}
+		})
+	}
+}
@@ -11,16 +11,19 @@ import (
 // WorkspacePaneModel holds the state for the workspace pane
 type WorkspacePaneModel struct {
 	Workspaces    []*domain.Workspace
-	SelectedIndex int
+	Views         []*domain.SavedView // Listed after the workspaces; never a target for add or move
+	SelectedIndex int                 // Rows past the workspaces are views
 	IsActive      bool
 	Width         int
 	Height        int
 	Styles        Styles
 	// Editing state
 	IsEditing    bool
-	EditingIndex int
+	EditingIndex int // Row being renamed, workspace or view
 	EditBuffer   string
 	IsAdding     bool
+	AddAfter     int // Row the add input follows, -1 to put it first
+	AddDepth     int // Tree level of the item being added, as from TreeLevels
 }
 
 // Render renders the workspace pane
@@ -44,20 +47,29 @@ func (m WorkspacePaneModel) Render() string {
 	content.WriteString(title)
 	content.WriteString("\n")
 
-	if len(m.Workspaces) == 0 && !m.IsAdding {
+	if len(m.Workspaces) == 0 && len(m.Views) == 0 && !m.IsAdding {
 		empty := m.Styles.EmptyState.Width(contentWidth).Render("No workspaces\nPress 'a' to create")
 		content.WriteString(empty)
 	} else {
 		lineCount := 0
 
-		// If no workspaces but adding, show add input
-		if len(m.Workspaces) == 0 && m.IsAdding {
-			addLine := m.renderAddInput(contentWidth)
-			content.WriteString(addLine)
+		levels := TreeLevels(len(m.Workspaces),
+			func(i int) string { return m.Workspaces[i].ID },
+			func(i int) string { return m.Workspaces[i].ParentID })
+		guides, addGuide := treeGuides(levels), ""
+		if m.IsAdding {
+			guides, addGuide = guidesWithInsert(levels, m.AddAfter, m.AddDepth)
+		}
+
+		// The add input shows where the new item will land
+		if m.IsAdding && m.AddAfter < 0 {
+			content.WriteString(m.renderAddInput(addGuide))
 			lineCount++
+			if len(m.Workspaces) > 0 {
+				content.WriteString("\n")
+			}
 		}
 
-		// Render workspaces with add input after selected item
 		for i, ws := range m.Workspaces {
 			if lineCount >= contentHeight-1 {
 				content.WriteString("...")
@@ -66,25 +78,43 @@ func (m WorkspacePaneModel) Render() string {
 
 			var line string
 			if m.IsEditing && i == m.EditingIndex {
-				line = m.renderEditingItem(ws, contentWidth)
+				line = m.renderEditingItem(guides[i])
 			} else {
-				line = m.renderWorkspaceItem(ws, i == m.SelectedIndex, contentWidth)
+				line = m.renderWorkspaceItem(ws, guides[i], i == m.SelectedIndex, contentWidth)
 			}
 			content.WriteString(line)
 			lineCount++
 
-			// Show add input after selected item
-			if m.IsAdding && i == m.SelectedIndex {
+			if m.IsAdding && i == m.AddAfter {
 				content.WriteString("\n")
-				addLine := m.renderAddInput(contentWidth)
-				content.WriteString(addLine)
+				content.WriteString(m.renderAddInput(addGuide))
 				lineCount++
 			}
 
-			if i < len(m.Workspaces)-1 || (m.IsAdding && i != m.SelectedIndex) {
+			if i < len(m.Workspaces)-1 {
 				content.WriteString("\n")
 			}
 		}
+
+		// Smart views, headed so they are not mistaken for workspaces
+		if len(m.Views) > 0 && lineCount < contentHeight-2 {
+			content.WriteString("\n")
+			content.WriteString(m.Styles.ViewHeader.Render("Smart views"))
+			lineCount++
+		}
+		for i, view := range m.Views {
+			if lineCount >= contentHeight-1 {
+				break
+			}
+			row := len(m.Workspaces) + i
+			content.WriteString("\n")
+			if m.IsEditing && row == m.EditingIndex {
+				content.WriteString(m.Styles.EditingItem.Render(fmt.Sprintf(">%s %s_", IconSavedView, m.EditBuffer)))
+			} else {
+				content.WriteString(m.renderViewItem(view, row == m.SelectedIndex, contentWidth))
+			}
+			lineCount++
+		}
 	}
 
 	// Apply pane style
@@ -95,7 +125,7 @@ func (m WorkspacePaneModel) Render() string {
 }
 
 // renderWorkspaceItem renders a single workspace item
-func (m WorkspacePaneModel) renderWorkspaceItem(ws *domain.Workspace, selected bool, width int) string {
+func (m WorkspacePaneModel) renderWorkspaceItem(ws *domain.Workspace, treeGuide string, selected bool, width int) string {
 	// Icon
 	icon := IconFolderOpen
 	if !ws.IsExpanded {
@@ -105,15 +135,6 @@ func (m WorkspacePaneModel) renderWorkspaceItem(ws *domain.Workspace, selected b
 		icon = IconArchive
 	}
 
-	// Indentation
-	indent := strings.Repeat("  ", ws.Depth)
-
-	// Tree guide (plain text)
-	treeGuide := ""
-	if ws.Depth > 0 {
-		treeGuide = "├─ "
-	}
-
 	// Build line without styles
 	prefix := " "
 	if selected && m.IsActive {
@@ -123,12 +144,12 @@ func (m WorkspacePaneModel) renderWorkspaceItem(ws *domain.Workspace, selected b
 	name := ws.Name
 
 	// Truncate if too long
-	maxNameLen := width - len(indent) - len(treeGuide) - 5
+	maxNameLen := width - lipgloss.Width(treeGuide) - 5
 	if len(name) > maxNameLen && maxNameLen > 3 {
 		name = name[:maxNameLen-3] + "..."
 	}
 
-	line := fmt.Sprintf("%s%s%s%s %s", prefix, indent, treeGuide, icon, name)
+	line := fmt.Sprintf("%s%s%s %s", prefix, treeGuide, icon, name)
 
 	// Apply single style at the end
 	if selected && m.IsActive {
@@ -138,34 +159,50 @@ func (m WorkspacePaneModel) renderWorkspaceItem(ws *domain.Workspace, selected b
 	return m.Styles.UnselectedItem.Render(line)
 }
 
-// renderEditingItem renders a workspace item in editing mode
-func (m WorkspacePaneModel) renderEditingItem(ws *domain.Workspace, width int) string {
-	// Icon
-	icon := IconFolderOpen
+// renderViewItem renders a single smart view
+func (m WorkspacePaneModel) renderViewItem(view *domain.SavedView, selected bool, width int) string {
+	prefix := " "
+	if selected && m.IsActive {
+		prefix = ">"
+	}
 
-	// Indentation
-	indent := strings.Repeat("  ", ws.Depth)
+	name := view.Name
 
-	// Tree guide (plain text)
-	treeGuide := ""
-	if ws.Depth > 0 {
-		treeGuide = "├─ "
+	// Truncate if too long
+	maxNameLen := width - 5
+	if len(name) > maxNameLen && maxNameLen > 3 {
+		name = name[:maxNameLen-3] + "..."
 	}
 
+	line := fmt.Sprintf("%s%s %s", prefix, IconSavedView, name)
+
+	// Apply single style at the end
+	if selected && m.IsActive {
+		return m.Styles.SelectedItem.Render(line)
+	}
+
+	return m.Styles.SavedView.Render(line)
+}
+
+// renderEditingItem renders a workspace item in editing mode
+func (m WorkspacePaneModel) renderEditingItem(treeGuide string) string {
+	// Icon
+	icon := IconFolderOpen
+
 	// Show edit buffer with cursor
 	editText := m.EditBuffer + "_"
 
-	line := fmt.Sprintf(">%s%s%s %s", indent, treeGuide, icon, editText)
+	line := fmt.Sprintf(">%s%s %s", treeGuide, icon, editText)
 	return m.Styles.EditingItem.Render(line)
 }
 
 // renderAddInput renders the add input line
-func (m WorkspacePaneModel) renderAddInput(width int) string {
+func (m WorkspacePaneModel) renderAddInput(treeGuide string) string {
 	icon := IconFolderOpen
 
 	// Show edit buffer with cursor
 	editText := m.EditBuffer + "_"
 
-	line := fmt.Sprintf(">%s %s", icon, editText)
+	line := fmt.Sprintf(">%s%s %s", treeGuide, icon, editText)
 	return m.Styles.EditingItem.Render(line)
 }
@@ -0,0 +1,81 @@
+package ui
+
+import "strings"
+
+// WorkspacePickerModel holds the state for the workspace picker
+type WorkspacePickerModel struct {
+	Title         string
+	Query         string
+	Entries       [][]string // Path of each matching workspace, outermost first
+	SelectedIndex int
+	Width         int
+	Height        int
+	Styles        Styles
+}
+
+// Render renders the workspace picker
+func (m WorkspacePickerModel) Render() string {
+	// Calculate content dimensions
+	contentWidth := m.Width - 4   // Account for border and padding
+	contentHeight := m.Height - 5 // Account for border, title, query and hint
+
+	var content strings.Builder
+
+	// Title
+	title := m.Styles.PaneTitle.Render(m.Title)
+	content.WriteString(title)
+	content.WriteString("\n")
+
+	// Query with cursor
+	content.WriteString(m.Styles.EditingItem.Render("> " + m.Query + "_"))
+	content.WriteString("\n")
+
+	if len(m.Entries) == 0 {
+		empty := m.Styles.EmptyState.Width(contentWidth).Render("No matching workspace.")
+		content.WriteString(empty)
+		content.WriteString("\n")
+	} else {
+		// Keep the selected entry visible
+		start := 0
+		if m.SelectedIndex >= contentHeight {
+			start = m.SelectedIndex - contentHeight + 1
+		}
+
+		for i := start; i < len(m.Entries) && i < start+contentHeight; i++ {
+			content.WriteString(m.renderEntry(m.Entries[i], i == m.SelectedIndex, contentWidth))
+			content.WriteString("\n")
+		}
+	}
+
+	hint := m.Styles.EmptyState.Render("Type to filter  ↑/↓: select  Enter: move  Esc: cancel")
+	content.WriteString(hint)
+
+	return m.Styles.ActivePane.
+		Width(m.Width).
+		Render(content.String())
+}
+
+// renderEntry renders a single workspace path
+func (m WorkspacePickerModel) renderEntry(path []string, selected bool, width int) string {
+	prefix := " "
+	if selected {
+		prefix = ">"
+	}
+
+	line := prefix + " " + IconFolderOpen + " " + strings.Join(path, " › ")
+	if r := []rune(line); len(r) > width && width > 3 {
+		line = string(r[:width-3]) + "..."
+	}
+
+	// Apply single style at the end
+	if selected {
+		return m.Styles.SelectedItem.Render(line)
+	}
+
+	return m.Styles.UnselectedItem.Render(line)
+}
+
+// Overlay centers the picker on a screen of the given size
+func (m WorkspacePickerModel) Overlay(screenWidth, screenHeight int) string {
+	return overlay(m.Render(), screenWidth, screenHeight)
+}
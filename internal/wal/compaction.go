@@ -0,0 +1,204 @@
+package wal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+)
+
+const (
+	defaultRetainGroups = 1000
+	defaultRetainAge    = 30 * 24 * time.Hour
+)
+
+// groupKey is the SQL expression that identifies an operation's undo
+// group. Operations without a group form a group of their own.
+const groupKey = `COALESCE(NULLIF(undo_group_id, ''), 'op:' || id)`
+
+// RetentionPolicy bounds how much undo history the log keeps. A group is
+// kept only while it is among the newest MaxGroups groups and younger than
+// MaxAge.
+type RetentionPolicy struct {
+	MaxGroups int           // Zero means the default, negative means no limit
+	MaxAge    time.Duration // Zero means the default, negative means no limit
+}
+
+// withDefaults fills in zero fields
+func (p RetentionPolicy) withDefaults() RetentionPolicy {
+	if p.MaxGroups == 0 {
+		p.MaxGroups = defaultRetainGroups
+	}
+	if p.MaxAge == 0 {
+		p.MaxAge = defaultRetainAge
+	}
+	return p
+}
+
+// Checkpoint records a compaction: every applied operation up to LastOpID
+// has been folded into the main tables and removed from the log
+type Checkpoint struct {
+	ID         int64
+	LastOpID   int64
+	Operations int
+	Groups     int
+	CreatedAt  time.Time
+}
+
+// Stats describes the size of the operation log
+type Stats struct {
+	Operations   int
+	Groups       int
+	Unapplied    int
+	PayloadBytes int64
+	Checkpoints  int
+}
+
+// Stats returns the current size of the operation log
+func (w *WAL) Stats() (*Stats, error) {
+	var s Stats
+	err := w.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT `+groupKey+`),
+			COALESCE(SUM(applied = 0), 0), COALESCE(SUM(LENGTH(payload)), 0)
+		FROM operation_log
+	`).Scan(&s.Operations, &s.Groups, &s.Unapplied, &s.PayloadBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log size: %w", err)
+	}
+
+	if err := w.db.QueryRow(`SELECT COUNT(*) FROM wal_checkpoints`).Scan(&s.Checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to query checkpoints: %w", err)
+	}
+
+	return &s, nil
+}
+
+// Compact drops applied operations that fall outside the retention policy
+// and records a checkpoint in their place. Whole undo groups are dropped
+// so no partial group is left to undo. Unapplied operations are left for
+// recovery. It returns nil if there was nothing to compact.
+func (w *WAL) Compact() (*Checkpoint, error) {
+	policy := w.retention
+	cutoff := domain.FormatTime(time.Now().Add(-policy.MaxAge))
+
+	return w.compact(func(tx *sql.Tx) (int64, error) {
+		return compactionBoundary(tx, policy, cutoff)
+	})
+}
+
+// Checkpoint folds every applied operation into a checkpoint, leaving
+// nothing to undo or redo. It returns nil if there was nothing to fold.
+func (w *WAL) Checkpoint() (*Checkpoint, error) {
+	return w.compact(func(tx *sql.Tx) (int64, error) {
+		var boundary int64
+		err := tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM operation_log WHERE applied = 1`).Scan(&boundary)
+		if err != nil {
+			return 0, fmt.Errorf("failed to query applied operations: %w", err)
+		}
+		return boundary, nil
+	})
+}
+
+// compact drops applied operations up to the ID returned by boundary and
+// records a checkpoint in their place
+func (w *WAL) compact(boundary func(*sql.Tx) (int64, error)) (*Checkpoint, error) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	lastOpID, err := boundary(tx)
+	if err != nil || lastOpID == 0 {
+		return nil, err
+	}
+
+	cp := &Checkpoint{LastOpID: lastOpID, CreatedAt: time.Now()}
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT `+groupKey+`)
+		FROM operation_log
+		WHERE applied = 1 AND id <= ?
+	`, lastOpID).Scan(&cp.Operations, &cp.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count compacted operations: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM operation_log WHERE applied = 1 AND id <= ?`, lastOpID); err != nil {
+		return nil, fmt.Errorf("failed to compact operations: %w", err)
+	}
+
+	// Time travel cannot go back past the oldest operation left, so the
+	// transitions of dropped operations before it are no longer needed
+	_, err = tx.Exec(`
+		DELETE FROM operation_transitions
+		WHERE operation_id <= ? AND created_at < COALESCE((SELECT MIN(created_at) FROM operation_log), ?)
+	`, lastOpID, domain.FormatTime(cp.CreatedAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compact transitions: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO wal_checkpoints (last_op_id, operations, undo_groups, created_at)
+		VALUES (?, ?, ?, ?)
+	`, cp.LastOpID, cp.Operations, cp.Groups, domain.FormatTime(cp.CreatedAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record checkpoint: %w", err)
+	}
+	cp.ID, _ = result.LastInsertId()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit compaction: %w", err)
+	}
+
+	return cp, nil
+}
+
+// compactionBoundary returns the newest operation ID of the newest group
+// the policy no longer keeps, or zero if every group is kept
+func compactionBoundary(tx *sql.Tx, policy RetentionPolicy, cutoff string) (int64, error) {
+	// Groups newest first; a group's age is the age of its newest operation
+	rows, err := tx.Query(`
+		SELECT MAX(id), MAX(created_at)
+		FROM operation_log
+		WHERE applied = 1 AND is_discarded = 0
+		GROUP BY ` + groupKey + `
+		ORDER BY MAX(id) DESC
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query undo groups: %w", err)
+	}
+	defer rows.Close()
+
+	kept := 0
+	for rows.Next() {
+		var lastID int64
+		var createdAt string
+		if err := rows.Scan(&lastID, &createdAt); err != nil {
+			return 0, fmt.Errorf("failed to scan undo group: %w", err)
+		}
+
+		tooMany := policy.MaxGroups > 0 && kept >= policy.MaxGroups
+		tooOld := policy.MaxAge > 0 && createdAt < cutoff
+		if tooMany || tooOld {
+			return lastID, nil
+		}
+		kept++
+	}
+
+	return 0, rows.Err()
+}
+
+// lastCheckpoint returns the newest operation ID folded into the main
+// tables by compaction, or zero
+func (w *WAL) lastCheckpoint() (int64, error) {
+	var id int64
+	err := w.db.QueryRow(`SELECT COALESCE(MAX(last_op_id), 0) FROM wal_checkpoints`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query checkpoints: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,68 @@
+package wal_test
+
+import (
+	"testing"
+
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+func TestCompactionDropsWholeGroups(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{
+		ApplyFunc: applyAll,
+		Retention: wal.RetentionPolicy{MaxGroups: 2, MaxAge: -1},
+	})
+	for _, id := range []string{"todo-a1", "todo-a2"} {
+		if err := w.Append(newOp(id, "a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendGroups(t, w, "b", "c")
+
+	cp, err := w.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp == nil || cp.Operations != 2 || cp.Groups != 1 {
+		t.Fatalf("checkpoint is %+v, want the 2 operations of group a", cp)
+	}
+	got := logged(t, db)
+	if len(got) != 2 || !got["todo-b"] || !got["todo-c"] {
+		t.Errorf("log holds %v, want groups b and c", got)
+	}
+
+	// Nothing is left outside the policy
+	if cp, err := w.Compact(); err != nil || cp != nil {
+		t.Errorf("compacting again: got %+v, %v; want nothing", cp, err)
+	}
+	stats, err := w.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Operations != 2 || stats.Groups != 2 || stats.Checkpoints != 1 {
+		t.Errorf("stats are %+v, want 2 operations in 2 groups and 1 checkpoint", stats)
+	}
+}
+
+func TestCompactionKeepsUnappliedOperations(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{
+		ApplyFunc: applyAll,
+		Retention: wal.RetentionPolicy{MaxGroups: 1, MaxAge: -1},
+	})
+	appendGroups(t, w, "a", "b")
+	if _, err := db.Exec(`UPDATE operation_log SET applied = 0 WHERE entity_id = 'todo-a'`); err != nil {
+		t.Fatal(err)
+	}
+	appendGroups(t, w, "c")
+
+	cp, err := w.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp == nil || cp.Operations != 1 {
+		t.Fatalf("checkpoint is %+v, want only group b", cp)
+	}
+	got := logged(t, db)
+	if applied, ok := got["todo-a"]; !ok || applied || len(got) != 2 {
+		t.Errorf("log holds %v, want the unapplied op of group a and group c", got)
+	}
+}
@@ -0,0 +1,39 @@
+package wal
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type undoGroupKey struct{}
+
+type systemKey struct{}
+
+// WithUndoGroup returns a context whose operations share a new undo group,
+// so a single user action is undone and redone as a whole
+func WithUndoGroup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, undoGroupKey{}, uuid.New().String())
+}
+
+// UndoGroupFromContext returns the undo group carried by ctx, or a fresh
+// group ID when ctx carries none
+func UndoGroupFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(undoGroupKey{}).(string); ok {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// WithSystem returns a context whose operations are made by lazytodo
+// itself, such as the auto-archive at startup, rather than by the user.
+// They can be undone, but do not drop the redo branch.
+func WithSystem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey{}, true)
+}
+
+// IsSystem reports whether ctx was returned by WithSystem
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey{}).(bool)
+	return system
+}
@@ -2,6 +2,7 @@ package wal
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -21,6 +22,7 @@ type EntityType string
 const (
 	EntityWorkspace EntityType = "workspace"
 	EntityTodo      EntityType = "todo"
+	EntitySavedView EntityType = "view"
 )
 
 // Operation represents a single operation in the WAL
@@ -34,6 +36,19 @@ type Operation struct {
 	IsUndone      bool          `json:"is_undone"`
 	UndoGroupID   string        `json:"undo_group_id,omitempty"`
 	CreatedAt     time.Time     `json:"created_at"`
+
+	// System is set on operations lazytodo makes on its own; appending
+	// one keeps the redo branch
+	System bool `json:"-"`
+
+	// Rejected is set when the operation could not be applied because
+	// the rows it changes were changed first. It is no longer in the log.
+	Rejected error `json:"-"`
+}
+
+// Describe returns a short label such as "delete todo"
+func (op *Operation) Describe() string {
+	return fmt.Sprintf("%s %s", op.OperationType, op.EntityType)
 }
 
 // Payload contains the operation data
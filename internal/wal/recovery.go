@@ -2,14 +2,40 @@ package wal
 
 import (
 	"fmt"
+	"strings"
 )
 
 // RecoveryResult contains the result of recovery process
 type RecoveryResult struct {
 	RecoveredOps int
+	DiscardedOps int // Stale operations dropped instead of replayed
 	Errors       []error
 }
 
+// Empty returns true if recovery found nothing to do
+func (r *RecoveryResult) Empty() bool {
+	return r.RecoveredOps == 0 && r.DiscardedOps == 0 && len(r.Errors) == 0
+}
+
+// String returns a summary suitable for the status bar
+func (r *RecoveryResult) String() string {
+	var parts []string
+	if r.RecoveredOps > 0 {
+		parts = append(parts, fmt.Sprintf("recovered %d %s", r.RecoveredOps, plural(r.RecoveredOps, "operation")))
+	}
+	if r.DiscardedOps > 0 {
+		parts = append(parts, fmt.Sprintf("discarded %d stale %s", r.DiscardedOps, plural(r.DiscardedOps, "operation")))
+	}
+	for _, err := range r.Errors {
+		parts = append(parts, err.Error())
+	}
+	if len(parts) == 0 {
+		return "Nothing to recover"
+	}
+
+	return "Recovery: " + strings.Join(parts, ", ")
+}
+
 // RunRecovery performs crash recovery on startup
 func (w *WAL) RunRecovery() (*RecoveryResult, error) {
 	result := &RecoveryResult{}
@@ -24,21 +50,64 @@ func (w *WAL) RunRecovery() (*RecoveryResult, error) {
 		return result, nil
 	}
 
-	// Apply each operation
-	if w.applyFunc != nil {
-		if err := w.applyFunc(ops); err != nil {
-			result.Errors = append(result.Errors, err)
-		} else {
-			result.RecoveredOps = len(ops)
-		}
+	var lastApplied int64
+	err = w.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM operation_log WHERE applied = 1`).Scan(&lastApplied)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied operations: %w", err)
+	}
+
+	// Compacted operations are applied but no longer in the log
+	checkpoint, err := w.lastCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint > lastApplied {
+		lastApplied = checkpoint
 	}
 
-	// Mark all as applied
+	// An unapplied operation older than an applied one was given up on
+	// after its retries and reported as failed. Everything logged after it
+	// was snapshotted without its changes, so replaying it now would
+	// overwrite newer data.
+	var replay []*Operation
 	for _, op := range ops {
-		if _, err := w.db.Exec(`UPDATE operation_log SET applied = 1 WHERE id = ?`, op.ID); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("failed to mark op %d as applied: %w", op.ID, err))
+		if op.ID > lastApplied {
+			replay = append(replay, op)
+			continue
+		}
+		if _, err := w.db.Exec(`DELETE FROM operation_log WHERE id = ?`, op.ID); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to discard op %d: %w", op.ID, err))
+			continue
+		}
+		result.DiscardedOps++
+	}
+
+	// Replay the tail in log order. Applying is idempotent, so operations
+	// that reached the main tables before the crash but were never marked
+	// applied are safe to repeat, and ones whose rows changed since are
+	// rejected and dropped. On failure they stay unapplied and are tried
+	// again on the next start.
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	if err := w.apply(replay); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	for _, op := range replay {
+		switch {
+		case op.Applied:
+			result.RecoveredOps++
+		case op.Rejected != nil:
+			result.DiscardedOps++
 		}
 	}
 
 	return result, nil
 }
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
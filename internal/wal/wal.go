@@ -1,32 +1,93 @@
 package wal
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
 )
 
 const (
 	defaultDebounceInterval = 100 * time.Millisecond
 	defaultMaxOperations    = 100
+	defaultMaxRetries       = 3
+	defaultRetryInterval    = time.Second
+	eventBufferSize         = 16
 )
 
+// ErrClosed is returned when appending to a closed WAL
+var ErrClosed = errors.New("wal is closed")
+
+// ErrUnreachable is returned by UndoTo and RedoTo when the operation is
+// not on the path they walk
+var ErrUnreachable = errors.New("operation is not reachable")
+
 // WAL manages the Write-Ahead Log
 type WAL struct {
 	db              *sql.DB
 	mu              sync.Mutex
+	flushMu         sync.Mutex // serializes flushes so operations apply in order
+	writeMu         sync.Mutex // held by the action that is writing, see Lock
 	pending         []*Operation
 	debounceTimer   *time.Timer
 	debounceInterval time.Duration
 	applyFunc       func([]*Operation) error
+	attempts        int // consecutive failed flushes
+	maxRetries      int
+	retryInterval   time.Duration
+	events          chan FlushEvent
+	closed          bool
+	retention       RetentionPolicy
 }
 
 // Config holds WAL configuration
 type Config struct {
 	DebounceInterval time.Duration
 	ApplyFunc        func([]*Operation) error
+	MaxRetries       int             // Failed flushes retried before the ops are discarded
+	RetryInterval    time.Duration   // Delay before the first retry, doubled on each attempt
+	Retention        RetentionPolicy // Undo history kept by Compact
+}
+
+// FlushError reports pending operations that could not be applied.
+// While RetryIn is set they are still pending and will be retried. Once
+// retries are exhausted they are Discarded: dropped from the log, so
+// they never show up later. Operations still pending when the WAL is
+// closed are neither; they stay in the log for recovery.
+type FlushError struct {
+	Err       error
+	Pending   int           // Operations waiting to be applied, or discarded
+	Attempt   int           // Consecutive failed attempts
+	RetryIn   time.Duration // Zero once retries are exhausted
+	Discarded bool
+}
+
+// Error implements error
+func (e *FlushError) Error() string {
+	switch {
+	case e.RetryIn > 0:
+		return fmt.Sprintf("WAL apply failed (attempt %d), %d ops pending, retrying in %s: %v", e.Attempt, e.Pending, e.RetryIn, e.Err)
+	case e.Discarded:
+		return fmt.Sprintf("WAL apply failed after %d attempts, %d ops discarded: %v", e.Attempt, e.Pending, e.Err)
+	}
+	return fmt.Sprintf("WAL apply failed after %d attempts, %d ops left for recovery: %v", e.Attempt, e.Pending, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+// FlushEvent reports the outcome of a background flush that follows a
+// failed one: either another failure, or the operations a retry saved
+type FlushEvent struct {
+	Err   *FlushError
+	Saved int // Operations applied by a successful retry
 }
 
 // New creates a new WAL instance
@@ -35,12 +96,47 @@ func New(db *sql.DB, cfg Config) *WAL {
 	if interval == 0 {
 		interval = defaultDebounceInterval
 	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	retryInterval := cfg.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
 
 	return &WAL{
 		db:               db,
 		debounceInterval: interval,
 		applyFunc:        cfg.ApplyFunc,
+		maxRetries:       maxRetries,
+		retryInterval:    retryInterval,
+		events:           make(chan FlushEvent, eventBufferSize),
+		retention:        cfg.Retention.withDefaults(),
+	}
+}
+
+// Events returns the channel on which background flush failures, and
+// the retries that recover from them, are reported
+func (w *WAL) Events() <-chan FlushEvent {
+	return w.events
+}
+
+// lockKey marks a context that holds the write lock of a WAL
+type lockKey struct{ w *WAL }
+
+// Lock waits until no other action is writing through the WAL and
+// returns a context that holds the write lock, with the function that
+// releases it. An action takes the lock before it reads the rows it is
+// about to change, so nothing else in this process changes them until
+// its operations are applied. Locking a context that already holds the
+// lock returns at once, so repositories can call each other.
+func (w *WAL) Lock(ctx context.Context) (context.Context, func()) {
+	if ctx.Value(lockKey{w}) != nil {
+		return ctx, func() {}
 	}
+	w.writeMu.Lock()
+	return context.WithValue(ctx, lockKey{w}, true), w.writeMu.Unlock
 }
 
 // Append adds a new operation to the WAL
@@ -48,71 +144,293 @@ func (w *WAL) Append(op *Operation) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if w.closed {
+		return ErrClosed
+	}
+
 	// Marshal payload
 	payloadJSON, err := json.Marshal(op.Payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A new operation by the user drops the redo branch. The dropped
+	// operations stay in the log for time travel.
+	if !op.System {
+		if _, err := tx.Exec(`UPDATE operation_log SET is_discarded = 1 WHERE is_undone = 1`); err != nil {
+			return fmt.Errorf("failed to drop redo history: %w", err)
+		}
+	}
+
 	// Insert into operation_log
-	result, err := w.db.Exec(`
-		INSERT INTO operation_log (operation_type, entity_type, entity_id, payload, undo_group_id)
-		VALUES (?, ?, ?, ?, ?)
-	`, op.OperationType, op.EntityType, op.EntityID, string(payloadJSON), op.UndoGroupID)
+	createdAt := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO operation_log (operation_type, entity_type, entity_id, payload, undo_group_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, op.OperationType, op.EntityType, op.EntityID, string(payloadJSON), op.UndoGroupID, domain.FormatTime(createdAt))
 	if err != nil {
 		return fmt.Errorf("failed to insert operation: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to insert operation: %w", err)
+	}
+
 	id, _ := result.LastInsertId()
 	op.ID = id
-	op.CreatedAt = time.Now()
+	op.CreatedAt = createdAt
 
 	// Add to pending list
 	w.pending = append(w.pending, op)
 
 	// Reset debounce timer
+	w.scheduleFlush(w.debounceInterval)
+
+	return nil
+}
+
+// scheduleFlush (re)starts the timer for a background flush. Callers hold w.mu.
+func (w *WAL) scheduleFlush(d time.Duration) {
 	if w.debounceTimer != nil {
 		w.debounceTimer.Stop()
 	}
-	w.debounceTimer = time.AfterFunc(w.debounceInterval, func() {
-		w.flush()
+	if w.closed {
+		return
+	}
+	w.debounceTimer = time.AfterFunc(d, func() {
+		if err := w.flush(); err != nil {
+			// Operations are already in WAL - report and keep going
+			w.reportError(err)
+		}
 	})
+}
 
-	return nil
+// reportError hands a background flush failure to whoever reads Events
+func (w *WAL) reportError(err error) {
+	fe, ok := err.(*FlushError)
+	if !ok {
+		fe = &FlushError{Err: err}
+	}
+	w.report(FlushEvent{Err: fe})
+}
+
+// report hands an event to whoever reads Events, dropping it if nobody
+// keeps up
+func (w *WAL) report(ev FlushEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	select {
+	case w.events <- ev:
+	default:
+	}
 }
 
 // flush applies pending operations to main tables
-func (w *WAL) flush() {
+func (w *WAL) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
 	w.mu.Lock()
 	pending := w.pending
 	w.pending = nil
 	w.mu.Unlock()
 
 	if len(pending) == 0 {
-		return
+		return nil
+	}
+
+	if err := w.apply(pending); err != nil {
+		return w.retryLater(pending, err)
+	}
+
+	w.mu.Lock()
+	retried := w.attempts > 0
+	w.attempts = 0
+	w.mu.Unlock()
+
+	// Whoever was told these operations were pending learns they are saved
+	if retried {
+		saved := 0
+		for _, op := range pending {
+			if op.Applied {
+				saved++
+			}
+		}
+		w.report(FlushEvent{Saved: saved})
 	}
 
-	// Apply operations
-	if w.applyFunc != nil {
-		if err := w.applyFunc(pending); err != nil {
-			// Log error but don't fail - operations are already in WAL
-			fmt.Printf("WAL apply error: %v\n", err)
-			return
+	return nil
+}
+
+// apply runs applyFunc on each operation in order and marks it as
+// applied. An operation applyFunc rejects with domain.ErrConflict was
+// logged from rows that changed before it could be applied. Retrying
+// cannot help, so it is dropped from the log, its error is kept in
+// Rejected, and the operations after it still apply.
+func (w *WAL) apply(ops []*Operation) error {
+	for _, op := range ops {
+		if op.Applied || op.Rejected != nil {
+			continue
+		}
+
+		if w.applyFunc != nil {
+			err := w.applyFunc([]*Operation{op})
+			if errors.Is(err, domain.ErrConflict) {
+				if _, err := w.db.Exec(`DELETE FROM operation_log WHERE id = ?`, op.ID); err != nil {
+					return fmt.Errorf("failed to drop rejected op %d: %w", op.ID, err)
+				}
+				op.Rejected = err
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := w.markApplied(op); err != nil {
+			return err
 		}
 	}
 
-	// Mark as applied
-	for _, op := range pending {
-		w.db.Exec(`UPDATE operation_log SET applied = 1 WHERE id = ?`, op.ID)
+	return nil
+}
+
+// markApplied marks an operation applied and records the transition
+func (w *WAL) markApplied(op *Operation) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE operation_log SET applied = 1 WHERE id = ?`, op.ID); err != nil {
+		return fmt.Errorf("failed to mark op %d as applied: %w", op.ID, err)
+	}
+	if err := recordTransition(tx, op, false); err != nil {
+		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to mark op %d as applied: %w", op.ID, err)
+	}
+	op.Applied = true
+	return nil
+}
+
+// recordTransition records that op was just applied or redone, or undone
+func recordTransition(tx *sql.Tx, op *Operation, undone bool) error {
+	_, err := tx.Exec(`
+		INSERT INTO operation_transitions (operation_id, is_undone, created_at)
+		VALUES (?, ?, ?)
+	`, op.ID, undone, domain.FormatTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to record transition of op %d: %w", op.ID, err)
+	}
+	return nil
+}
+
+// retryLater puts failed operations back in front of the queue and
+// schedules another flush with exponential backoff. Once retries are
+// exhausted the operations are discarded from the log along with those
+// queued behind them, which were planned on top of them, so a change
+// reported as failed never shows up later. If the WAL is closing they
+// are only dropped from memory; they stay unapplied in the log and are
+// picked up by recovery on the next start.
+func (w *WAL) retryLater(failed []*Operation, err error) *FlushError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.attempts++
+	fe := &FlushError{Err: err, Attempt: w.attempts}
+
+	var remaining []*Operation
+	for _, op := range failed {
+		if !op.Applied && op.Rejected == nil {
+			remaining = append(remaining, op)
+		}
+	}
+
+	if w.closed || w.attempts > w.maxRetries {
+		dropped := append(remaining, w.pending...)
+		fe.Pending = len(dropped)
+		w.pending = nil
+		w.attempts = 0
+		if !w.closed {
+			if derr := discard(w.db, dropped); derr != nil {
+				fe.Err = errors.Join(err, derr)
+			} else {
+				fe.Discarded = true
+			}
+		}
+		return fe
+	}
+
+	w.pending = append(remaining, w.pending...)
+	fe.Pending = len(w.pending)
+	fe.RetryIn = w.retryInterval << (w.attempts - 1)
+	w.scheduleFlush(fe.RetryIn)
+
+	return fe
+}
+
+// discard deletes operations that will never be applied from the log
+func discard(db *sql.DB, ops []*Operation) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		if _, err := tx.Exec(`DELETE FROM operation_log WHERE id = ? AND applied = 0`, op.ID); err != nil {
+			return fmt.Errorf("failed to discard op %d: %w", op.ID, err)
+		}
+	}
+	return tx.Commit()
 }
 
 // Flush forces immediate flush of pending operations
-func (w *WAL) Flush() {
+func (w *WAL) Flush() error {
+	w.mu.Lock()
 	if w.debounceTimer != nil {
 		w.debounceTimer.Stop()
 	}
-	w.flush()
+	w.mu.Unlock()
+
+	return w.flush()
+}
+
+// Close stops the flush timer and applies whatever is still pending.
+// Appending after Close fails, and the Events channel is closed.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.debounceTimer != nil {
+		w.debounceTimer.Stop()
+	}
+	w.mu.Unlock()
+
+	// Waits for a flush already running on the timer
+	err := w.flush()
+
+	w.mu.Lock()
+	close(w.events)
+	w.mu.Unlock()
+
+	return err
 }
 
 // Recovery replays unapplied operations on startup
@@ -128,60 +446,409 @@ func (w *WAL) Recovery() ([]*Operation, error) {
 	}
 	defer rows.Close()
 
-	var ops []*Operation
-	for rows.Next() {
-		var op Operation
-		var payloadStr string
-		var createdAtStr string
-		var undoGroupID sql.NullString
+	return scanOperations(rows)
+}
 
-		err := rows.Scan(
-			&op.ID,
-			&op.OperationType,
-			&op.EntityType,
-			&op.EntityID,
-			&payloadStr,
-			&op.IsUndone,
-			&undoGroupID,
-			&createdAtStr,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan operation: %w", err)
-		}
+// GetUndoOperations returns operations that can be undone, newest first
+func (w *WAL) GetUndoOperations(limit int) ([]*Operation, error) {
+	if limit <= 0 {
+		limit = defaultMaxOperations
+	}
 
-		if err := json.Unmarshal([]byte(payloadStr), &op.Payload); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
-		}
+	rows, err := w.db.Query(`
+		SELECT id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
+		FROM operation_log
+		WHERE applied = 1 AND is_undone = 0
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query undo operations: %w", err)
+	}
+	defer rows.Close()
 
-		if undoGroupID.Valid {
-			op.UndoGroupID = undoGroupID.String
-		}
+	return scanOperations(rows)
+}
 
-		op.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
-		ops = append(ops, &op)
+// GetRedoOperations returns undone operations that can be redone, oldest first
+func (w *WAL) GetRedoOperations(limit int) ([]*Operation, error) {
+	if limit <= 0 {
+		limit = defaultMaxOperations
 	}
 
-	return ops, nil
+	rows, err := w.db.Query(`
+		SELECT id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
+		FROM operation_log
+		WHERE applied = 1 AND is_undone = 1 AND is_discarded = 0
+		ORDER BY id ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redo operations: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOperations(rows)
 }
 
-// GetUndoOperations returns operations that can be undone
-func (w *WAL) GetUndoOperations(limit int) ([]*Operation, error) {
+// GetHistory returns applied operations, undone or not, newest first.
+// Undone operations a later change dropped from the redo branch are left out.
+func (w *WAL) GetHistory(limit int) ([]*Operation, error) {
 	if limit <= 0 {
 		limit = defaultMaxOperations
 	}
 
 	rows, err := w.db.Query(`
-		SELECT id, operation_type, entity_type, entity_id, payload, undo_group_id, created_at
+		SELECT id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
 		FROM operation_log
-		WHERE applied = 1 AND is_undone = 0
+		WHERE applied = 1 AND is_discarded = 0
 		ORDER BY id DESC
 		LIMIT ?
 	`, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query undo operations: %w", err)
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOperations(rows)
+}
+
+// Transition is an operation being applied or redone, or undone
+type Transition struct {
+	Op     *Operation
+	Undone bool
+	At     time.Time
+}
+
+// GetTransitionsSince returns every transition after t, newest first.
+// It fails with domain.ErrHistoryUnavailable if an operation it needs
+// was compacted away.
+func (w *WAL) GetTransitionsSince(t time.Time) ([]*Transition, error) {
+	since := domain.FormatTime(t)
+
+	var missing int
+	err := w.db.QueryRow(`
+		SELECT COUNT(*) FROM operation_transitions t
+		LEFT JOIN operation_log o ON o.id = t.operation_id
+		WHERE t.created_at > ? AND o.id IS NULL
+	`, since).Scan(&missing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transitions: %w", err)
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("%w: %d undone changes since then have been compacted", domain.ErrHistoryUnavailable, missing)
+	}
+
+	rows, err := w.db.Query(`
+		SELECT o.id, o.operation_type, o.entity_type, o.entity_id, o.payload, o.is_undone, o.undo_group_id, o.created_at,
+			t.is_undone, t.created_at
+		FROM operation_transitions t
+		JOIN operation_log o ON o.id = t.operation_id
+		WHERE t.created_at > ?
+		ORDER BY t.id DESC
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transitions: %w", err)
+	}
+	defer rows.Close()
+
+	var transitions []*Transition
+	for rows.Next() {
+		op, tr := &Operation{Applied: true}, &Transition{}
+		var payload, createdAt, at string
+		var undoGroupID sql.NullString
+		err := rows.Scan(&op.ID, &op.OperationType, &op.EntityType, &op.EntityID, &payload, &op.IsUndone, &undoGroupID, &createdAt,
+			&tr.Undone, &at)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transition: %w", err)
+		}
+		if err := json.Unmarshal([]byte(payload), &op.Payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payload of op %d: %w", op.ID, err)
+		}
+		op.UndoGroupID = undoGroupID.String
+		if op.CreatedAt, err = domain.ParseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse op %d: %w", op.ID, err)
+		}
+		if tr.At, err = domain.ParseTime(at); err != nil {
+			return nil, fmt.Errorf("failed to parse transition of op %d: %w", op.ID, err)
+		}
+		tr.Op = op
+		transitions = append(transitions, tr)
+	}
+
+	return transitions, rows.Err()
+}
+
+// HistoryStart returns the earliest time the log can reconstruct, or the
+// zero time if nothing has been compacted yet
+func (w *WAL) HistoryStart() (time.Time, error) {
+	var start sql.NullString
+	err := w.db.QueryRow(`
+		SELECT COALESCE(
+			(SELECT MIN(created_at) FROM operation_log),
+			(SELECT MAX(created_at) FROM wal_checkpoints)
+		)
+		WHERE EXISTS (SELECT 1 FROM wal_checkpoints)
+	`).Scan(&start)
+	if err == sql.ErrNoRows || (err == nil && !start.Valid) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query history start: %w", err)
+	}
+
+	t, err := domain.ParseTime(start.String)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query history start: %w", err)
+	}
+	return t, nil
+}
+
+// GetUndoGroup returns the operations of the most recent group that can be
+// undone, newest first
+func (w *WAL) GetUndoGroup() ([]*Operation, error) {
+	return undoGroup(w.db)
+}
+
+// undoGroup runs GetUndoGroup on q
+func undoGroup(q queryer) ([]*Operation, error) {
+	rows, err := q.Query(`
+		SELECT id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
+		FROM operation_log
+		WHERE applied = 1 AND is_undone = 0
+			AND `+groupKey+` = (
+				SELECT `+groupKey+` FROM operation_log
+				WHERE applied = 1 AND is_undone = 0
+				ORDER BY id DESC
+				LIMIT 1
+			)
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query undo group: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOperations(rows)
+}
+
+// GetRedoGroup returns the operations of the oldest undone group, oldest first
+func (w *WAL) GetRedoGroup() ([]*Operation, error) {
+	return redoGroup(w.db)
+}
+
+// redoGroup runs GetRedoGroup on q
+func redoGroup(q queryer) ([]*Operation, error) {
+	rows, err := q.Query(`
+		SELECT id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
+		FROM operation_log
+		WHERE applied = 1 AND is_undone = 1 AND is_discarded = 0
+			AND `+groupKey+` = (
+				SELECT `+groupKey+` FROM operation_log
+				WHERE applied = 1 AND is_undone = 1 AND is_discarded = 0
+				ORDER BY id ASC
+				LIMIT 1
+			)
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redo group: %w", err)
 	}
 	defer rows.Close()
 
+	return scanOperations(rows)
+}
+
+// TxFunc applies or reverts operations inside tx
+type TxFunc func(tx *sql.Tx, ops []*Operation) error
+
+// Undo reverts the most recent group that can be undone with revert and
+// marks it undone, both in one transaction: if either fails, the data
+// and the log stay as they were. It returns the group's operations,
+// newest first, or nil when there is nothing to undo.
+func (w *WAL) Undo(ctx context.Context, revert TxFunc) ([]*Operation, error) {
+	_, unlock := w.Lock(ctx)
+	defer unlock()
+
+	return w.inTx(func(tx *sql.Tx) ([]*Operation, error) {
+		ops, err := undoGroup(tx)
+		if err != nil || len(ops) == 0 {
+			return nil, err
+		}
+		if err := revert(tx, ops); err != nil {
+			return nil, err
+		}
+		return ops, markUndone(tx, true, ops)
+	})
+}
+
+// Redo re-applies the oldest undone group with apply and marks it redone,
+// both in one transaction. It returns the group's operations, oldest
+// first, or nil when there is nothing to redo.
+func (w *WAL) Redo(ctx context.Context, apply TxFunc) ([]*Operation, error) {
+	_, unlock := w.Lock(ctx)
+	defer unlock()
+
+	return w.inTx(func(tx *sql.Tx) ([]*Operation, error) {
+		ops, err := redoGroup(tx)
+		if err != nil || len(ops) == 0 {
+			return nil, err
+		}
+		if err := apply(tx, ops); err != nil {
+			return nil, err
+		}
+		return ops, markUndone(tx, false, ops)
+	})
+}
+
+// UndoTo reverts every group newer than the one holding opID with revert
+// and marks them undone, all in one transaction: if any group fails, the
+// data and the log stay as they were. It returns the number of groups
+// undone, or ErrUnreachable when opID is not an operation that is
+// currently applied.
+func (w *WAL) UndoTo(ctx context.Context, opID int64, revert TxFunc) (int, error) {
+	_, unlock := w.Lock(ctx)
+	defer unlock()
+
+	var n int
+	_, err := w.inTx(func(tx *sql.Tx) ([]*Operation, error) {
+		if err := checkReachable(tx, opID, false); err != nil {
+			return nil, err
+		}
+		for {
+			ops, err := undoGroup(tx)
+			if err != nil {
+				return nil, err
+			}
+			if len(ops) == 0 || containsOp(ops, opID) {
+				return nil, nil
+			}
+			if err := revert(tx, ops); err != nil {
+				return nil, err
+			}
+			if err := markUndone(tx, true, ops); err != nil {
+				return nil, err
+			}
+			n++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// RedoTo re-applies every undone group up to and including the one
+// holding opID with apply and marks them redone, all in one transaction.
+// It returns the number of groups redone, or ErrUnreachable when opID is
+// not an operation that can be redone.
+func (w *WAL) RedoTo(ctx context.Context, opID int64, apply TxFunc) (int, error) {
+	_, unlock := w.Lock(ctx)
+	defer unlock()
+
+	var n int
+	_, err := w.inTx(func(tx *sql.Tx) ([]*Operation, error) {
+		if err := checkReachable(tx, opID, true); err != nil {
+			return nil, err
+		}
+		for {
+			ops, err := redoGroup(tx)
+			if err != nil {
+				return nil, err
+			}
+			if len(ops) == 0 {
+				return nil, nil
+			}
+			if err := apply(tx, ops); err != nil {
+				return nil, err
+			}
+			if err := markUndone(tx, false, ops); err != nil {
+				return nil, err
+			}
+			n++
+			if containsOp(ops, opID) {
+				return nil, nil
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// checkReachable returns ErrUnreachable unless opID is in the log, applied,
+// not discarded and undone as given
+func checkReachable(tx *sql.Tx, opID int64, undone bool) error {
+	var n int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM operation_log
+		WHERE id = ? AND applied = 1 AND is_undone = ? AND is_discarded = 0
+	`, opID, undone).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to query op %d: %w", opID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("op %d: %w", opID, ErrUnreachable)
+	}
+	return nil
+}
+
+// containsOp returns true if ops hold the operation
+func containsOp(ops []*Operation, opID int64) bool {
+	for _, op := range ops {
+		if op.ID == opID {
+			return true
+		}
+	}
+	return false
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds. Flushes
+// wait for it, so no operation is applied in the middle.
+func (w *WAL) inTx(fn func(tx *sql.Tx) ([]*Operation, error)) ([]*Operation, error) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ops, err := fn(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ops, nil
+}
+
+// markUndone sets the undone flag of ops in the log and on the
+// operations, and records the transitions
+func markUndone(tx *sql.Tx, undone bool, ops []*Operation) error {
+	for _, op := range ops {
+		if _, err := tx.Exec(`UPDATE operation_log SET is_undone = ? WHERE id = ?`, undone, op.ID); err != nil {
+			return fmt.Errorf("failed to update op %d: %w", op.ID, err)
+		}
+		if err := recordTransition(tx, op, undone); err != nil {
+			return err
+		}
+		op.IsUndone = undone
+	}
+	return nil
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// scanOperations reads operation_log rows selected as
+// id, operation_type, entity_type, entity_id, payload, is_undone, undo_group_id, created_at
+func scanOperations(rows *sql.Rows) ([]*Operation, error) {
 	var ops []*Operation
 	for rows.Next() {
 		var op Operation
@@ -195,6 +862,7 @@ func (w *WAL) GetUndoOperations(limit int) ([]*Operation, error) {
 			&op.EntityType,
 			&op.EntityID,
 			&payloadStr,
+			&op.IsUndone,
 			&undoGroupID,
 			&createdAtStr,
 		)
@@ -210,31 +878,13 @@ func (w *WAL) GetUndoOperations(limit int) ([]*Operation, error) {
 			op.UndoGroupID = undoGroupID.String
 		}
 
-		op.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAtStr)
+		op.CreatedAt, err = domain.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan operation: %w", err)
+		}
+
 		ops = append(ops, &op)
 	}
 
-	return ops, nil
-}
-
-// MarkUndone marks an operation as undone
-func (w *WAL) MarkUndone(opID int64) error {
-	_, err := w.db.Exec(`UPDATE operation_log SET is_undone = 1 WHERE id = ?`, opID)
-	return err
-}
-
-// MarkRedone marks an operation as redone (not undone)
-func (w *WAL) MarkRedone(opID int64) error {
-	_, err := w.db.Exec(`UPDATE operation_log SET is_undone = 0 WHERE id = ?`, opID)
-	return err
-}
-
-// Cleanup removes old applied operations
-func (w *WAL) Cleanup(olderThan time.Duration) error {
-	cutoff := time.Now().Add(-olderThan).Format("2006-01-02 15:04:05")
-	_, err := w.db.Exec(`
-		DELETE FROM operation_log
-		WHERE applied = 1 AND is_undone = 1 AND created_at < ?
-	`, cutoff)
-	return err
+	return ops, rows.Err()
 }
@@ -0,0 +1,390 @@
+package wal_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yuichikadota/lazytodo/internal/domain"
+	"github.com/yuichikadota/lazytodo/internal/repository"
+	"github.com/yuichikadota/lazytodo/internal/wal"
+)
+
+// newTestWAL opens a migrated database in a temporary directory with a WAL
+// configured by cfg
+func newTestWAL(t *testing.T, cfg wal.Config) (*sql.DB, *wal.WAL) {
+	t.Helper()
+
+	db, err := repository.NewDB(filepath.Join(t.TempDir(), "lazytodo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	w := wal.New(db.DB, cfg)
+	t.Cleanup(func() {
+		w.Close()
+		db.Close()
+	})
+	return db.DB, w
+}
+
+// newOp returns an operation on a todo with an empty payload
+func newOp(entityID, group string) *wal.Operation {
+	return &wal.Operation{
+		OperationType: wal.OpUpdate,
+		EntityType:    wal.EntityTodo,
+		EntityID:      entityID,
+		UndoGroupID:   group,
+	}
+}
+
+// logged returns the entity IDs in the log with their applied flag
+func logged(t *testing.T, db *sql.DB) map[string]bool {
+	t.Helper()
+	rows, err := db.Query(`SELECT entity_id, applied FROM operation_log`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	ops := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var applied bool
+		if err := rows.Scan(&id, &applied); err != nil {
+			t.Fatal(err)
+		}
+		ops[id] = applied
+	}
+	return ops
+}
+
+func TestConflictingOperationIsDropped(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{
+		ApplyFunc: func(ops []*wal.Operation) error {
+			for _, op := range ops {
+				if op.EntityID == "stale" {
+					return domain.ErrConflict
+				}
+			}
+			return nil
+		},
+	})
+
+	stale, fresh := newOp("stale", "g1"), newOp("fresh", "g2")
+	for _, op := range []*wal.Operation{stale, fresh} {
+		if err := w.Append(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if !errors.Is(stale.Rejected, domain.ErrConflict) || stale.Applied {
+		t.Errorf("stale op: applied %v, rejected with %v", stale.Applied, stale.Rejected)
+	}
+	if !fresh.Applied || fresh.Rejected != nil {
+		t.Errorf("fresh op: applied %v, rejected with %v", fresh.Applied, fresh.Rejected)
+	}
+
+	got := logged(t, db)
+	if _, ok := got["stale"]; ok || !got["fresh"] || len(got) != 1 {
+		t.Errorf("log holds %v, want only the fresh op, applied", got)
+	}
+}
+
+// applyAll is an ApplyFunc that accepts every operation
+func applyAll([]*wal.Operation) error { return nil }
+
+// applyAllIn is a TxFunc that accepts every operation
+func applyAllIn(*sql.Tx, []*wal.Operation) error { return nil }
+
+// appendGroups logs and applies one operation per group
+func appendGroups(t *testing.T, w *wal.WAL, groups ...string) {
+	t.Helper()
+	for _, g := range groups {
+		if err := w.Append(newOp("todo-"+g, g)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// undone returns the entity IDs of the operations in the log that can be
+// redone
+func undone(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT entity_id FROM operation_log WHERE is_undone = 1 AND is_discarded = 0 ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestUndoRevertsAndMarksInOneTransaction(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{ApplyFunc: applyAll})
+	appendGroups(t, w, "a", "b")
+
+	ops, err := w.Undo(context.Background(), func(tx *sql.Tx, ops []*wal.Operation) error {
+		_, err := tx.Exec(`INSERT INTO saved_views (id, name, query, position, created_at, updated_at)
+			VALUES ('v', 'v', 'q', 0, '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z')`)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].EntityID != "todo-b" || !ops[0].IsUndone {
+		t.Fatalf("undo returned %v, want the latest group marked undone", ops)
+	}
+	if got := undone(t, db); len(got) != 1 || got[0] != "todo-b" {
+		t.Errorf("undone ops are %v, want [todo-b]", got)
+	}
+
+	// A revert that fails leaves neither its writes nor the undone flag
+	failure := errors.New("disk full")
+	_, err = w.Undo(context.Background(), func(tx *sql.Tx, ops []*wal.Operation) error {
+		if _, err := tx.Exec(`DELETE FROM saved_views`); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("undo: got %v, want %v", err, failure)
+	}
+	if got := undone(t, db); len(got) != 1 {
+		t.Errorf("undone ops are %v after a failed undo, want only [todo-b]", got)
+	}
+	var views int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM saved_views`).Scan(&views); err != nil {
+		t.Fatal(err)
+	}
+	if views != 1 {
+		t.Error("the failed revert's writes were committed")
+	}
+}
+
+func TestRedoAppliesAndMarksInOneTransaction(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{ApplyFunc: applyAll})
+	appendGroups(t, w, "a", "b")
+	for i := 0; i < 2; i++ {
+		if _, err := w.Undo(context.Background(), applyAllIn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A redo that fails leaves the group undone
+	failure := errors.New("disk full")
+	_, err := w.Redo(context.Background(), func(*sql.Tx, []*wal.Operation) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Fatalf("redo: got %v, want %v", err, failure)
+	}
+	if got := undone(t, db); len(got) != 2 {
+		t.Errorf("undone ops are %v after a failed redo, want both", got)
+	}
+
+	ops, err := w.Redo(context.Background(), applyAllIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].EntityID != "todo-a" || ops[0].IsUndone {
+		t.Fatalf("redo returned %v, want the oldest undone group marked redone", ops)
+	}
+	if got := undone(t, db); len(got) != 1 || got[0] != "todo-b" {
+		t.Errorf("undone ops are %v, want [todo-b]", got)
+	}
+}
+
+// opID returns the log ID of the operation on the entity
+func opID(t *testing.T, db *sql.DB, entityID string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.QueryRow(`SELECT id FROM operation_log WHERE entity_id = ?`, entityID).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestUndoToAndRedoToWalkInOneTransaction(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{ApplyFunc: applyAll})
+	appendGroups(t, w, "a", "b", "c", "d")
+	ctx := context.Background()
+
+	// A revert failing partway leaves every group applied
+	failure := errors.New("disk full")
+	reverted := 0
+	_, err := w.UndoTo(ctx, opID(t, db, "todo-a"), func(*sql.Tx, []*wal.Operation) error {
+		if reverted++; reverted == 2 {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("undo to: got %v, want %v", err, failure)
+	}
+	if got := undone(t, db); len(got) != 0 {
+		t.Errorf("undone ops are %v after a failed jump, want none", got)
+	}
+
+	n, err := w.UndoTo(ctx, opID(t, db, "todo-a"), applyAllIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := undone(t, db); n != 3 || len(got) != 3 || got[0] != "todo-b" {
+		t.Errorf("undid %d groups to %v, want 3 down to todo-a", n, got)
+	}
+
+	n, err = w.RedoTo(ctx, opID(t, db, "todo-c"), applyAllIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := undone(t, db); n != 2 || len(got) != 1 || got[0] != "todo-d" {
+		t.Errorf("redid %d groups leaving %v undone, want 2 leaving [todo-d]", n, got)
+	}
+}
+
+func TestUnreachableJumpChangesNothing(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{ApplyFunc: applyAll})
+	appendGroups(t, w, "a", "b")
+	ctx := context.Background()
+	if _, err := w.Undo(ctx, applyAllIn); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	count := func(*sql.Tx, []*wal.Operation) error {
+		calls++
+		return nil
+	}
+	b, a := opID(t, db, "todo-b"), opID(t, db, "todo-a")
+	for name, jump := range map[string]func() (int, error){
+		"undo to an undone op":  func() (int, error) { return w.UndoTo(ctx, b, count) },
+		"redo to an applied op": func() (int, error) { return w.RedoTo(ctx, a, count) },
+		"undo to a missing op":  func() (int, error) { return w.UndoTo(ctx, b+100, count) },
+	} {
+		if _, err := jump(); !errors.Is(err, wal.ErrUnreachable) {
+			t.Errorf("%s: got %v, want ErrUnreachable", name, err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("unreachable jumps touched %d groups, want none", calls)
+	}
+	if got := undone(t, db); len(got) != 1 || got[0] != "todo-b" {
+		t.Errorf("undone ops are %v, want [todo-b]", got)
+	}
+}
+
+func TestSystemOperationKeepsTheRedoBranch(t *testing.T) {
+	db, w := newTestWAL(t, wal.Config{ApplyFunc: applyAll})
+	appendGroups(t, w, "a")
+	if _, err := w.Undo(context.Background(), applyAllIn); err != nil {
+		t.Fatal(err)
+	}
+
+	system := newOp("todo-archived", "archive")
+	system.System = true
+	if err := w.Append(system); err != nil {
+		t.Fatal(err)
+	}
+	if got := undone(t, db); len(got) != 1 {
+		t.Fatalf("undone ops are %v after a system operation, want [todo-a]", got)
+	}
+
+	appendGroups(t, w, "b")
+	if got := undone(t, db); len(got) != 0 {
+		t.Errorf("undone ops are %v after a user operation, want none", got)
+	}
+}
+
+// nextEvent waits for the next event reported by w
+func nextEvent(t *testing.T, w *wal.WAL) wal.FlushEvent {
+	t.Helper()
+	select {
+	case ev := <-w.Events():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no flush event")
+		return wal.FlushEvent{}
+	}
+}
+
+func TestFailedFlushIsPendingUntilARetrySavesIt(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	failure := errors.New("database is locked")
+	db, w := newTestWAL(t, wal.Config{
+		RetryInterval: time.Millisecond,
+		ApplyFunc: func([]*wal.Operation) error {
+			if failing.Load() {
+				return failure
+			}
+			return nil
+		},
+	})
+
+	if err := w.Append(newOp("todo-a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	var fe *wal.FlushError
+	if err := w.Flush(); !errors.As(err, &fe) || fe.RetryIn == 0 || fe.Discarded {
+		t.Fatalf("flush: got %v, want a failure that is retried", err)
+	}
+
+	failing.Store(false)
+	for {
+		ev := nextEvent(t, w)
+		if ev.Err == nil {
+			if ev.Saved != 1 {
+				t.Errorf("the retry saved %d ops, want 1", ev.Saved)
+			}
+			break
+		}
+	}
+	if got := logged(t, db); !got["todo-a"] {
+		t.Errorf("log holds %v, want todo-a applied", got)
+	}
+}
+
+func TestFailedFlushIsDiscardedOnceRetriesRunOut(t *testing.T) {
+	failure := errors.New("disk I/O error")
+	db, w := newTestWAL(t, wal.Config{
+		MaxRetries:    1,
+		RetryInterval: time.Millisecond,
+		ApplyFunc:     func([]*wal.Operation) error { return failure },
+	})
+
+	if err := w.Append(newOp("todo-a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("flush succeeded")
+	}
+
+	ev := nextEvent(t, w)
+	if ev.Err == nil || !ev.Err.Discarded || ev.Err.Pending != 1 || !errors.Is(ev.Err, failure) {
+		t.Fatalf("got event %+v, want the op discarded", ev)
+	}
+	if got := logged(t, db); len(got) != 0 {
+		t.Errorf("log holds %v after the op was reported discarded", got)
+	}
+}
@@ -3,28 +3,84 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/yuichikadota/lazytodo/internal/app"
+	"github.com/yuichikadota/lazytodo/internal/cli"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	model := app.New(app.Config{})
 
 	p := tea.NewProgram(
 		model,
 		tea.WithAltScreen(),
+		tea.WithoutSignalHandler(),
 	)
 
+	// Quit through the program on SIGINT, SIGTERM and SIGHUP so the
+	// same shutdown path runs as for 'q'
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		if _, ok := <-sigs; ok {
+			p.Quit()
+		}
+	}()
+
 	finalModel, err := p.Run()
+	signal.Stop(sigs)
+	close(sigs)
+
+	// Flush the WAL and close the database connection. The models share
+	// their connections, so the initial one will do if Run failed early.
+	m, ok := finalModel.(app.Model)
+	if !ok {
+		m = model
+	}
+	if cerr := m.Shutdown(app.DefaultShutdownTimeout); cerr != nil {
+		fmt.Fprintf(os.Stderr, "Error during shutdown: %v\n", cerr)
+		if err == nil {
+			os.Exit(1)
+		}
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
+
+// runCommand runs a non-interactive subcommand and exits
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "migrate":
+		// Show, apply or roll back schema migrations
+		err = cli.Migrate(args, os.Stdout)
+	case "maintenance":
+		// Compact the operation log and report its size
+		err = cli.Maintenance(args, os.Stdout)
+	case "fsck":
+		// Check the trees for cycles and orphans, and repair them
+		err = cli.Fsck(args, os.Stdout)
+	case "tags":
+		// List tags with their counts, or rename one across every todo
+		err = cli.Tags(args, os.Stdout)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
 
-	// Close database connection
-	if m, ok := finalModel.(app.Model); ok {
-		m.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }